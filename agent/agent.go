@@ -18,23 +18,52 @@ import (
 	"github.com/influxdata/telegraf/internal/clock"
 	"github.com/influxdata/telegraf/models"
 	"github.com/influxdata/telegraf/plugins/common/snmp"
-	"github.com/influxdata/telegraf/plugins/processors"
 	"github.com/influxdata/telegraf/plugins/serializers/influx"
 )
 
 // Agent runs a set of plugins.
 type Agent struct {
 	Config *config.Config
+
+	// Units of the running agent per pipeline used to apply configuration
+	// changes
+	sync.Mutex
+	running []*runningUnits
+
+	// Serializes reloading the configuration
+	reloadMu sync.Mutex
+
+	// Closed once all plugins are started
+	started chan struct{}
+
+	// Set if the plugin states are stored on shutdown
+	persistState bool
+}
+
+// runningUnits are the plugin units of a pipeline of a running agent
+type runningUnits struct {
+	pipeline      string
+	inputs        *inputUnit
+	processors    []*processorUnit
+	aggProcessors []*processorUnit
+	aggregators   *aggregatorUnit
+	outputs       *outputUnit
 }
 
 // NewAgent returns an Agent for the given Config.
 func NewAgent(cfg *config.Config) *Agent {
 	a := &Agent{
-		Config: cfg,
+		Config:  cfg,
+		started: make(chan struct{}),
 	}
 	return a
 }
 
+// Started returns a channel closed once Run started all plugins
+func (a *Agent) Started() <-chan struct{} {
+	return a.started
+}
+
 // inputUnit is a group of input plugins and the shared channel they write to.
 //
 // ┌───────┐
@@ -49,6 +78,16 @@ func NewAgent(cfg *config.Config) *Agent {
 type inputUnit struct {
 	dst    chan<- telegraf.Metric
 	inputs []*models.RunningInput
+
+	// Handles to stop or trigger the gather loop of individual inputs while
+	// running
+	sync.Mutex
+	ctx      context.Context
+	options  []clock.Option
+	wg       sync.WaitGroup
+	stops    map[*models.RunningInput]func()
+	triggers map[*models.RunningInput]chan struct{}
+	closed   bool
 }
 
 //  ______     ┌───────────┐     ______
@@ -59,6 +98,11 @@ type processorUnit struct {
 	src       <-chan telegraf.Metric
 	dst       chan<- telegraf.Metric
 	processor *models.RunningProcessor
+
+	// Protects replacing the processor while running
+	sync.Mutex
+	acc    telegraf.Accumulator
+	closed bool
 }
 
 // aggregatorUnit is a group of Aggregators and their source and sink channels.
@@ -100,6 +144,16 @@ type aggregatorUnit struct {
 type outputUnit struct {
 	src     <-chan telegraf.Metric
 	outputs []*models.RunningOutput
+
+	// Handles to add, remove and flush outputs while running
+	sync.RWMutex
+	ctx     context.Context
+	budget  *models.BandwidthLimiter
+	routes  []*models.RunningOutput
+	wg      sync.WaitGroup
+	stops   map[*models.RunningOutput]func()
+	flushes map[*models.RunningOutput]chan struct{}
+	closed  bool
 }
 
 // Run starts and runs the Agent until the context is done.
@@ -118,6 +172,16 @@ func (a *Agent) Run(ctx context.Context) error {
 		a.Config.Agent.SkipProcessorsAfterAggregators = &skipProcessorsAfterAggregators
 	}
 
+	// Release the outputs if starting fails, e.g. to allow reopening their
+	// disk buffers when falling back to another configuration
+	var running []*runningUnits
+	started := false
+	defer func() {
+		if !started {
+			a.releaseOutputs(running)
+		}
+	}()
+
 	log.Printf("D! [agent] Initializing plugins")
 	if err := a.InitPlugins(); err != nil {
 		return err
@@ -134,79 +198,88 @@ func (a *Agent) Run(ctx context.Context) error {
 			}
 			log.Print("I! [agent] State file does not exist... Skip restoring states...")
 		}
+		a.persistState = true
 	}
 
-	startTime := time.Now()
-
-	log.Printf("D! [agent] Connecting outputs")
-	next, ou, err := a.startOutputs(ctx, a.Config.Outputs)
-	if err != nil {
+	pipelines := a.pipelines()
+	if err := checkPipelines(pipelines, true); err != nil {
 		return err
 	}
 
-	var apu []*processorUnit
-	var au *aggregatorUnit
-	if len(a.Config.Aggregators) != 0 {
-		aggC := next
-		if len(a.Config.AggProcessors) != 0 && !*a.Config.Agent.SkipProcessorsAfterAggregators {
-			aggC, apu, err = a.startProcessors(next, a.Config.AggProcessors)
-			if err != nil {
-				return err
-			}
-		}
+	startTime := time.Now()
 
-		next, au = a.startAggregators(aggC, next, a.Config.Aggregators)
+	// Build the processing chain of every pipeline in output-to-input
+	// direction
+	log.Printf("D! [agent] Connecting outputs")
+	running = make([]*runningUnits, 0, len(pipelines))
+	sources := make([]chan<- telegraf.Metric, 0, len(pipelines))
+	for _, p := range pipelines {
+		next, ou, err := a.startOutputs(ctx, p.outputs)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, next)
+		running = append(running, &runningUnits{pipeline: p.name, outputs: ou})
 	}
 
-	var pu []*processorUnit
-	if len(a.Config.Processors) != 0 {
-		next, pu, err = a.startProcessors(next, a.Config.Processors)
+	for i, p := range pipelines {
+		next, err := a.startChain(sources[i], p, running[i])
 		if err != nil {
 			return err
 		}
+		sources[i] = next
 	}
 
-	iu, err := a.startInputs(next, a.Config.Inputs)
-	if err != nil {
-		return err
+	for i, p := range pipelines {
+		iu, err := a.startInputs(sources[i], p.inputs)
+		if err != nil {
+			return err
+		}
+		running[i].inputs = iu
 	}
 
 	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.runOutputs(ou)
-	}()
-
-	if au != nil {
+	for _, units := range running {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			a.runProcessors(apu)
+			a.runOutputs(ctx, units.outputs)
 		}()
 
+		a.runChain(&wg, startTime, units)
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			a.runAggregators(startTime, au)
+			a.runInputs(ctx, startTime, units.inputs)
 		}()
 	}
 
-	if pu != nil {
-		wg.Add(1)
+	a.Lock()
+	a.running = running
+	a.Unlock()
+	started = true
+	close(a.started)
+	defer func() {
+		a.Lock()
+		a.running = nil
+		a.Unlock()
+	}()
+
+	// Periodically checkpoint the plugin states to not lose them on crashes
+	var checkpointWg sync.WaitGroup
+	checkpointCtx, cancelCheckpoints := context.WithCancel(ctx)
+	if a.Config.Persister != nil && a.Config.Agent.StatefileCheckpointInterval > 0 {
+		checkpointWg.Add(1)
 		go func() {
-			defer wg.Done()
-			a.runProcessors(pu)
+			defer checkpointWg.Done()
+			a.checkpointStates(checkpointCtx, time.Duration(a.Config.Agent.StatefileCheckpointInterval))
 		}()
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.runInputs(ctx, startTime, iu)
-	}()
-
 	wg.Wait()
+	cancelCheckpoints()
+	checkpointWg.Wait()
 
 	if a.Config.Persister != nil {
 		log.Printf("D! [agent] Persisting plugin states")
@@ -216,7 +289,7 @@ func (a *Agent) Run(ctx context.Context) error {
 	}
 
 	log.Printf("D! [agent] Stopped Successfully")
-	return err
+	return nil
 }
 
 // InitPlugins runs the Init function on plugins.
@@ -260,6 +333,25 @@ func (a *Agent) InitPlugins() error {
 	return nil
 }
 
+// checkpointStates stores the plugin states every interval until the context
+// is done.
+func (a *Agent) checkpointStates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			log.Printf("D! [agent] Checkpointing plugin states")
+			if err := a.Config.Persister.Store(); err != nil {
+				log.Printf("E! [agent] Checkpointing plugin states failed: %v", err)
+			}
+		}
+	}
+}
+
 // initPersister initializes the persister and registers the plugins.
 func (a *Agent) initPersister() error {
 	if err := a.Config.Persister.Init(); err != nil {
@@ -280,48 +372,41 @@ func (a *Agent) initPersister() error {
 	}
 
 	for _, processor := range a.Config.Processors {
-		var plugin telegraf.StatefulPlugin
-		if p, ok := processor.Processor.(processors.HasUnwrap); ok {
-			plugin, ok = p.Unwrap().(telegraf.StatefulPlugin)
-			if !ok {
-				continue
-			}
-		} else {
-			plugin, ok = processor.Processor.(telegraf.StatefulPlugin)
-			if !ok {
-				continue
-			}
+		// Register the running processor to synchronize accessing the state
+		// with processing metrics
+		if !processor.IsStateful() {
+			continue
 		}
 
 		name := processor.LogName()
 		id := processor.ID()
-		if err := a.Config.Persister.Register(id, plugin); err != nil {
+		if err := a.Config.Persister.Register(id, processor); err != nil {
 			return fmt.Errorf("could not register processor %s: %w", name, err)
 		}
 	}
 
 	for _, aggregator := range a.Config.Aggregators {
-		plugin, ok := aggregator.Aggregator.(telegraf.StatefulPlugin)
-		if !ok {
+		// Register the running aggregator to also persist the aggregation
+		// window along with the plugin's state
+		if !aggregator.IsStateful() {
 			continue
 		}
 
 		name := aggregator.LogName()
 		id := aggregator.ID()
-		if err := a.Config.Persister.Register(id, plugin); err != nil {
+		if err := a.Config.Persister.Register(id, aggregator); err != nil {
 			return fmt.Errorf("could not register aggregator %s: %w", name, err)
 		}
 	}
 
 	for _, processor := range a.Config.AggProcessors {
-		plugin, ok := processor.Processor.(telegraf.StatefulPlugin)
-		if !ok {
+		if !processor.IsStateful() {
 			continue
 		}
 
 		name := processor.LogName()
 		id := processor.ID()
-		if err := a.Config.Persister.Register(id, plugin); err != nil {
+		if err := a.Config.Persister.Register(id, processor); err != nil {
 			return fmt.Errorf("could not register aggregating processor %s: %w", name, err)
 		}
 	}
@@ -394,60 +479,86 @@ func (*Agent) startInputs(dst chan<- telegraf.Metric, inputs []*models.RunningIn
 // When the context is done the timers are stopped and this function returns
 // after all ongoing Gather calls complete.
 func (a *Agent) runInputs(ctx context.Context, startTime time.Time, unit *inputUnit) {
-	var wg sync.WaitGroup
-	var options []clock.Option
+	unit.Lock()
+	unit.ctx = ctx
+	unit.stops = make(map[*models.RunningInput]func(), len(unit.inputs))
+	unit.triggers = make(map[*models.RunningInput]chan struct{}, len(unit.inputs))
 
 	// Initialize time rounding
 	if a.Config.Agent.RoundInterval {
-		options = append(options, clock.WithAlignment(startTime))
+		unit.options = append(unit.options, clock.WithAlignment(startTime))
 	}
 
-	tickers := make([]*clock.Ticker, 0, len(unit.inputs))
 	for _, input := range unit.inputs {
-		// Overwrite agent interval if this plugin has its own.
-		interval := time.Duration(a.Config.Agent.Interval)
-		if input.Config.Interval != 0 {
-			interval = input.Config.Interval
-		}
+		a.startGatherLoop(unit, input)
+	}
+	empty := len(unit.inputs) == 0
+	unit.Unlock()
 
-		// Overwrite agent precision if this plugin has its own.
-		precision := time.Duration(a.Config.Agent.Precision)
-		if input.Config.Precision != 0 {
-			precision = input.Config.Precision
-		}
+	// Inputs might be added or removed while running, so wait for the
+	// context to be done unless there is nothing to gather at all.
+	if !empty {
+		<-ctx.Done()
+	}
+	unit.Lock()
+	unit.closed = true
+	unit.Unlock()
+	unit.wg.Wait()
 
-		// Overwrite agent collection_jitter if this plugin has its own.
-		jitter := time.Duration(a.Config.Agent.CollectionJitter)
-		if input.Config.CollectionJitterSet {
-			jitter = input.Config.CollectionJitter
-		}
+	log.Printf("D! [agent] Stopping service inputs")
+	stopRunningInputs(unit.inputs)
 
-		// Overwrite agent collection_offset if this plugin has its own.
-		offset := time.Duration(a.Config.Agent.CollectionOffset)
-		if input.Config.CollectionOffset != 0 {
-			offset = input.Config.CollectionOffset
-		}
+	close(unit.dst)
+	log.Printf("D! [agent] Input channel closed")
+}
 
-		ticker := clock.NewTicker(interval, jitter, offset, options...)
-		tickers = append(tickers, ticker)
+// startGatherLoop starts the periodic gather of the given input. The unit
+// must be locked by the caller.
+func (a *Agent) startGatherLoop(unit *inputUnit, input *models.RunningInput) {
+	// Overwrite agent interval if this plugin has its own.
+	interval := time.Duration(a.Config.Agent.Interval)
+	if input.Config.Interval != 0 {
+		interval = input.Config.Interval
+	}
 
-		acc := NewAccumulator(input, unit.dst)
-		acc.SetPrecision(getPrecision(precision, interval))
+	// Overwrite agent precision if this plugin has its own.
+	precision := time.Duration(a.Config.Agent.Precision)
+	if input.Config.Precision != 0 {
+		precision = input.Config.Precision
+	}
 
-		wg.Add(1)
-		go func(input *models.RunningInput) {
-			defer wg.Done()
-			a.gatherLoop(ctx, acc, input, ticker, interval)
-		}(input)
+	// Overwrite agent collection_jitter if this plugin has its own.
+	jitter := time.Duration(a.Config.Agent.CollectionJitter)
+	if input.Config.CollectionJitterSet {
+		jitter = input.Config.CollectionJitter
 	}
-	defer stopTickers(tickers)
-	wg.Wait()
 
-	log.Printf("D! [agent] Stopping service inputs")
-	stopRunningInputs(unit.inputs)
+	// Overwrite agent collection_offset if this plugin has its own.
+	offset := time.Duration(a.Config.Agent.CollectionOffset)
+	if input.Config.CollectionOffset != 0 {
+		offset = input.Config.CollectionOffset
+	}
 
-	close(unit.dst)
-	log.Printf("D! [agent] Input channel closed")
+	ticker := clock.NewTicker(interval, jitter, offset, unit.options...)
+
+	acc := NewAccumulator(input, unit.dst)
+	acc.SetPrecision(getPrecision(precision, interval))
+
+	ctx, cancel := context.WithCancel(unit.ctx)
+	done := make(chan struct{})
+	trigger := make(chan struct{}, 1)
+	unit.wg.Add(1)
+	go func() {
+		defer unit.wg.Done()
+		defer close(done)
+		defer ticker.Stop()
+		a.gatherLoop(ctx, acc, input, ticker, trigger, interval)
+	}()
+	unit.stops[input] = func() {
+		cancel()
+		<-done
+	}
+	unit.triggers[input] = trigger
 }
 
 // testStartInputs is a variation of startInputs for use in --test and --once mode.
@@ -552,6 +663,17 @@ func stopRunningInputs(inputs []*models.RunningInput) {
 	}
 }
 
+// releaseOutputs closes the outputs connected in the given units and releases
+// the buffers of all other outputs if the agent failed to start.
+func (a *Agent) releaseOutputs(running []*runningUnits) {
+	for _, units := range running {
+		stopRunningOutputs(units.outputs.outputs)
+	}
+	for _, output := range a.Config.Outputs {
+		output.Discard()
+	}
+}
+
 // stopRunningOutputs stops all running outputs.
 func stopRunningOutputs(outputs []*models.RunningOutput) {
 	for _, output := range outputs {
@@ -559,13 +681,14 @@ func stopRunningOutputs(outputs []*models.RunningOutput) {
 	}
 }
 
-// gather runs an input's gather function periodically until the context is
-// done.
+// gather runs an input's gather function periodically and on request until
+// the context is done.
 func (a *Agent) gatherLoop(
 	ctx context.Context,
 	acc telegraf.Accumulator,
 	input *models.RunningInput,
 	ticker *clock.Ticker,
+	trigger <-chan struct{},
 	interval time.Duration,
 ) {
 	for {
@@ -575,6 +698,11 @@ func (a *Agent) gatherLoop(
 			if err != nil {
 				acc.AddError(err)
 			}
+		case <-trigger:
+			err := a.gatherOnce(acc, input, ticker, interval)
+			if err != nil {
+				acc.AddError(err)
+			}
 		case <-ctx.Done():
 			return
 		}
@@ -654,14 +782,21 @@ func (*Agent) runProcessors(units []*processorUnit) {
 		go func(unit *processorUnit) {
 			defer wg.Done()
 
-			acc := NewAccumulator(unit.processor, unit.dst)
+			unit.Lock()
+			unit.acc = NewAccumulator(unit.processor, unit.dst)
+			unit.Unlock()
 			for m := range unit.src {
-				if err := unit.processor.Add(m, acc); err != nil {
-					acc.AddError(err)
+				unit.Lock()
+				if err := unit.processor.Add(m, unit.acc); err != nil {
+					unit.acc.AddError(err)
 					m.Drop()
 				}
+				unit.Unlock()
 			}
+			unit.Lock()
 			unit.processor.Stop()
+			unit.closed = true
+			unit.Unlock()
 			close(unit.dst)
 			log.Printf("D! [agent] Processor channel closed")
 		}(unit)
@@ -691,8 +826,13 @@ func (a *Agent) runAggregators(
 
 	// Before calling Add, initialize the aggregation window.  This ensures
 	// that any metric created after start time will be aggregated.
-	for _, agg := range a.Config.Aggregators {
-		since, until := updateWindow(startTime, a.Config.Agent.RoundInterval, agg.Period())
+	// Aggregators restored from a persisted state continue with their
+	// previous window; if that window already elapsed it is pushed right away.
+	for _, agg := range unit.aggregators {
+		since, until, restored := agg.RestoredWindow()
+		if !restored {
+			since, until = updateWindow(startTime, a.Config.Agent.RoundInterval, agg.Period())
+		}
 		agg.UpdateWindow(since, until)
 	}
 
@@ -702,7 +842,7 @@ func (a *Agent) runAggregators(
 		defer wg.Done()
 		for metric := range unit.src {
 			var dropOriginal bool
-			for _, agg := range a.Config.Aggregators {
+			for _, agg := range unit.aggregators {
 				if ok := agg.Add(metric); ok {
 					dropOriginal = true
 				}
@@ -717,7 +857,7 @@ func (a *Agent) runAggregators(
 		cancel()
 	}()
 
-	for _, agg := range a.Config.Aggregators {
+	for _, agg := range unit.aggregators {
 		wg.Add(1)
 		go func(agg *models.RunningAggregator) {
 			defer wg.Done()
@@ -755,8 +895,10 @@ func updateWindow(start time.Time, roundInterval bool, period time.Duration) (si
 	return since, until
 }
 
-// push runs the push for a single aggregator every period.
-func (*Agent) push(ctx context.Context, aggregator *models.RunningAggregator, acc telegraf.Accumulator) {
+// push runs the push for a single aggregator every period. On shutdown the
+// partial period of stateful aggregators is not pushed if the state is
+// persisted, so aggregation continues after restarting.
+func (a *Agent) push(ctx context.Context, aggregator *models.RunningAggregator, acc telegraf.Accumulator) {
 	for {
 		// Ensures that Push will be called for each period, even if it has
 		// already elapsed before this function is called.  This is guaranteed
@@ -768,7 +910,9 @@ func (*Agent) push(ctx context.Context, aggregator *models.RunningAggregator, ac
 		case <-time.After(until):
 			aggregator.Push(acc)
 		case <-ctx.Done():
-			aggregator.Push(acc)
+			if !a.persistState || !aggregator.IsStateful() {
+				aggregator.Push(acc)
+			}
 			return
 		}
 	}
@@ -826,43 +970,48 @@ func (*Agent) connectOutput(ctx context.Context, output *models.RunningOutput) e
 // closed and all metrics have been written.  On shutdown metrics will be
 // written one last time and dropped if unsuccessful.
 func (a *Agent) runOutputs(
+	ctx context.Context,
 	unit *outputUnit,
 ) {
-	var wg sync.WaitGroup
+	outputCtx, cancel := context.WithCancel(context.Background())
 
-	// Start flush loop
-	interval := time.Duration(a.Config.Agent.FlushInterval)
-	jitter := time.Duration(a.Config.Agent.FlushJitter)
+	unit.Lock()
+	unit.ctx = outputCtx
+	unit.stops = make(map[*models.RunningOutput]func(), len(unit.outputs))
+	unit.flushes = make(map[*models.RunningOutput]chan struct{}, len(unit.outputs))
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// Share the bandwidth budget across all outputs if requested
+	if limit := int64(a.Config.Agent.BandwidthLimit); limit > 0 {
+		unit.budget = models.NewBandwidthLimiter(limit)
+	}
 
 	for _, output := range unit.outputs {
-		interval := interval
-		// Overwrite agent flush_interval if this plugin has its own.
-		if output.Config.FlushInterval != 0 {
-			interval = output.Config.FlushInterval
-		}
-
-		jitter := jitter
-		// Overwrite agent flush_jitter if this plugin has its own.
-		if output.Config.FlushJitter != 0 {
-			jitter = output.Config.FlushJitter
+		a.startFlushLoop(unit, output)
+	}
+	unit.updateRoutes()
+	unit.Unlock()
+
+	// Stop blocking on full buffers when shutting down as the outputs might
+	// not be able to free up space anymore, e.g. if the service is down
+	stopUnblock := context.AfterFunc(ctx, func() {
+		unit.RLock()
+		defer unit.RUnlock()
+		for _, output := range unit.outputs {
+			output.Unblock()
 		}
-
-		wg.Add(1)
-		go func(output *models.RunningOutput) {
-			defer wg.Done()
-
-			timer := clock.NewTimer(interval, jitter)
-			defer timer.Stop()
-
-			a.flushLoop(ctx, output, timer)
-		}(output)
-	}
+	})
+	defer stopUnblock()
 
 	for metric := range unit.src {
-		for i, output := range unit.outputs {
-			if i == len(unit.outputs)-1 {
+		// Adding metrics might block if the buffer is full, so do not hold
+		// the lock to not block reloading or querying the outputs. The routes
+		// are replaced, not modified, when updated.
+		unit.RLock()
+		routes := unit.routes
+		unit.RUnlock()
+
+		for i, output := range routes {
+			if i == len(routes)-1 {
 				output.AddMetricNoCopy(metric)
 			} else {
 				output.AddMetric(metric)
@@ -871,18 +1020,74 @@ func (a *Agent) runOutputs(
 	}
 
 	log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
+	unit.Lock()
+	unit.closed = true
+	unit.Unlock()
 	cancel()
-	wg.Wait()
+	unit.wg.Wait()
 
 	log.Println("I! [agent] Stopping running outputs")
 	stopRunningOutputs(unit.outputs)
 }
 
-// flushLoop runs an output's flush function periodically until the context is
-// done.
-func (a *Agent) flushLoop(ctx context.Context, output *models.RunningOutput, timer *clock.Timer) {
+// startFlushLoop starts flushing the given output periodically. The unit must
+// be locked by the caller.
+func (a *Agent) startFlushLoop(unit *outputUnit, output *models.RunningOutput) {
+	if unit.budget != nil {
+		output.SetBandwidthBudget(unit.budget)
+	}
+
+	// Overwrite agent flush_interval if this plugin has its own.
+	interval := time.Duration(a.Config.Agent.FlushInterval)
+	if output.Config.FlushInterval != 0 {
+		interval = output.Config.FlushInterval
+	}
+
+	// Overwrite agent flush_jitter if this plugin has its own.
+	jitter := time.Duration(a.Config.Agent.FlushJitter)
+	if output.Config.FlushJitter != 0 {
+		jitter = output.Config.FlushJitter
+	}
+
+	ctx, cancel := context.WithCancel(unit.ctx)
+	done := make(chan struct{})
+	flush := make(chan struct{}, 1)
+	unit.wg.Add(1)
+	go func() {
+		defer unit.wg.Done()
+		defer close(done)
+
+		timer := clock.NewTimer(interval, jitter)
+		defer timer.Stop()
+
+		a.flushLoop(ctx, output, timer, flush)
+	}()
+	unit.stops[output] = func() {
+		cancel()
+		<-done
+	}
+	unit.flushes[output] = flush
+}
+
+// updateRoutes updates the outputs receiving metrics. Dead-letter outputs
+// only receive the metrics rejected by other outputs. The unit must be locked
+// by the caller.
+func (unit *outputUnit) updateRoutes() {
+	unit.routes = make([]*models.RunningOutput, 0, len(unit.outputs))
+	for _, output := range unit.outputs {
+		if !output.IsDeadLetterOutput() {
+			unit.routes = append(unit.routes, output)
+		}
+	}
+}
+
+// flushLoop runs an output's flush function periodically and on request until
+// the context is done.
+func (a *Agent) flushLoop(ctx context.Context, output *models.RunningOutput, timer *clock.Timer, flush <-chan struct{}) {
 	logError := func(err error) {
-		if err != nil {
+		if errors.Is(err, models.ErrBackoff) {
+			log.Printf("D! [agent] Skipped writing to %s: %v", output.LogName(), err)
+		} else if err != nil {
 			log.Printf("E! [agent] Error writing to %s: %v", output.LogName(), err)
 		}
 	}
@@ -896,19 +1101,21 @@ func (a *Agent) flushLoop(ctx context.Context, output *models.RunningOutput, tim
 		// Favor shutdown over other methods.
 		select {
 		case <-ctx.Done():
-			logError(a.flushOnce(output, timer, output.Write))
+			logError(a.flushOnce(output, timer, output.WriteFinal))
 			return
 		default:
 		}
 
 		select {
 		case <-ctx.Done():
-			logError(a.flushOnce(output, timer, output.Write))
+			logError(a.flushOnce(output, timer, output.WriteFinal))
 			return
 		case <-timer.C:
 			logError(a.flushOnce(output, timer, output.Write))
 		case <-flushRequested:
 			logError(a.flushOnce(output, timer, output.Write))
+		case <-flush:
+			logError(a.flushOnce(output, timer, output.Write))
 		case <-output.BatchReady:
 			logError(a.flushBatch(output, output.WriteBatch))
 		}
@@ -974,6 +1181,62 @@ func (a *Agent) Test(ctx context.Context, wait time.Duration) error {
 	return nil
 }
 
+// Trace runs the inputs, processors and aggregators for a single gather and
+// prints the journey of every n-th metric through the plugins. The outputs
+// only apply their filters and settings to the traced metrics without writing
+// any metric.
+func (a *Agent) Trace(ctx context.Context, wait time.Duration, every uint64) error {
+	tracer := models.NewTracer(every)
+	for _, input := range a.Config.Inputs {
+		input.SetTracer(tracer)
+	}
+	for _, processor := range a.Config.Processors {
+		processor.SetTracer(tracer)
+	}
+	for _, aggregator := range a.Config.Aggregators {
+		aggregator.SetTracer(tracer)
+	}
+	for _, processor := range a.Config.AggProcessors {
+		processor.SetTracer(tracer)
+	}
+	for _, output := range a.Config.Outputs {
+		output.SetTracer(tracer)
+	}
+
+	src := make(chan telegraf.Metric, 100)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for metric := range src {
+			for _, output := range a.Config.Outputs {
+				if !output.IsDeadLetterOutput() {
+					output.TraceMetric(metric)
+				}
+			}
+			tracer.End(metric)
+			metric.Reject()
+		}
+	}()
+
+	err := a.runTest(ctx, wait, src)
+	if err != nil {
+		return err
+	}
+
+	wg.Wait()
+
+	if err := tracer.Print(os.Stdout); err != nil {
+		return err
+	}
+
+	if models.GlobalGatherErrors.Get() != 0 {
+		return fmt.Errorf("input plugins recorded %d errors", models.GlobalGatherErrors.Get())
+	}
+	return nil
+}
+
 // runTest runs the agent and performs a single gather sending output to the
 // outputC. After gathering pauses for the wait duration to allow service
 // inputs to run.
@@ -992,66 +1255,61 @@ func (a *Agent) runTest(ctx context.Context, wait time.Duration, outputC chan<-
 		return err
 	}
 
-	startTime := time.Now()
+	pipelines := a.pipelines()
+	if err := checkPipelines(pipelines, false); err != nil {
+		return err
+	}
 
-	next := outputC
+	startTime := time.Now()
 
-	var apu []*processorUnit
-	var au *aggregatorUnit
-	if len(a.Config.Aggregators) != 0 {
-		procC := next
-		if len(a.Config.AggProcessors) != 0 && !*a.Config.Agent.SkipProcessorsAfterAggregators {
-			var err error
-			procC, apu, err = a.startProcessors(next, a.Config.AggProcessors)
-			if err != nil {
-				return err
-			}
+	// Every pipeline writes to its own channel to be able to close the
+	// channels independently, so merge the pipelines into the output channel.
+	var mergeWg sync.WaitGroup
+	running := make([]*runningUnits, 0, len(pipelines))
+	sources := make([]chan<- telegraf.Metric, 0, len(pipelines))
+	for _, p := range pipelines {
+		next := outputC
+		if len(pipelines) > 1 {
+			dst := make(chan telegraf.Metric, 100)
+			mergeWg.Add(1)
+			go func() {
+				defer mergeWg.Done()
+				for m := range dst {
+					outputC <- m
+				}
+			}()
+			next = dst
 		}
 
-		next, au = a.startAggregators(procC, next, a.Config.Aggregators)
-	}
-
-	var pu []*processorUnit
-	if len(a.Config.Processors) != 0 {
-		var err error
-		next, pu, err = a.startProcessors(next, a.Config.Processors)
+		units := &runningUnits{pipeline: p.name}
+		next, err := a.startChain(next, p, units)
 		if err != nil {
 			return err
 		}
+		sources = append(sources, next)
+		running = append(running, units)
 	}
 
-	iu := a.testStartInputs(next, a.Config.Inputs)
+	for i, p := range pipelines {
+		running[i].inputs = a.testStartInputs(sources[i], p.inputs)
+	}
 
 	var wg sync.WaitGroup
-	if au != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			a.runProcessors(apu)
-		}()
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			a.runAggregators(startTime, au)
-		}()
-	}
+	for _, units := range running {
+		a.runChain(&wg, startTime, units)
 
-	if pu != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			a.runProcessors(pu)
+			a.testRunInputs(ctx, wait, units.inputs)
 		}()
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.testRunInputs(ctx, wait, iu)
-	}()
-
 	wg.Wait()
+	if len(pipelines) > 1 {
+		mergeWg.Wait()
+		close(outputC)
+	}
 
 	log.Printf("D! [agent] Stopped Successfully")
 
@@ -1097,73 +1355,50 @@ func (a *Agent) runOnce(ctx context.Context, wait time.Duration) error {
 		return err
 	}
 
-	startTime := time.Now()
-
-	log.Printf("D! [agent] Connecting outputs")
-	next, ou, err := a.startOutputs(ctx, a.Config.Outputs)
-	if err != nil {
+	pipelines := a.pipelines()
+	if err := checkPipelines(pipelines, true); err != nil {
 		return err
 	}
 
-	var apu []*processorUnit
-	var au *aggregatorUnit
-	if len(a.Config.Aggregators) != 0 {
-		procC := next
-		if len(a.Config.AggProcessors) != 0 && !*a.Config.Agent.SkipProcessorsAfterAggregators {
-			procC, apu, err = a.startProcessors(next, a.Config.AggProcessors)
-			if err != nil {
-				return err
-			}
-		}
+	startTime := time.Now()
 
-		next, au = a.startAggregators(procC, next, a.Config.Aggregators)
+	log.Printf("D! [agent] Connecting outputs")
+	running := make([]*runningUnits, 0, len(pipelines))
+	sources := make([]chan<- telegraf.Metric, 0, len(pipelines))
+	for _, p := range pipelines {
+		next, ou, err := a.startOutputs(ctx, p.outputs)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, next)
+		running = append(running, &runningUnits{pipeline: p.name, outputs: ou})
 	}
 
-	var pu []*processorUnit
-	if len(a.Config.Processors) != 0 {
-		next, pu, err = a.startProcessors(next, a.Config.Processors)
+	for i, p := range pipelines {
+		next, err := a.startChain(sources[i], p, running[i])
 		if err != nil {
 			return err
 		}
+		running[i].inputs = a.testStartInputs(next, p.inputs)
 	}
 
-	iu := a.testStartInputs(next, a.Config.Inputs)
-
 	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.runOutputs(ou)
-	}()
-
-	if au != nil {
+	for _, units := range running {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			a.runProcessors(apu)
+			a.runOutputs(ctx, units.outputs)
 		}()
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			a.runAggregators(startTime, au)
-		}()
-	}
+		a.runChain(&wg, startTime, units)
 
-	if pu != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			a.runProcessors(pu)
+			a.testRunInputs(ctx, wait, units.inputs)
 		}()
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.testRunInputs(ctx, wait, iu)
-	}()
-
 	wg.Wait()
 
 	log.Printf("D! [agent] Stopped Successfully")
@@ -1202,9 +1437,3 @@ func panicRecover(input *models.RunningInput) {
 			"https://github.com/influxdata/telegraf/issues/new/choose")
 	}
 }
-
-func stopTickers(tickers []*clock.Ticker) {
-	for _, ticker := range tickers {
-		ticker.Stop()
-	}
-}
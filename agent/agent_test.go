@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/models"
 	_ "github.com/influxdata/telegraf/plugins/aggregators/all"
 	_ "github.com/influxdata/telegraf/plugins/inputs/all"
@@ -118,6 +120,115 @@ func TestAgent_LoadOutput(t *testing.T) {
 	require.Len(t, a.Config.Outputs, 3)
 }
 
+func TestAgent_ShutdownBlockedBuffer(t *testing.T) {
+	tests := []struct {
+		strategy string
+		limit    int
+	}{
+		{strategy: "disk_write_through"},
+		// Use a small memory part to spill most metrics to disk
+		{strategy: "memory_spill", limit: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			c := config.NewConfig()
+			c.Agent.Interval = config.Duration(time.Hour)
+			c.Agent.FlushInterval = config.Duration(time.Hour)
+			c.Agent.RoundInterval = false
+
+			input := &floodInput{count: 100}
+			c.Inputs = append(c.Inputs, models.NewRunningInput(input, &models.InputConfig{Name: "flood", ID: "flood-input"}))
+
+			// Use a failing output with a disk buffer blocking the inputs as
+			// soon as it is full
+			ro, err := models.NewRunningOutput(&failingOutput{}, &models.OutputConfig{
+				Name:                     "failing",
+				ID:                       "failing-output",
+				BufferStrategy:           tt.strategy,
+				BufferDirectory:          t.TempDir(),
+				BufferDiskMaxSize:        1024,
+				BufferDiskOverflowPolicy: "block_inputs",
+			}, 0, tt.limit)
+			require.NoError(t, err)
+			c.Outputs = append(c.Outputs, ro)
+
+			a := NewAgent(c)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				done <- a.Run(ctx)
+			}()
+
+			// Wait for the buffer to fill up and the output to write
+			// unsuccessfully
+			require.Eventually(t, func() bool {
+				return ro.BufferLength() > 0 && ro.BufferLength() < input.count
+			}, 5*time.Second, 10*time.Millisecond)
+			require.NoError(t, a.FlushOutputs(""))
+			require.Never(t, func() bool {
+				return ro.BufferLength() == input.count
+			}, 100*time.Millisecond, 10*time.Millisecond)
+
+			// Stopping the agent must not wait for the buffer space forever
+			cancel()
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+			case <-time.After(10 * time.Second):
+				require.Fail(t, "agent did not stop")
+			}
+		})
+	}
+}
+
+func TestAgent_RunFailureClosesOutputs(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = config.Duration(time.Hour)
+	c.Agent.FlushInterval = config.Duration(time.Hour)
+	c.Inputs = append(c.Inputs, models.NewRunningInput(&startingInput{err: errors.New("failed")}, &models.InputConfig{Name: "starting"}))
+	output := &countingOutput{}
+	ro, err := models.NewRunningOutput(output, &models.OutputConfig{Name: "counting"}, 0, 0)
+	require.NoError(t, err)
+	c.Outputs = append(c.Outputs, ro)
+
+	// Outputs connected before the failure must be closed
+	a := NewAgent(c)
+	require.ErrorContains(t, a.Run(t.Context()), "starting input")
+	require.True(t, output.closed.Load())
+}
+
+func TestAgent_OnceStatefileAggregators(t *testing.T) {
+	cfg := `
+[agent]
+  omit_hostname = true
+  statefile = "` + filepath.ToSlash(filepath.Join(t.TempDir(), "state.json")) + `"
+
+[[aggregators.basicstats]]
+  period = "1h"
+  drop_original = true
+  stats = ["count"]
+`
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfigData([]byte(cfg), config.EmptySourcePath))
+	c.Inputs = append(c.Inputs, models.NewRunningInput(&countingInput{}, &models.InputConfig{Name: "counting", ID: "counting-input"}))
+	output := &collectingOutput{}
+	ro, err := models.NewRunningOutput(output, &models.OutputConfig{Name: "collecting", ID: "collecting-output"}, 0, 0)
+	require.NoError(t, err)
+	c.Outputs = append(c.Outputs, ro)
+
+	// The state is not stored in "once" mode, so the partial period of the
+	// stateful aggregator must be pushed
+	a := NewAgent(c)
+	require.NoError(t, a.Once(t.Context(), 0))
+
+	expected := []telegraf.Metric{
+		metric.New("counting", map[string]string{}, map[string]interface{}{"value_count": float64(1)}, time.Unix(0, 0)),
+	}
+	testutil.RequireMetricsEqual(t, expected, output.metrics, testutil.IgnoreTime())
+}
+
 func TestWindow(t *testing.T) {
 	parse := func(s string) time.Time {
 		tm, err := time.Parse(time.RFC3339, s)
@@ -228,6 +339,60 @@ func TestCases(t *testing.T) {
 	}
 }
 
+type floodInput struct {
+	count int
+}
+
+func (*floodInput) SampleConfig() string {
+	return ""
+}
+
+func (i *floodInput) Gather(acc telegraf.Accumulator) error {
+	for n := range i.count {
+		acc.AddFields("flood", map[string]interface{}{"value": n}, nil)
+	}
+	return nil
+}
+
+type failingOutput struct{}
+
+func (*failingOutput) SampleConfig() string {
+	return ""
+}
+
+func (*failingOutput) Connect() error {
+	return nil
+}
+
+func (*failingOutput) Close() error {
+	return nil
+}
+
+func (*failingOutput) Write([]telegraf.Metric) error {
+	return errors.New("service unavailable")
+}
+
+type collectingOutput struct {
+	metrics []telegraf.Metric
+}
+
+func (*collectingOutput) SampleConfig() string {
+	return ""
+}
+
+func (*collectingOutput) Connect() error {
+	return nil
+}
+
+func (*collectingOutput) Close() error {
+	return nil
+}
+
+func (o *collectingOutput) Write(metrics []telegraf.Metric) error {
+	o.metrics = append(o.metrics, metrics...)
+	return nil
+}
+
 // Implement a "test-mode" like call but collect the metrics
 func collect(ctx context.Context, a *Agent, wait time.Duration) ([]telegraf.Metric, error) {
 	var received []telegraf.Metric
@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/influxdata/telegraf/models"
+)
+
+var (
+	// ErrNotRunning is returned when controlling an agent that is not running.
+	ErrNotRunning = errors.New("agent is not running")
+	// ErrPluginNotFound is returned when controlling a plugin that is not
+	// running.
+	ErrPluginNotFound = errors.New("plugin not found")
+)
+
+// PluginStatus describes a plugin of the running agent
+type PluginStatus struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Alias    string `json:"alias,omitempty"`
+	Pipeline string `json:"pipeline,omitempty"`
+	Status   string `json:"status"`
+
+	// Only set for outputs
+	Buffer    *BufferStatus `json:"buffer,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// BufferStatus describes the fill level of an output buffer
+type BufferStatus struct {
+	Length int `json:"length"`
+	Limit  int `json:"limit"`
+}
+
+// Status returns the status of all plugins of the running agent per pipeline
+// in processing order, i.e. inputs, processors, aggregators, processors after
+// aggregators and outputs. Nil is returned if the agent is not running.
+func (a *Agent) Status() []PluginStatus {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.running == nil {
+		return nil
+	}
+
+	status := make([]PluginStatus, 0,
+		len(a.Config.Inputs)+len(a.Config.Processors)+len(a.Config.Aggregators)+len(a.Config.AggProcessors)+len(a.Config.Outputs))
+	for _, p := range a.pipelines() {
+		for _, units := range a.running {
+			if units.pipeline == p.name {
+				status = append(status, a.pipelineStatus(p, units)...)
+			}
+		}
+	}
+	return status
+}
+
+func (a *Agent) pipelineStatus(p *pipeline, units *runningUnits) []PluginStatus {
+	var status []PluginStatus
+
+	inputs := units.inputs
+	inputs.Lock()
+	for _, input := range p.inputs {
+		state := "stopped"
+		if _, found := inputs.stops[input]; found {
+			state = "running"
+		}
+		status = append(status, PluginStatus{
+			ID:       input.ID(),
+			Type:     "input",
+			Name:     input.Config.Name,
+			Alias:    input.Config.Alias,
+			Pipeline: p.name,
+			Status:   state,
+		})
+	}
+	inputs.Unlock()
+
+	processorStatus := func(processor *models.RunningProcessor) PluginStatus {
+		return PluginStatus{
+			ID:       processor.ID(),
+			Type:     "processor",
+			Name:     processor.Config.Name,
+			Alias:    processor.Config.Alias,
+			Pipeline: p.name,
+			Status:   "running",
+		}
+	}
+	for _, processor := range p.processors {
+		status = append(status, processorStatus(processor))
+	}
+	for _, aggregator := range p.aggregators {
+		status = append(status, PluginStatus{
+			ID:       aggregator.ID(),
+			Type:     "aggregator",
+			Name:     aggregator.Config.Name,
+			Alias:    aggregator.Config.Alias,
+			Pipeline: p.name,
+			Status:   "running",
+		})
+	}
+	if !*a.Config.Agent.SkipProcessorsAfterAggregators {
+		for _, processor := range p.aggProcessors {
+			status = append(status, processorStatus(processor))
+		}
+	}
+
+	outputs := units.outputs
+	outputs.RLock()
+	for _, output := range p.outputs {
+		s := PluginStatus{
+			ID:       output.ID(),
+			Type:     "output",
+			Name:     output.Config.Name,
+			Alias:    output.Config.Alias,
+			Pipeline: p.name,
+			Status:   "stopped",
+			Buffer: &BufferStatus{
+				Length: output.BufferLength(),
+				Limit:  output.MetricBufferLimit,
+			},
+		}
+		if _, found := outputs.stops[output]; found {
+			s.Status = "running"
+			if output.Paused() {
+				s.Status = "paused"
+			}
+		}
+		if err := output.LastError(); err != nil {
+			s.LastError = err.Error()
+		}
+		status = append(status, s)
+	}
+	outputs.RUnlock()
+
+	return status
+}
+
+// GatherInput triggers an immediate gather of the inputs with the given ID
+// in addition to the periodic gather.
+func (a *Agent) GatherInput(id string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.running == nil {
+		return ErrNotRunning
+	}
+
+	var found bool
+	for _, units := range a.running {
+		unit := units.inputs
+		unit.Lock()
+		for input, trigger := range unit.triggers {
+			if input.ID() != id {
+				continue
+			}
+			found = true
+
+			// A pending trigger already covers this request
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+		unit.Unlock()
+	}
+	if !found {
+		return fmt.Errorf("%w: input %q", ErrPluginNotFound, id)
+	}
+	return nil
+}
+
+// FlushOutputs triggers an immediate flush of the outputs with the given ID or
+// of all outputs if the ID is empty.
+func (a *Agent) FlushOutputs(id string) error {
+	return a.controlOutputs(id, func(_ *models.RunningOutput, flush chan struct{}) {
+		select {
+		case flush <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// PauseOutput stops writing to the outputs with the given ID. Metrics are
+// buffered until the output is resumed.
+func (a *Agent) PauseOutput(id string) error {
+	if id == "" {
+		return errors.New("no output ID given")
+	}
+	return a.controlOutputs(id, func(output *models.RunningOutput, _ chan struct{}) {
+		output.Pause()
+	})
+}
+
+// ResumeOutput continues writing to the paused outputs with the given ID.
+func (a *Agent) ResumeOutput(id string) error {
+	if id == "" {
+		return errors.New("no output ID given")
+	}
+	return a.controlOutputs(id, func(output *models.RunningOutput, _ chan struct{}) {
+		output.Resume()
+	})
+}
+
+// controlOutputs calls the given function for all running outputs with the
+// given ID or for all running outputs if the ID is empty.
+func (a *Agent) controlOutputs(id string, fn func(*models.RunningOutput, chan struct{})) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.running == nil {
+		return ErrNotRunning
+	}
+
+	var found bool
+	for _, units := range a.running {
+		unit := units.outputs
+		unit.RLock()
+		for output, flush := range unit.flushes {
+			if id != "" && output.ID() != id {
+				continue
+			}
+			found = true
+			fn(output, flush)
+		}
+		unit.RUnlock()
+	}
+	if !found && id != "" {
+		return fmt.Errorf("%w: output %q", ErrPluginNotFound, id)
+	}
+	return nil
+}
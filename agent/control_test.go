@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/models"
+)
+
+func TestControl(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = config.Duration(time.Hour)
+	c.Agent.FlushInterval = config.Duration(time.Hour)
+	c.Agent.RoundInterval = false
+
+	input := &countingInput{}
+	c.Inputs = append(c.Inputs, models.NewRunningInput(input, &models.InputConfig{Name: "counting", ID: "control-input"}))
+	output := &countingOutput{}
+	ro, err := models.NewRunningOutput(output, &models.OutputConfig{Name: "counting", ID: "control-output"}, 0, 0)
+	require.NoError(t, err)
+	c.Outputs = append(c.Outputs, ro)
+
+	a := NewAgent(c)
+	require.Nil(t, a.Status())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return a.Status() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The input is gathered once on startup
+	require.Eventually(t, func() bool {
+		return ro.BufferLength() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := a.Status()
+	require.Len(t, status, 2)
+	require.Equal(t, PluginStatus{ID: "control-input", Type: "input", Name: "counting", Status: "running"}, status[0])
+	require.Equal(t, "output", status[1].Type)
+	require.Equal(t, "running", status[1].Status)
+	require.Equal(t, &BufferStatus{Length: 1, Limit: models.DefaultMetricBufferLimit}, status[1].Buffer)
+
+	// Gather metrics into the buffer of the paused output
+	require.NoError(t, a.PauseOutput("control-output"))
+	require.Equal(t, "paused", a.Status()[1].Status)
+	require.NoError(t, a.GatherInput("control-input"))
+	require.Eventually(t, func() bool {
+		return ro.BufferLength() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, a.FlushOutputs(""))
+	require.Never(t, func() bool {
+		return output.writes.Load() > 0
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	// Resuming the output allows to flush the buffer
+	require.NoError(t, a.ResumeOutput("control-output"))
+	require.NoError(t, a.FlushOutputs("control-output"))
+	require.Eventually(t, func() bool {
+		return output.writes.Load() == 1 && ro.BufferLength() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.ErrorIs(t, a.GatherInput("unknown"), ErrPluginNotFound)
+	require.ErrorIs(t, a.FlushOutputs("unknown"), ErrPluginNotFound)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+type countingInput struct{}
+
+func (*countingInput) SampleConfig() string {
+	return ""
+}
+
+func (*countingInput) Gather(acc telegraf.Accumulator) error {
+	acc.AddFields("counting", map[string]interface{}{"value": 1}, nil)
+	return nil
+}
+
+type countingOutput struct {
+	writes atomic.Int64
+	closed atomic.Bool
+}
+
+func (*countingOutput) SampleConfig() string {
+	return ""
+}
+
+func (*countingOutput) Connect() error {
+	return nil
+}
+
+func (o *countingOutput) Close() error {
+	o.closed.Store(true)
+	return nil
+}
+
+func (o *countingOutput) Write([]telegraf.Metric) error {
+	o.writes.Add(1)
+	return nil
+}
@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/models"
+)
+
+// pipeline is a group of plugins forming an independent processing chain.
+// Plugins without a pipeline setting belong to the default pipeline.
+type pipeline struct {
+	name          string
+	inputs        []*models.RunningInput
+	processors    models.RunningProcessors
+	aggregators   []*models.RunningAggregator
+	aggProcessors models.RunningProcessors
+	outputs       []*models.RunningOutput
+}
+
+func (p *pipeline) String() string {
+	if p.name == "" {
+		return "default pipeline"
+	}
+	return fmt.Sprintf("pipeline %q", p.name)
+}
+
+func (p *pipeline) empty() bool {
+	return len(p.inputs)+len(p.processors)+len(p.aggregators)+len(p.aggProcessors)+len(p.outputs) == 0
+}
+
+// usesPipelines returns true if any plugin of the configuration is assigned
+// to a named pipeline.
+func usesPipelines(cfg *config.Config) bool {
+	for _, input := range cfg.Inputs {
+		if input.Config.Pipeline != "" {
+			return true
+		}
+	}
+	for _, processor := range cfg.Processors {
+		if processor.Config.Pipeline != "" {
+			return true
+		}
+	}
+	for _, aggregator := range cfg.Aggregators {
+		if aggregator.Config.Pipeline != "" {
+			return true
+		}
+	}
+	for _, output := range cfg.Outputs {
+		if output.Config.Pipeline != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pipelines groups the plugins of the configuration by their pipeline. The
+// default pipeline comes first followed by the named pipelines in alphabetical
+// order. The default pipeline is omitted if it is empty and named pipelines
+// exist. The plugins keep their order within the pipelines.
+func (a *Agent) pipelines() []*pipeline {
+	byName := map[string]*pipeline{"": {}}
+	get := func(name string) *pipeline {
+		p, found := byName[name]
+		if !found {
+			p = &pipeline{name: name}
+			byName[name] = p
+		}
+		return p
+	}
+
+	for _, input := range a.Config.Inputs {
+		p := get(input.Config.Pipeline)
+		p.inputs = append(p.inputs, input)
+	}
+	for _, processor := range a.Config.Processors {
+		p := get(processor.Config.Pipeline)
+		p.processors = append(p.processors, processor)
+	}
+	for _, aggregator := range a.Config.Aggregators {
+		p := get(aggregator.Config.Pipeline)
+		p.aggregators = append(p.aggregators, aggregator)
+	}
+	for _, processor := range a.Config.AggProcessors {
+		p := get(processor.Config.Pipeline)
+		p.aggProcessors = append(p.aggProcessors, processor)
+	}
+	for _, output := range a.Config.Outputs {
+		p := get(output.Config.Pipeline)
+		p.outputs = append(p.outputs, output)
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pipelines := make([]*pipeline, 0, len(names))
+	for _, name := range names {
+		p := byName[name]
+		if name == "" && p.empty() && len(names) > 1 {
+			continue
+		}
+		pipelines = append(pipelines, p)
+	}
+	return pipelines
+}
+
+// checkPipelines makes sure that metrics of every pipeline have a source and,
+// if outputs are required, a destination. Configurations without named
+// pipelines are not checked to keep the behavior of the default pipeline.
+func checkPipelines(pipelines []*pipeline, requireOutputs bool) error {
+	if len(pipelines) == 1 && pipelines[0].name == "" {
+		return nil
+	}
+
+	var errs []error
+	for _, p := range pipelines {
+		if len(p.inputs) == 0 {
+			errs = append(errs, fmt.Errorf("%s has no inputs", p))
+		}
+		if requireOutputs && len(p.outputs) == 0 {
+			errs = append(errs, fmt.Errorf("%s has no outputs", p))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startChain starts the aggregators and processors of the pipeline writing to
+// the given channel and stores them in the given units. The returned channel
+// is the source of the chain the inputs should write to.
+func (a *Agent) startChain(next chan<- telegraf.Metric, p *pipeline, units *runningUnits) (chan<- telegraf.Metric, error) {
+	if len(p.aggregators) != 0 {
+		aggC := next
+		if len(p.aggProcessors) != 0 && !*a.Config.Agent.SkipProcessorsAfterAggregators {
+			var err error
+			aggC, units.aggProcessors, err = a.startProcessors(next, p.aggProcessors)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		next, units.aggregators = a.startAggregators(aggC, next, p.aggregators)
+	}
+
+	if len(p.processors) != 0 {
+		var err error
+		next, units.processors, err = a.startProcessors(next, p.processors)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return next, nil
+}
+
+// runChain runs the aggregators and processors of the units in the background
+// until their source channels are closed.
+func (a *Agent) runChain(wg *sync.WaitGroup, startTime time.Time, units *runningUnits) {
+	if units.aggregators != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runProcessors(units.aggProcessors)
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runAggregators(startTime, units.aggregators)
+		}()
+	}
+
+	if units.processors != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runProcessors(units.processors)
+		}()
+	}
+}
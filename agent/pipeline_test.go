@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestPipelines(t *testing.T) {
+	cfg := `
+[[inputs.mem]]
+[[inputs.swap]]
+  pipeline = "security"
+[[inputs.cpu]]
+  pipeline = "audit"
+[[processors.rename]]
+  pipeline = "security"
+[[aggregators.minmax]]
+  pipeline = "security"
+[[outputs.discard]]
+[[outputs.discard]]
+  pipeline = "security"
+[[outputs.discard]]
+  pipeline = "audit"
+`
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfigData([]byte(cfg), config.EmptySourcePath))
+	a := NewAgent(c)
+
+	pipelines := a.pipelines()
+	require.Len(t, pipelines, 3)
+
+	require.Empty(t, pipelines[0].name)
+	require.Len(t, pipelines[0].inputs, 1)
+	require.Equal(t, "mem", pipelines[0].inputs[0].Config.Name)
+	require.Empty(t, pipelines[0].processors)
+	require.Len(t, pipelines[0].outputs, 1)
+
+	require.Equal(t, "audit", pipelines[1].name)
+	require.Len(t, pipelines[1].inputs, 1)
+	require.Equal(t, "cpu", pipelines[1].inputs[0].Config.Name)
+	require.Len(t, pipelines[1].outputs, 1)
+
+	require.Equal(t, "security", pipelines[2].name)
+	require.Len(t, pipelines[2].inputs, 1)
+	require.Len(t, pipelines[2].processors, 1)
+	require.Len(t, pipelines[2].aggregators, 1)
+	require.Len(t, pipelines[2].aggProcessors, 1)
+	require.Len(t, pipelines[2].outputs, 1)
+
+	require.NoError(t, checkPipelines(pipelines, true))
+}
+
+func TestCheckPipelines(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      string
+		expected string
+	}{
+		{
+			name: "default pipeline only",
+			cfg: `
+[[outputs.discard]]
+`,
+		},
+		{
+			name: "named pipeline without outputs",
+			cfg: `
+[[inputs.mem]]
+[[inputs.swap]]
+  pipeline = "security"
+[[outputs.discard]]
+`,
+			expected: `pipeline "security" has no outputs`,
+		},
+		{
+			name: "default pipeline without inputs",
+			cfg: `
+[[inputs.swap]]
+  pipeline = "security"
+[[processors.rename]]
+[[outputs.discard]]
+  pipeline = "security"
+`,
+			expected: "default pipeline has no inputs\ndefault pipeline has no outputs",
+		},
+		{
+			name: "named pipelines only",
+			cfg: `
+[[inputs.swap]]
+  pipeline = "security"
+[[outputs.discard]]
+  pipeline = "security"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.NewConfig()
+			require.NoError(t, c.LoadConfigData([]byte(tt.cfg), config.EmptySourcePath))
+			err := checkPipelines(NewAgent(c).pipelines(), true)
+			if tt.expected == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.expected)
+		})
+	}
+}
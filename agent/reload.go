@@ -0,0 +1,540 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/common/snmp"
+)
+
+// ErrRestartRequired is returned by Reload if the configuration changes
+// cannot be applied while running and the agent has to be restarted.
+var ErrRestartRequired = errors.New("restart required")
+
+// pluginDiff contains the plugins to keep, remove and add when applying a
+// new configuration
+type pluginDiff[T any] struct {
+	keep   []T
+	remove []T
+	add    []T
+}
+
+// diffPlugins matches the running and the updated plugins by their
+// configuration ID. Identically configured plugins share the same ID so every
+// running plugin is only matched once.
+func diffPlugins[T comparable](running, updated []T, id func(T) string) pluginDiff[T] {
+	unmatched := make(map[string][]T, len(running))
+	for _, p := range running {
+		unmatched[id(p)] = append(unmatched[id(p)], p)
+	}
+
+	var diff pluginDiff[T]
+	for _, p := range updated {
+		if candidates := unmatched[id(p)]; len(candidates) > 0 {
+			diff.keep = append(diff.keep, candidates[0])
+			unmatched[id(p)] = candidates[1:]
+			continue
+		}
+		diff.add = append(diff.add, p)
+	}
+	for _, p := range running {
+		if slices.Contains(unmatched[id(p)], p) {
+			diff.remove = append(diff.remove, p)
+		}
+	}
+	return diff
+}
+
+// reloadPlan contains the changes to apply to the running agent
+type reloadPlan struct {
+	unit          *outputUnit
+	inputs        pluginDiff[*models.RunningInput]
+	outputs       pluginDiff[*models.RunningOutput]
+	processors    map[int]*models.RunningProcessor
+	aggProcessors map[int]*models.RunningProcessor
+}
+
+// Reload applies the given configuration to the running agent by only
+// stopping and starting the inputs, processors and outputs that changed.
+// Unchanged plugins keep running, e.g. outputs keep their buffers and
+// connections. An error wrapping ErrRestartRequired is returned if the changes
+// affect the agent settings, global tags, aggregators, the number of
+// processors, named pipelines or dead-letter outputs. All new plugins are
+// started before replacing any running plugin, so if any of them fails, none
+// of the changes is applied and the running agent is left untouched.
+func (a *Agent) Reload(cfg *config.Config) error {
+	// Serialize reloads as the agent is unlocked while connecting outputs
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.Lock()
+	plan, err := a.planReload(cfg)
+	a.Unlock()
+	if err != nil || plan == nil {
+		// Release the buffers of the new outputs as the configuration is
+		// not applied
+		for _, output := range diffPlugins(a.Outputs(), cfg.Outputs, outputID).add {
+			output.Discard()
+		}
+		return err
+	}
+
+	// Connect the new outputs without holding any lock as this might take a
+	// while, e.g. when retrying
+	connected, err := a.connectOutputs(plan.unit, plan.outputs.add)
+	if err != nil {
+		return err
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	// Keep the inputs from shutting down while applying the changes. As the
+	// processors and outputs only shut down after the inputs, all plugins
+	// keep running until the inputs are unlocked.
+	unit := a.running[0].inputs
+	unit.Lock()
+	if unit.closed || unit.ctx == nil {
+		unit.Unlock()
+		for _, output := range connected {
+			output.Close()
+		}
+		return fmt.Errorf("%w: inputs are not running", ErrRestartRequired)
+	}
+
+	// Start all new plugins before changing anything as this might fail
+	processors, inputs, err := a.startPlugins(plan, connected)
+	if err != nil {
+		unit.Unlock()
+		for _, output := range connected {
+			output.Close()
+		}
+		return err
+	}
+
+	// Apply the changes in output-to-input direction so new outputs are
+	// ready before metrics of the new inputs are gathered
+	a.unregisterRemoved(plan)
+	removed := a.swapOutputs(plan.unit, plan.outputs.remove, connected)
+	a.Config.Outputs = slices.Concat(plan.outputs.keep, connected)
+	a.Config.AggProcessors = a.swapProcessors(processors, a.Config.AggProcessors, plan.aggProcessors)
+	a.Config.Processors = a.swapProcessors(processors, a.Config.Processors, plan.processors)
+	a.Config.Inputs = a.swapInputs(unit, plan.inputs, inputs)
+	unit.Unlock()
+
+	// Flush the removed outputs a last time after they stopped receiving
+	// metrics
+	for output, stop := range removed {
+		log.Printf("D! [agent] Stopping output %s", output.LogName())
+		stop()
+		output.Close()
+	}
+
+	log.Printf("I! [agent] Reloaded configuration: %d inputs, %d processors and %d outputs changed",
+		len(plan.inputs.remove)+len(plan.inputs.add), len(plan.processors)+len(plan.aggProcessors),
+		len(plan.outputs.remove)+len(plan.outputs.add))
+	return nil
+}
+
+// planReload determines the changes required to apply the given configuration
+// and initializes the new plugins. A nil plan is returned if the configuration
+// is unchanged. The agent must be locked by the caller.
+func (a *Agent) planReload(cfg *config.Config) (*reloadPlan, error) {
+	if a.running == nil {
+		return nil, fmt.Errorf("%w: agent is not running", ErrRestartRequired)
+	}
+	if reason := a.requiresRestart(cfg); reason != "" {
+		return nil, fmt.Errorf("%w: %s", ErrRestartRequired, reason)
+	}
+
+	plan := &reloadPlan{
+		unit:       a.running[0].outputs,
+		inputs:     diffPlugins(a.Config.Inputs, cfg.Inputs, func(p *models.RunningInput) string { return p.Config.ID }),
+		outputs:    diffPlugins(a.Config.Outputs, cfg.Outputs, outputID),
+		processors: changedProcessors(a.Config.Processors, cfg.Processors),
+	}
+	for _, output := range slices.Concat(plan.outputs.remove, plan.outputs.add) {
+		if output.IsDeadLetterOutput() || output.Config.DeadLetterOutput != "" {
+			return nil, fmt.Errorf("%w: changed output %s is involved in dead-letter routing", ErrRestartRequired, output.LogName())
+		}
+	}
+	if !*a.Config.Agent.SkipProcessorsAfterAggregators {
+		plan.aggProcessors = changedProcessors(a.Config.AggProcessors, cfg.AggProcessors)
+	}
+
+	changes := len(plan.inputs.remove) + len(plan.inputs.add) + len(plan.outputs.remove) + len(plan.outputs.add)
+	if changes+len(plan.processors)+len(plan.aggProcessors) == 0 {
+		log.Printf("I! [agent] Configuration unchanged")
+		return nil, nil
+	}
+
+	// Initialize all new plugins before changing anything
+	for _, input := range plan.inputs.add {
+		if tp, ok := input.Input.(snmp.TranslatorPlugin); ok {
+			tp.SetTranslator(a.Config.Agent.SnmpTranslator)
+		}
+		if err := input.Init(); err != nil {
+			return nil, fmt.Errorf("could not initialize input %s: %w", input.LogName(), err)
+		}
+	}
+	for _, processor := range slices.Concat(slices.Collect(maps.Values(plan.processors)), slices.Collect(maps.Values(plan.aggProcessors))) {
+		if err := processor.Init(); err != nil {
+			return nil, fmt.Errorf("could not initialize processor %s: %w", processor.LogName(), err)
+		}
+	}
+	for _, output := range plan.outputs.add {
+		if err := output.Init(); err != nil {
+			return nil, fmt.Errorf("could not initialize output %s: %w", output.LogName(), err)
+		}
+	}
+
+	return plan, nil
+}
+
+func outputID(output *models.RunningOutput) string {
+	return output.Config.ID
+}
+
+// Outputs returns the outputs of the running agent. Pass them to
+// config.Config.ReuseOutputs before loading the configuration for Reload.
+func (a *Agent) Outputs() []*models.RunningOutput {
+	a.Lock()
+	defer a.Unlock()
+	return slices.Clone(a.Config.Outputs)
+}
+
+// requiresRestart returns the reason why the given configuration cannot be
+// applied while running or an empty string if it can be applied.
+func (a *Agent) requiresRestart(cfg *config.Config) string {
+	if a.Config.AgentID != cfg.AgentID {
+		return "agent settings changed"
+	}
+	// Only the default pipeline can be changed while running
+	if usesPipelines(a.Config) || usesPipelines(cfg) {
+		return "named pipelines are used"
+	}
+	if !maps.Equal(a.Config.Tags, cfg.Tags) {
+		return "global tags changed"
+	}
+	if len(a.Config.Aggregators) != len(cfg.Aggregators) {
+		return "aggregators changed"
+	}
+	for i, aggregator := range a.Config.Aggregators {
+		if aggregator.Config.ID != cfg.Aggregators[i].Config.ID {
+			return "aggregators changed"
+		}
+	}
+	if len(a.Config.Processors) != len(cfg.Processors) || len(a.Config.AggProcessors) != len(cfg.AggProcessors) {
+		return "number of processors changed"
+	}
+	return ""
+}
+
+// changedProcessors returns the updated processors by position in the
+// processing chain whose configuration differs from the running ones.
+func changedProcessors(running, updated models.RunningProcessors) map[int]*models.RunningProcessor {
+	changed := make(map[int]*models.RunningProcessor)
+	for i, processor := range updated {
+		if running[i].Config.ID != processor.Config.ID {
+			changed[i] = processor
+		}
+	}
+	return changed
+}
+
+// startedProcessor is a new processor started to replace a running one
+type startedProcessor struct {
+	unit      *processorUnit
+	processor *models.RunningProcessor
+}
+
+// startPlugins registers the state of the new plugins and starts the new
+// processors and inputs without replacing any running plugin. On error, all
+// plugins started are stopped again. The inputs unit must be locked by the
+// caller.
+func (a *Agent) startPlugins(plan *reloadPlan, outputs []*models.RunningOutput) (map[*models.RunningProcessor]startedProcessor, []*models.RunningInput, error) {
+	if err := a.checkStates(plan, outputs); err != nil {
+		return nil, nil, err
+	}
+
+	processors := make(map[*models.RunningProcessor]startedProcessor, len(plan.processors)+len(plan.aggProcessors))
+	var inputs []*models.RunningInput
+	success := false
+	defer func() {
+		if success {
+			return
+		}
+		for _, input := range inputs {
+			input.Stop()
+		}
+		for _, p := range processors {
+			p.processor.Stop()
+		}
+	}()
+
+	for _, changes := range []struct {
+		units   []*processorUnit
+		running models.RunningProcessors
+		changed map[int]*models.RunningProcessor
+	}{
+		{a.running[0].aggProcessors, a.Config.AggProcessors, plan.aggProcessors},
+		{a.running[0].processors, a.Config.Processors, plan.processors},
+	} {
+		for i, processor := range changes.changed {
+			idx := slices.IndexFunc(changes.units, func(u *processorUnit) bool { return u.processor == changes.running[i] })
+			if idx < 0 {
+				return nil, nil, fmt.Errorf("%w: processor %s is not running", ErrRestartRequired, changes.running[i].LogName())
+			}
+			unit := changes.units[idx]
+			log.Printf("D! [agent] Starting processor %s", processor.LogName())
+			if err := processor.Start(NewAccumulator(processor, unit.dst)); err != nil {
+				return nil, nil, fmt.Errorf("starting processor %s: %w", processor.LogName(), err)
+			}
+			processors[changes.running[i]] = startedProcessor{unit: unit, processor: processor}
+		}
+	}
+
+	unit := a.running[0].inputs
+	for _, input := range plan.inputs.add {
+		log.Printf("D! [agent] Starting input %s", input.LogName())
+		var precision time.Duration
+		if input.Config.Precision != 0 {
+			precision = input.Config.Precision
+		}
+		acc := NewAccumulator(input, unit.dst)
+		acc.SetPrecision(getPrecision(precision, 0))
+
+		if err := input.Start(acc); err != nil {
+			var fatalErr *internal.FatalError
+			if errors.As(err, &fatalErr) {
+				log.Printf("I! [agent] Failed to start %s, shutting down plugin: %s", input.LogName(), err)
+				continue
+			}
+			return nil, nil, fmt.Errorf("starting input %s: %w", input.LogName(), err)
+		}
+		if err := input.Probe(); err != nil {
+			log.Printf("I! [agent] Failed to probe %s, shutting down plugin: %s", input.LogName(), err)
+			input.Stop()
+			continue
+		}
+		inputs = append(inputs, input)
+	}
+
+	success = true
+	return processors, inputs, nil
+}
+
+// checkStates makes sure the states of the new plugins can be registered
+// after unregistering the states of the plugins removed or replaced
+func (a *Agent) checkStates(plan *reloadPlan, outputs []*models.RunningOutput) error {
+	if a.Config.Persister == nil {
+		return nil
+	}
+
+	removed := make(map[string]bool)
+	for _, id := range a.removedIDs(plan) {
+		removed[id] = true
+	}
+
+	added := make(map[string]bool)
+	check := func(id, name string, plugin interface{}) error {
+		if _, ok := plugin.(telegraf.StatefulPlugin); !ok {
+			return nil
+		}
+		if added[id] || (a.Config.Persister.IsRegistered(id) && !removed[id]) {
+			return fmt.Errorf("could not register %s: plugin with ID %q already registered", name, id)
+		}
+		added[id] = true
+		return nil
+	}
+	for _, output := range outputs {
+		if err := check(output.ID(), output.LogName(), output.Output); err != nil {
+			return err
+		}
+	}
+	for _, processor := range slices.Concat(slices.Collect(maps.Values(plan.processors)), slices.Collect(maps.Values(plan.aggProcessors))) {
+		if !processor.IsStateful() {
+			continue
+		}
+		if err := check(processor.ID(), processor.LogName(), processor); err != nil {
+			return err
+		}
+	}
+	for _, input := range plan.inputs.add {
+		if err := check(input.ID(), input.LogName(), input.Input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removedIDs returns the IDs of the plugins removed or replaced by the plan
+func (a *Agent) removedIDs(plan *reloadPlan) []string {
+	ids := make([]string, 0, len(plan.outputs.remove)+len(plan.inputs.remove)+len(plan.processors)+len(plan.aggProcessors))
+	for _, output := range plan.outputs.remove {
+		ids = append(ids, output.ID())
+	}
+	for i := range plan.aggProcessors {
+		ids = append(ids, a.Config.AggProcessors[i].ID())
+	}
+	for i := range plan.processors {
+		ids = append(ids, a.Config.Processors[i].ID())
+	}
+	for _, input := range plan.inputs.remove {
+		ids = append(ids, input.ID())
+	}
+	return ids
+}
+
+// unregisterRemoved removes the states of the plugins removed or replaced by
+// the plan to allow registering the states of the new plugins
+func (a *Agent) unregisterRemoved(plan *reloadPlan) {
+	for _, id := range a.removedIDs(plan) {
+		a.unregisterState(id)
+	}
+}
+
+// swapInputs stops the removed inputs and starts gathering the given started
+// inputs. It returns the inputs running afterwards. The unit must be locked by
+// the caller.
+func (a *Agent) swapInputs(unit *inputUnit, diff pluginDiff[*models.RunningInput], started []*models.RunningInput) []*models.RunningInput {
+	for _, input := range diff.remove {
+		// Inputs failing on startup were never started
+		stop, found := unit.stops[input]
+		if !found {
+			continue
+		}
+		log.Printf("D! [agent] Stopping input %s", input.LogName())
+		stop()
+		delete(unit.stops, input)
+		delete(unit.triggers, input)
+		input.Stop()
+		unit.inputs = slices.DeleteFunc(unit.inputs, func(i *models.RunningInput) bool { return i == input })
+	}
+
+	for _, input := range started {
+		a.registerState(input.ID(), input.Input)
+		a.startGatherLoop(unit, input)
+		unit.inputs = append(unit.inputs, input)
+	}
+
+	return slices.Concat(diff.keep, started)
+}
+
+// swapProcessors replaces the running processors at the changed positions by
+// the started ones and returns the processors running afterwards
+func (a *Agent) swapProcessors(started map[*models.RunningProcessor]startedProcessor, running models.RunningProcessors, changed map[int]*models.RunningProcessor) models.RunningProcessors {
+	running = slices.Clone(running)
+	for i := range changed {
+		replacement := started[running[i]]
+		unit := replacement.unit
+
+		log.Printf("D! [agent] Replacing processor %s", unit.processor.LogName())
+		unit.Lock()
+		unit.processor.Stop()
+		unit.processor = replacement.processor
+		unit.acc = NewAccumulator(replacement.processor, unit.dst)
+		unit.Unlock()
+
+		if replacement.processor.IsStateful() {
+			a.registerState(replacement.processor.ID(), replacement.processor)
+		}
+		running[i] = replacement.processor
+	}
+	return running
+}
+
+// connectOutputs connects the given outputs to be added to the running unit.
+// Outputs failing fatally are closed and skipped. On other errors, all outputs
+// are released.
+func (a *Agent) connectOutputs(unit *outputUnit, outputs []*models.RunningOutput) ([]*models.RunningOutput, error) {
+	unit.RLock()
+	ctx := unit.ctx
+	unit.RUnlock()
+	if ctx == nil {
+		for _, o := range outputs {
+			o.Discard()
+		}
+		return nil, fmt.Errorf("%w: outputs are not running", ErrRestartRequired)
+	}
+
+	connected := make([]*models.RunningOutput, 0, len(outputs))
+	for i, output := range outputs {
+		if err := a.connectOutput(ctx, output); err != nil {
+			var fatalErr *internal.FatalError
+			if errors.As(err, &fatalErr) {
+				log.Printf("I! [agent] Failed to connect to [%s], error was %q;  shutting down plugin...", output.LogName(), err)
+				output.Close()
+				continue
+			}
+			for _, o := range connected {
+				o.Close()
+			}
+			for _, o := range outputs[i:] {
+				o.Discard()
+			}
+			return nil, fmt.Errorf("connecting output %s: %w", output.LogName(), err)
+		}
+		connected = append(connected, output)
+	}
+	return connected, nil
+}
+
+// swapOutputs starts routing metrics to the connected outputs and stops
+// routing to the removed outputs. It returns the functions to stop the removed
+// outputs after flushing them a last time.
+func (a *Agent) swapOutputs(unit *outputUnit, remove, connected []*models.RunningOutput) map[*models.RunningOutput]func() {
+	unit.Lock()
+	defer unit.Unlock()
+
+	for _, output := range connected {
+		a.registerState(output.ID(), output.Output)
+		log.Printf("D! [agent] Starting output %s", output.LogName())
+		a.startFlushLoop(unit, output)
+	}
+	unit.outputs = slices.Concat(slices.DeleteFunc(unit.outputs, func(o *models.RunningOutput) bool {
+		return slices.Contains(remove, o)
+	}), connected)
+	unit.updateRoutes()
+
+	stops := make(map[*models.RunningOutput]func(), len(remove))
+	for _, output := range remove {
+		// Outputs failing on startup were never started
+		if stop, found := unit.stops[output]; found {
+			stops[output] = stop
+			delete(unit.stops, output)
+			delete(unit.flushes, output)
+		}
+	}
+	return stops
+}
+
+// registerState registers stateful plugins added while running. Registering
+// cannot fail as the states are checked before applying any change.
+func (a *Agent) registerState(id string, plugin interface{}) {
+	if a.Config.Persister == nil {
+		return
+	}
+	p, ok := plugin.(telegraf.StatefulPlugin)
+	if !ok {
+		return
+	}
+	if err := a.Config.Persister.Register(id, p); err != nil {
+		log.Printf("E! [agent] Registering state of plugin %q failed: %v", id, err)
+	}
+}
+
+// unregisterState removes the state of plugins removed while running
+func (a *Agent) unregisterState(id string) {
+	if a.Config.Persister != nil {
+		a.Config.Persister.Unregister(id)
+	}
+}
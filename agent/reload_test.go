@@ -0,0 +1,326 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/models"
+)
+
+func TestDiffPlugins(t *testing.T) {
+	id := func(s string) string { return strings.TrimSuffix(s, "'") }
+
+	tests := []struct {
+		name     string
+		running  []string
+		updated  []string
+		expected pluginDiff[string]
+	}{
+		{
+			name:     "unchanged",
+			running:  []string{"a", "b"},
+			updated:  []string{"b", "a"},
+			expected: pluginDiff[string]{keep: []string{"b", "a"}},
+		},
+		{
+			name:     "changed",
+			running:  []string{"a", "b"},
+			updated:  []string{"a", "c"},
+			expected: pluginDiff[string]{keep: []string{"a"}, remove: []string{"b"}, add: []string{"c"}},
+		},
+		{
+			name:     "duplicates",
+			running:  []string{"a", "a'"},
+			updated:  []string{"a", "b"},
+			expected: pluginDiff[string]{keep: []string{"a"}, remove: []string{"a'"}, add: []string{"b"}},
+		},
+		{
+			name:     "added duplicate",
+			running:  []string{"a"},
+			updated:  []string{"a", "a'"},
+			expected: pluginDiff[string]{keep: []string{"a"}, add: []string{"a'"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, diffPlugins(tt.running, tt.updated, id))
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	initial := `
+[[inputs.mem]]
+[[outputs.discard]]
+  alias = "unchanged"
+[[outputs.discard]]
+  alias = "removed"
+`
+	updated := `
+[[inputs.swap]]
+[[outputs.discard]]
+  alias = "unchanged"
+[[outputs.discard]]
+  alias = "added"
+`
+
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfigData([]byte(initial), config.EmptySourcePath))
+	a := NewAgent(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		status := a.Status()
+		for _, s := range status {
+			if s.Status != "running" {
+				return false
+			}
+		}
+		return len(status) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	running := a.Outputs()
+	require.Len(t, running, 2)
+
+	cfg := config.NewConfig()
+	cfg.ReuseOutputs(running)
+	require.NoError(t, cfg.LoadConfigData([]byte(updated), config.EmptySourcePath))
+	require.NoError(t, a.Reload(cfg))
+
+	require.Len(t, a.Config.Inputs, 1)
+	require.Equal(t, "swap", a.Config.Inputs[0].Config.Name)
+	outputs := a.Outputs()
+	require.Len(t, outputs, 2)
+	require.Same(t, running[0], outputs[0])
+	require.Equal(t, "added", outputs[1].Config.Alias)
+
+	// Changing the agent settings requires a restart
+	cfg = config.NewConfig()
+	cfg.ReuseOutputs(outputs)
+	require.NoError(t, cfg.LoadConfigData([]byte("[agent]\n  interval = \"1m\"\n"+updated), config.EmptySourcePath))
+	require.ErrorIs(t, a.Reload(cfg), ErrRestartRequired)
+	require.Equal(t, outputs, a.Outputs())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestReloadConnectUnlocked(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = config.Duration(time.Hour)
+	c.Agent.FlushInterval = config.Duration(time.Hour)
+	c.Inputs = append(c.Inputs, models.NewRunningInput(&countingInput{}, &models.InputConfig{Name: "counting", ID: "input"}))
+	running, err := models.NewRunningOutput(&countingOutput{}, &models.OutputConfig{Name: "counting", ID: "running"}, 0, 0)
+	require.NoError(t, err)
+	c.Outputs = append(c.Outputs, running)
+
+	a := NewAgent(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return a.Status() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Add an output taking a while to connect
+	plugin := &slowOutput{connecting: make(chan struct{}), release: make(chan struct{})}
+	added, err := models.NewRunningOutput(plugin, &models.OutputConfig{Name: "slow", ID: "added"}, 0, 0)
+	require.NoError(t, err)
+	cfg := config.NewConfig()
+	cfg.Inputs = c.Inputs
+	cfg.Outputs = []*models.RunningOutput{running, added}
+
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- a.Reload(cfg)
+	}()
+	<-plugin.connecting
+
+	// The agent must be accessible while connecting
+	status := make(chan []PluginStatus, 1)
+	go func() {
+		status <- a.Status()
+	}()
+	select {
+	case s := <-status:
+		require.Len(t, s, 2)
+	case <-time.After(3 * time.Second):
+		require.Fail(t, "agent is locked while connecting the output")
+	}
+
+	close(plugin.release)
+	require.NoError(t, <-reloaded)
+	require.Equal(t, []*models.RunningOutput{running, added}, a.Outputs())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestReloadFailedKeepsConfig(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = config.Duration(time.Hour)
+	c.Agent.FlushInterval = config.Duration(time.Hour)
+	c.Inputs = append(c.Inputs, models.NewRunningInput(&countingInput{}, &models.InputConfig{Name: "counting", ID: "input"}))
+	c.Processors = append(c.Processors, models.NewRunningProcessor(&startingProcessor{}, &models.ProcessorConfig{Name: "starting", ID: "processor"}))
+	running, err := models.NewRunningOutput(&countingOutput{}, &models.OutputConfig{Name: "counting", ID: "running"}, 0, 0)
+	require.NoError(t, err)
+	c.Outputs = append(c.Outputs, running)
+
+	a := NewAgent(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return a.Status() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Add an output and replace the processor by one failing to start
+	added, err := models.NewRunningOutput(&countingOutput{}, &models.OutputConfig{Name: "counting", ID: "added"}, 0, 0)
+	require.NoError(t, err)
+	failing := models.NewRunningProcessor(&startingProcessor{err: errors.New("failed")}, &models.ProcessorConfig{Name: "starting", ID: "failing"})
+	cfg := config.NewConfig()
+	cfg.Inputs = c.Inputs
+	cfg.Processors = models.RunningProcessors{failing}
+	cfg.Outputs = []*models.RunningOutput{running, added}
+
+	// The configuration must not be updated partially
+	require.ErrorContains(t, a.Reload(cfg), "starting processor")
+	require.Equal(t, []*models.RunningOutput{running}, a.Outputs())
+	require.Equal(t, "processor", a.Config.Processors[0].Config.ID)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestReloadFailedInputRollsBack(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = config.Duration(time.Hour)
+	c.Agent.FlushInterval = config.Duration(time.Hour)
+	c.Inputs = append(c.Inputs, models.NewRunningInput(&countingInput{}, &models.InputConfig{Name: "counting", ID: "input"}))
+	current := &startingProcessor{}
+	c.Processors = append(c.Processors, models.NewRunningProcessor(current, &models.ProcessorConfig{Name: "starting", ID: "processor"}))
+	running, err := models.NewRunningOutput(&countingOutput{}, &models.OutputConfig{Name: "counting", ID: "running"}, 0, 0)
+	require.NoError(t, err)
+	c.Outputs = append(c.Outputs, running)
+
+	a := NewAgent(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return a.Status() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Add an output, replace the processor and add an input failing to start
+	added, err := models.NewRunningOutput(&countingOutput{}, &models.OutputConfig{Name: "counting", ID: "added"}, 0, 0)
+	require.NoError(t, err)
+	replacement := &startingProcessor{}
+	failing := &startingInput{err: errors.New("failed")}
+	cfg := config.NewConfig()
+	cfg.Inputs = append(slices.Clone(c.Inputs), models.NewRunningInput(failing, &models.InputConfig{Name: "starting", ID: "failing"}))
+	cfg.Processors = models.RunningProcessors{
+		models.NewRunningProcessor(replacement, &models.ProcessorConfig{Name: "starting", ID: "replacement"}),
+	}
+	cfg.Outputs = []*models.RunningOutput{running, added}
+
+	// None of the changes must be applied and the started plugins stopped
+	require.ErrorContains(t, a.Reload(cfg), "starting input")
+	require.Equal(t, []*models.RunningOutput{running}, a.Outputs())
+	require.Equal(t, "processor", a.Config.Processors[0].Config.ID)
+	require.Len(t, a.Config.Inputs, 1)
+	require.True(t, replacement.stopped.Load())
+	require.False(t, current.stopped.Load())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+type slowOutput struct {
+	connecting chan struct{}
+	release    chan struct{}
+}
+
+func (*slowOutput) SampleConfig() string {
+	return ""
+}
+
+func (o *slowOutput) Connect() error {
+	close(o.connecting)
+	<-o.release
+	return nil
+}
+
+func (*slowOutput) Close() error {
+	return nil
+}
+
+func (*slowOutput) Write([]telegraf.Metric) error {
+	return nil
+}
+
+type startingProcessor struct {
+	err     error
+	stopped atomic.Bool
+}
+
+func (*startingProcessor) SampleConfig() string {
+	return ""
+}
+
+func (p *startingProcessor) Start(telegraf.Accumulator) error {
+	return p.err
+}
+
+func (*startingProcessor) Add(m telegraf.Metric, acc telegraf.Accumulator) error {
+	acc.AddMetric(m)
+	return nil
+}
+
+func (p *startingProcessor) Stop() {
+	p.stopped.Store(true)
+}
+
+type startingInput struct {
+	err     error
+	stopped atomic.Bool
+}
+
+func (*startingInput) SampleConfig() string {
+	return ""
+}
+
+func (i *startingInput) Start(telegraf.Accumulator) error {
+	return i.err
+}
+
+func (*startingInput) Gather(telegraf.Accumulator) error {
+	return nil
+}
+
+func (i *startingInput) Stop() {
+	i.stopped.Store(true)
+}
@@ -0,0 +1,288 @@
+// Command handling for disk-buffer "buffer" command
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+func getBufferCommands(outputBuffer io.Writer) []*cli.Command {
+	directoryFlag := &cli.StringFlag{
+		Name:     "buffer-directory",
+		Usage:    "directory containing the disk buffers as set via 'buffer_directory' in the agent configuration",
+		Required: true,
+	}
+	keyFlag := &cli.StringFlag{
+		Name:    "encryption-key",
+		Usage:   "hex-encoded key for reading encrypted buffers",
+		EnvVars: []string{"TELEGRAF_BUFFER_ENCRYPTION_KEY"},
+	}
+
+	return []*cli.Command{
+		{
+			Name:  "buffer",
+			Usage: "commands for inspecting and modifying disk buffers",
+			Description: `
+The 'buffer' command allows to access the buffer files of outputs written when
+using the 'disk' buffer strategy. The buffer ID corresponds to the ID of the
+output plugin and is the name of the sub-directory in the buffer directory.
+
+Please make sure Telegraf is not running when accessing the buffers as the
+content might otherwise change in the meantime!
+`,
+			Subcommands: []*cli.Command{
+				{
+					Name:  "list",
+					Usage: "list all buffers with their metric count and time range",
+					Description: `
+The 'list' command shows all buffers in the given buffer directory together
+with the number of metrics and the timestamps of the oldest and newest metric.
+
+> telegraf buffer list --buffer-directory /var/lib/telegraf/buffer
+`,
+					Flags: []cli.Flag{directoryFlag, keyFlag},
+					Action: func(cCtx *cli.Context) error {
+						dir := cCtx.String("buffer-directory")
+						entries, err := os.ReadDir(dir)
+						if err != nil {
+							return fmt.Errorf("reading buffer directory failed: %w", err)
+						}
+
+						w := tabwriter.NewWriter(outputBuffer, 0, 4, 2, ' ', 0)
+						fmt.Fprintln(w, "ID\tMETRICS\tOLDEST\tNEWEST")
+						for _, entry := range entries {
+							// Skip files and quarantined buffers
+							if !entry.IsDir() || strings.HasSuffix(entry.Name(), ".corrupt") {
+								continue
+							}
+
+							var count int
+							var oldest, newest time.Time
+							err := walkBuffer(dir, entry.Name(), bufferKey(cCtx), -1, func(m telegraf.Metric) error {
+								count++
+								if oldest.IsZero() || m.Time().Before(oldest) {
+									oldest = m.Time()
+								}
+								if m.Time().After(newest) {
+									newest = m.Time()
+								}
+								return nil
+							})
+							if err != nil {
+								return fmt.Errorf("reading buffer %q failed: %w", entry.Name(), err)
+							}
+
+							if count == 0 {
+								fmt.Fprintf(w, "%s\t0\t-\t-\n", entry.Name())
+								continue
+							}
+							fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", entry.Name(), count, oldest.Format(time.RFC3339), newest.Format(time.RFC3339))
+						}
+						return w.Flush()
+					},
+				},
+				{
+					Name:  "dump",
+					Usage: "print the metrics of the given buffer in line-protocol",
+					Description: `
+The 'dump' command prints the metrics of the buffer with the given ID, starting
+from the oldest metric, in InfluxDB line-protocol format.
+
+To print the ten oldest metrics use
+
+> telegraf buffer dump --buffer-directory /var/lib/telegraf/buffer --count 10 <buffer ID>
+`,
+					ArgsUsage: "<buffer ID>",
+					Flags: []cli.Flag{
+						directoryFlag,
+						keyFlag,
+						&cli.IntFlag{
+							Name:  "count",
+							Usage: "maximum number of metrics to print, all metrics if negative",
+							Value: -1,
+						},
+					},
+					Action: func(cCtx *cli.Context) error {
+						args := cCtx.Args()
+						if args.Len() != 1 {
+							return errors.New("invalid number of arguments")
+						}
+
+						serializer := &influx.Serializer{SortFields: true, UintSupport: true}
+						return walkBuffer(cCtx.String("buffer-directory"), args.First(), bufferKey(cCtx), cCtx.Int("count"), func(m telegraf.Metric) error {
+							octets, err := serializer.Serialize(m)
+							if err != nil {
+								return fmt.Errorf("serializing metric failed: %w", err)
+							}
+							_, err = outputBuffer.Write(octets)
+							return err
+						})
+					},
+				},
+				{
+					Name:  "drop",
+					Usage: "remove the oldest metrics from the given buffer",
+					Description: `
+The 'drop' command removes the given number of metrics from the buffer with the
+given ID, starting from the oldest metric. This might be useful to remove
+metrics permanently rejected by the service of the output.
+
+To remove the five oldest metrics use
+
+> telegraf buffer drop --buffer-directory /var/lib/telegraf/buffer --count 5 <buffer ID>
+`,
+					ArgsUsage: "<buffer ID>",
+					Flags: []cli.Flag{
+						directoryFlag,
+						&cli.IntFlag{
+							Name:     "count",
+							Usage:    "number of metrics to remove",
+							Required: true,
+						},
+					},
+					Action: func(cCtx *cli.Context) error {
+						args := cCtx.Args()
+						if args.Len() != 1 {
+							return errors.New("invalid number of arguments")
+						}
+						if cCtx.Int("count") < 0 {
+							return errors.New("count must not be negative")
+						}
+
+						// Dropping metrics does not require decoding so no key is needed
+						buf, err := models.OpenDiskBufferFile(filepath.Join(cCtx.String("buffer-directory"), args.First()), nil)
+						if err != nil {
+							return err
+						}
+						defer buf.Close()
+
+						return buf.Drop(cCtx.Int("count"))
+					},
+				},
+				{
+					Name:  "replay",
+					Usage: "write the metrics of the given buffer to an output",
+					Description: `
+The 'replay' command writes the metrics of the buffer with the given ID to the
+output defined in the given configuration file. The configuration must contain
+exactly one output plugin. Use the '--drop' flag to remove successfully written
+metrics from the buffer.
+
+To write all metrics of a buffer to the output defined in 'replay.conf' use
+
+> telegraf buffer replay --buffer-directory /var/lib/telegraf/buffer --output-config replay.conf <buffer ID>
+`,
+					ArgsUsage: "<buffer ID>",
+					Flags: []cli.Flag{
+						directoryFlag,
+						keyFlag,
+						&cli.StringFlag{
+							Name:     "output-config",
+							Usage:    "configuration file containing the output to write to",
+							Required: true,
+						},
+						&cli.BoolFlag{
+							Name:  "drop",
+							Usage: "remove the written metrics from the buffer",
+						},
+					},
+					Action: func(cCtx *cli.Context) error {
+						args := cCtx.Args()
+						if args.Len() != 1 {
+							return errors.New("invalid number of arguments")
+						}
+
+						// Load the configuration and setup the output
+						c := config.NewConfig()
+						if err := c.LoadConfig(cCtx.String("output-config")); err != nil {
+							return err
+						}
+						if len(c.Outputs) != 1 {
+							return fmt.Errorf("expected exactly one output but got %d", len(c.Outputs))
+						}
+						output := c.Outputs[0]
+						if err := output.Init(); err != nil {
+							return fmt.Errorf("initializing output failed: %w", err)
+						}
+						if err := output.Connect(); err != nil {
+							return fmt.Errorf("connecting output failed: %w", err)
+						}
+						defer output.Close()
+
+						buf, err := models.OpenDiskBufferFile(filepath.Join(cCtx.String("buffer-directory"), args.First()), bufferKey(cCtx))
+						if err != nil {
+							return err
+						}
+						defer buf.Close()
+
+						// Write the metrics in batches and stop on the first error
+						var written, pending int
+						err = buf.Walk(-1, func(m telegraf.Metric) error {
+							output.AddMetric(m)
+							pending++
+							if pending < output.MetricBatchSize {
+								return nil
+							}
+							if err := output.Write(); err != nil {
+								return err
+							}
+							written += pending
+							pending = 0
+							return nil
+						})
+						if err == nil && pending > 0 {
+							if err = output.Write(); err == nil {
+								written += pending
+							}
+						}
+						fmt.Fprintf(outputBuffer, "Wrote %d metrics to %s\n", written, output.LogName())
+
+						if cCtx.Bool("drop") && written > 0 {
+							if derr := buf.Drop(written); derr != nil {
+								return errors.Join(err, derr)
+							}
+						}
+						return err
+					},
+				},
+			},
+		},
+	}
+}
+
+// bufferKey returns the function providing the encryption key given on the
+// command line or nil if no key is given
+func bufferKey(cCtx *cli.Context) func() ([]byte, error) {
+	key := cCtx.String("encryption-key")
+	if key == "" {
+		return nil
+	}
+	return func() ([]byte, error) {
+		return []byte(key), nil
+	}
+}
+
+// walkBuffer iterates over up to 'count' metrics of the buffer with the given
+// ID in the given directory
+func walkBuffer(dir, id string, key func() ([]byte, error), count int, fn func(telegraf.Metric) error) error {
+	buf, err := models.OpenDiskBufferFile(filepath.Join(dir, id), key)
+	if err != nil {
+		return err
+	}
+	defer buf.Close()
+
+	return buf.Walk(count, fn)
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -69,25 +70,14 @@ func getConfigCommands(configHandlingFlags []cli.Flag, outputBuffer io.Writer) [
 						}
 						config.NonStrictEnvVarHandling = !cCtx.Bool("strict-env-handling")
 
-						// Collect the given configuration files
-						configFiles := cCtx.StringSlice("config")
-						configDir := cCtx.StringSlice("config-directory")
-						for _, fConfigDirectory := range configDir {
-							files, err := config.WalkDirectory(fConfigDirectory)
-							if err != nil {
-								return err
-							}
-							configFiles = append(configFiles, files...)
+						if err := config.SetConfigPublicKeys(cCtx.StringSlice("config-public-key")); err != nil {
+							return err
 						}
 
-						// If no "config" or "config-directory" flag(s) was
-						// provided we should load default configuration files
-						if len(configFiles) == 0 {
-							paths, err := config.GetDefaultConfigPath()
-							if err != nil {
-								return err
-							}
-							configFiles = paths
+						// Collect the given configuration files
+						configFiles, err := collectConfigFiles(cCtx)
+						if err != nil {
+							return err
 						}
 
 						// Load the config and try to initialize the plugins
@@ -111,6 +101,119 @@ func getConfigCommands(configHandlingFlags []cli.Flag, outputBuffer io.Writer) [
 						return ag.InitPlugins()
 					},
 				},
+				{
+					Name:  "lint",
+					Usage: "check configuration file(s) for likely mistakes across plugins",
+					Description: `
+The 'lint' command reads the configuration files specified via '--config' or
+'--config-directory' and reports settings that are valid but likely mistakes,
+e.g. 'namepass' filters never matching any metric, processors with the same
+'order', outputs with a 'metric_batch_size' exceeding the
+'metric_buffer_limit', duplicate aliases, unused secret-stores or a
+'data_format' setting for plugins not supporting data formats.
+The command fails if any issue is found.
+
+To lint the file 'mysettings.conf' and output the issues as JSON use
+
+> telegraf config lint --config mysettings.conf --format json
+`,
+					Flags: append(configHandlingFlags,
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "output format of the issues, available are 'text' and 'json'",
+							Value: "text",
+						},
+					),
+					Action: func(cCtx *cli.Context) error {
+						// Setup logging
+						logConfig := &logger.Config{Debug: cCtx.Bool("debug")}
+						if err := logger.SetupLogging(logConfig); err != nil {
+							return err
+						}
+
+						format := cCtx.String("format")
+						if format != "text" && format != "json" {
+							return fmt.Errorf("invalid format %q", format)
+						}
+
+						// Collect the given configuration files
+						configFiles, err := collectConfigFiles(cCtx)
+						if err != nil {
+							return err
+						}
+
+						c := config.NewConfig()
+						c.Agent.Quiet = cCtx.Bool("quiet")
+						if err := c.LoadAll(configFiles...); err != nil {
+							return err
+						}
+
+						issues := c.Lint()
+						switch format {
+						case "json":
+							if issues == nil {
+								issues = make([]config.LintIssue, 0)
+							}
+							enc := json.NewEncoder(outputBuffer)
+							enc.SetIndent("", "  ")
+							if err := enc.Encode(issues); err != nil {
+								return err
+							}
+						default:
+							for _, issue := range issues {
+								fmt.Fprintln(outputBuffer, issue.String())
+							}
+						}
+
+						if len(issues) > 0 {
+							return fmt.Errorf("found %d issue(s)", len(issues))
+						}
+						return nil
+					},
+				},
+				{
+					Name:  "expand",
+					Usage: "expand the templates of the configuration(s) and show the result",
+					Description: `
+The 'expand' command reads the configuration files specified via '--config' or
+'--config-directory' and prints the configurations with all template instances
+replaced by the rendered templates, i.e. the plugins as used by Telegraf.
+If no configuration file is explicitly specified the command reads the default
+locations and uses those configuration files.
+
+To show the expanded configuration of the file 'mysettings.conf' use
+
+> telegraf config expand --config mysettings.conf
+`,
+					Flags: configHandlingFlags,
+					Action: func(cCtx *cli.Context) error {
+						// Collect the given configuration files
+						configFiles, err := collectConfigFiles(cCtx)
+						if err != nil {
+							return err
+						}
+
+						for _, fn := range configFiles {
+							data, _, err := config.LoadConfigFile(fn)
+							if err != nil {
+								return fmt.Errorf("opening input %q failed: %w", fn, err)
+							}
+
+							out, err := config.ExpandTemplates(data)
+							if err != nil {
+								return fmt.Errorf("expanding %q failed: %w", fn, err)
+							}
+
+							if len(configFiles) > 1 {
+								fmt.Fprintf(outputBuffer, "# Configuration %q\n", fn)
+							}
+							if _, err := outputBuffer.Write(out); err != nil {
+								return err
+							}
+						}
+						return nil
+					},
+				},
 				{
 					Name:  "create",
 					Usage: "create a full sample configuration and show it",
@@ -183,24 +286,9 @@ To migrate the file 'mysettings.conf' use
 						)
 
 						// Collect the given configuration files
-						configFiles := cCtx.StringSlice("config")
-						configDir := cCtx.StringSlice("config-directory")
-						for _, fConfigDirectory := range configDir {
-							files, err := config.WalkDirectory(fConfigDirectory)
-							if err != nil {
-								return err
-							}
-							configFiles = append(configFiles, files...)
-						}
-
-						// If no "config" or "config-directory" flag(s) was
-						// provided we should load default configuration files
-						if len(configFiles) == 0 {
-							paths, err := config.GetDefaultConfigPath()
-							if err != nil {
-								return err
-							}
-							configFiles = paths
+						configFiles, err := collectConfigFiles(cCtx)
+						if err != nil {
+							return err
 						}
 
 						for _, fn := range configFiles {
@@ -256,3 +344,25 @@ To migrate the file 'mysettings.conf' use
 		},
 	}
 }
+
+// collectConfigFiles returns the configuration files given via the '--config'
+// and '--config-directory' flags or the default configuration files if no
+// flag is given.
+func collectConfigFiles(cCtx *cli.Context) ([]string, error) {
+	configFiles := cCtx.StringSlice("config")
+	configDir := cCtx.StringSlice("config-directory")
+	for _, fConfigDirectory := range configDir {
+		files, err := config.WalkDirectory(fConfigDirectory)
+		if err != nil {
+			return nil, err
+		}
+		configFiles = append(configFiles, files...)
+	}
+
+	// If no "config" or "config-directory" flag(s) was provided we should
+	// load default configuration files
+	if len(configFiles) == 0 {
+		return config.GetDefaultConfigPath()
+	}
+	return configFiles, nil
+}
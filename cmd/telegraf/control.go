@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/agent"
+)
+
+// controller is the part of the agent controlled via the control API
+type controller interface {
+	Status() []agent.PluginStatus
+	GatherInput(id string) error
+	FlushOutputs(id string) error
+	PauseOutput(id string) error
+	ResumeOutput(id string) error
+}
+
+// ControlServer provides a local HTTP API to inspect and control the running
+// agent. The server only listens on unix sockets or loopback addresses.
+type ControlServer struct {
+	// Function returning the running agent or nil if no agent is running
+	agent func() controller
+	// Function to request a configuration reload
+	reload func()
+	// Accepted values of the 'Host' header to prevent DNS rebinding attacks,
+	// all values are accepted if empty
+	hosts []string
+
+	listener net.Listener
+	server   *http.Server
+}
+
+func NewControlServer(address string, agentFn func() controller, reloadFn func()) (*ControlServer, error) {
+	listener, err := listenControl(address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ControlServer{
+		agent:    agentFn,
+		reload:   reloadFn,
+		listener: listener,
+	}
+
+	// Only accept requests for the configured and the listening address
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		host, _, _ := net.SplitHostPort(address)
+		port := strconv.Itoa(addr.Port)
+		s.hosts = []string{
+			net.JoinHostPort(strings.ToLower(host), port),
+			net.JoinHostPort(addr.IP.String(), port),
+		}
+	}
+	s.server = &http.Server{
+		Handler:      s.handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// listenControl creates a listener for the given address which is either a
+// unix socket in the form "unix:///path/to/socket" or a loopback address in
+// the form "host:port".
+func listenControl(address string) (net.Listener, error) {
+	if path, found := strings.CutPrefix(address, "unix://"); found {
+		// Remove a stale socket of a previous run but never any other file
+		if info, err := os.Lstat(path); err == nil {
+			if info.Mode().Type() != os.ModeSocket {
+				return nil, fmt.Errorf("control socket %q exists and is not a socket", path)
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("removing socket %q failed: %w", path, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("checking socket %q failed: %w", path, err)
+		}
+		return listenUnix(path)
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid control address %q: %w", address, err)
+	}
+
+	// Resolve the address once and listen on the resolved address to make sure
+	// it is a loopback address
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("resolving control address %q failed: %w", address, err)
+	}
+	if addr.IP == nil || !addr.IP.IsLoopback() {
+		return nil, fmt.Errorf("control address %q is not a loopback address", address)
+	}
+	return net.ListenTCP("tcp", addr)
+}
+
+func (s *ControlServer) Start() {
+	log.Printf("I! Starting control API at %s", s.listener.Addr())
+	go func() {
+		if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("E! Control API failed: %v", err)
+		}
+	}()
+}
+
+func (s *ControlServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("E! Stopping control API failed: %v", err)
+	}
+}
+
+func (s *ControlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /plugins", s.handlePlugins)
+	mux.HandleFunc("POST /inputs/{id}/gather", s.handleControl(func(a controller, id string) error {
+		return a.GatherInput(id)
+	}))
+	mux.HandleFunc("POST /outputs/flush", s.handleControl(func(a controller, _ string) error {
+		return a.FlushOutputs("")
+	}))
+	mux.HandleFunc("POST /outputs/{id}/flush", s.handleControl(func(a controller, id string) error {
+		return a.FlushOutputs(id)
+	}))
+	mux.HandleFunc("POST /outputs/{id}/pause", s.handleControl(func(a controller, id string) error {
+		return a.PauseOutput(id)
+	}))
+	mux.HandleFunc("POST /outputs/{id}/resume", s.handleControl(func(a controller, id string) error {
+		return a.ResumeOutput(id)
+	}))
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, _ *http.Request) {
+		s.reload()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return s.protect(mux)
+}
+
+// protect rejects requests for other hosts to prevent DNS rebinding attacks
+// and requires control requests to declare a JSON content-type. Browsers do
+// not send such requests cross-origin without a CORS preflight request, which
+// is never granted, preventing cross-site request forgery.
+func (s *ControlServer) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.hosts) > 0 && !slices.Contains(s.hosts, strings.ToLower(r.Host)) {
+			http.Error(w, "invalid host", http.StatusForbidden)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediatype != "application/json" {
+				http.Error(w, "content-type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *ControlServer) handlePlugins(w http.ResponseWriter, _ *http.Request) {
+	a := s.agent()
+	if a == nil {
+		http.Error(w, "agent is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.Status()); err != nil {
+		log.Printf("E! Writing control API response failed: %v", err)
+	}
+}
+
+func (s *ControlServer) handleControl(fn func(controller, string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := s.agent()
+		if a == nil {
+			http.Error(w, "agent is not running", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := fn(a, r.PathValue("id")); err != nil {
+			code := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, agent.ErrPluginNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, agent.ErrNotRunning):
+				code = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
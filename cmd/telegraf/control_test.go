@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/agent"
+)
+
+func TestControlServer(t *testing.T) {
+	ctrl := &mockController{}
+	var reloads int
+	s := &ControlServer{
+		agent:  func() controller { return ctrl },
+		reload: func() { reloads++ },
+	}
+	handler := s.handler()
+
+	tests := []struct {
+		method   string
+		path     string
+		expected int
+		call     string
+	}{
+		{method: http.MethodGet, path: "/plugins", expected: http.StatusOK},
+		{method: http.MethodPost, path: "/inputs/abc/gather", expected: http.StatusAccepted, call: "gather abc"},
+		{method: http.MethodPost, path: "/inputs/unknown/gather", expected: http.StatusNotFound, call: "gather unknown"},
+		{method: http.MethodPost, path: "/outputs/flush", expected: http.StatusAccepted, call: "flush "},
+		{method: http.MethodPost, path: "/outputs/abc/flush", expected: http.StatusAccepted, call: "flush abc"},
+		{method: http.MethodPost, path: "/outputs/abc/pause", expected: http.StatusAccepted, call: "pause abc"},
+		{method: http.MethodPost, path: "/outputs/abc/resume", expected: http.StatusAccepted, call: "resume abc"},
+		{method: http.MethodGet, path: "/outputs/abc/pause", expected: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/reload", expected: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			ctrl.calls = nil
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tt.expected, rec.Code, rec.Body.String())
+			if tt.call != "" {
+				require.Equal(t, []string{tt.call}, ctrl.calls)
+			}
+		})
+	}
+	require.Equal(t, 1, reloads)
+
+	// Check the status response
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plugins", nil))
+	var status []agent.PluginStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, ctrl.Status(), status)
+
+	// No agent running
+	s.agent = func() controller { return nil }
+	rec = httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plugins", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestControlServerProtection(t *testing.T) {
+	ctrl := &mockController{}
+	s := &ControlServer{
+		agent: func() controller { return ctrl },
+		hosts: []string{"localhost:6061", "127.0.0.1:6061"},
+	}
+	handler := s.handler()
+
+	tests := []struct {
+		name        string
+		method      string
+		host        string
+		contentType string
+		expected    int
+	}{
+		{name: "status", method: http.MethodGet, host: "localhost:6061", expected: http.StatusOK},
+		{name: "ip address", method: http.MethodGet, host: "127.0.0.1:6061", expected: http.StatusOK},
+		{name: "case insensitive", method: http.MethodGet, host: "LocalHost:6061", expected: http.StatusOK},
+		{name: "rebinding", method: http.MethodGet, host: "attacker.example.com:6061", expected: http.StatusForbidden},
+		{name: "other port", method: http.MethodGet, host: "localhost:8080", expected: http.StatusForbidden},
+		{name: "json", method: http.MethodPost, host: "localhost:6061", contentType: "application/json", expected: http.StatusAccepted},
+		{
+			name:        "json with charset",
+			method:      http.MethodPost,
+			host:        "localhost:6061",
+			contentType: "application/json; charset=utf-8",
+			expected:    http.StatusAccepted,
+		},
+		{name: "no content-type", method: http.MethodPost, host: "localhost:6061", expected: http.StatusUnsupportedMediaType},
+		{name: "form", method: http.MethodPost, host: "localhost:6061", contentType: "text/plain", expected: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/plugins"
+			if tt.method == http.MethodPost {
+				path = "/outputs/abc/pause"
+			}
+			req := httptest.NewRequest(tt.method, path, nil)
+			req.Host = tt.host
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tt.expected, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestControlServerHosts(t *testing.T) {
+	s, err := NewControlServer("localhost:0", func() controller { return nil }, func() {})
+	if err != nil {
+		t.Skipf("cannot listen on localhost: %v", err)
+	}
+	defer s.listener.Close()
+
+	addr := s.listener.Addr().(*net.TCPAddr)
+	require.True(t, addr.IP.IsLoopback())
+	port := strconv.Itoa(addr.Port)
+	require.Equal(t, []string{"localhost:" + port, net.JoinHostPort(addr.IP.String(), port)}, s.hosts)
+}
+
+func TestControlAddress(t *testing.T) {
+	for _, address := range []string{"localhost:0", "127.0.0.1:0", "[::1]:0"} {
+		t.Run(address, func(t *testing.T) {
+			listener, err := listenControl(address)
+			if err != nil {
+				t.Skipf("cannot listen on %s: %v", address, err)
+			}
+			require.NoError(t, listener.Close())
+		})
+	}
+
+	// Unix sockets are only accessible by the owner
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	listener, err := listenControl("unix://" + socket)
+	require.NoError(t, err)
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	require.NoError(t, listener.Close())
+
+	// Other files are never removed
+	file := filepath.Join(t.TempDir(), "control.sock")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	_, err = listenControl("unix://" + file)
+	require.ErrorContains(t, err, "is not a socket")
+	require.FileExists(t, file)
+
+	for _, address := range []string{"0.0.0.0:6061", ":6061", "example.com:6061", "localhost"} {
+		t.Run(address, func(t *testing.T) {
+			_, err := listenControl(address)
+			require.Error(t, err)
+		})
+	}
+}
+
+type mockController struct {
+	calls []string
+}
+
+func (*mockController) Status() []agent.PluginStatus {
+	return []agent.PluginStatus{
+		{ID: "abc", Type: "input", Name: "cpu", Status: "running"},
+		{
+			ID:        "def",
+			Type:      "output",
+			Name:      "file",
+			Status:    "paused",
+			Buffer:    &agent.BufferStatus{Length: 10, Limit: 100},
+			LastError: "failed",
+		},
+	}
+}
+
+func (m *mockController) GatherInput(id string) error {
+	m.calls = append(m.calls, "gather "+id)
+	if id == "unknown" {
+		return fmt.Errorf("%w: input %q", agent.ErrPluginNotFound, id)
+	}
+	return nil
+}
+
+func (m *mockController) FlushOutputs(id string) error {
+	m.calls = append(m.calls, "flush "+id)
+	return nil
+}
+
+func (m *mockController) PauseOutput(id string) error {
+	m.calls = append(m.calls, "pause "+id)
+	return nil
+}
+
+func (m *mockController) ResumeOutput(id string) error {
+	m.calls = append(m.calls, "resume "+id)
+	return nil
+}
@@ -111,6 +111,11 @@ func runApp(args []string, outputBuffer io.Writer, pprof Server, c TelegrafConfi
 			Name:  "config-directory",
 			Usage: "directory containing additional *.conf files",
 		},
+		&cli.StringSliceFlag{
+			Name: "config-public-key",
+			Usage: "require configurations to be signed by the ed25519 public key in the given PEM file, " +
+				"the detached signature is expected next to the configuration with a '.sig' suffix",
+		},
 		&cli.StringFlag{
 			Name: "section-filter",
 			Usage: "filter the sections to print, separator is ':'. " +
@@ -246,14 +251,21 @@ func runApp(args []string, outputBuffer io.Writer, pprof Server, c TelegrafConfi
 			return err
 		}
 
+		if err := config.SetConfigPublicKeys(cCtx.StringSlice("config-public-key")); err != nil {
+			return err
+		}
+
 		filters := processFilterFlags(cCtx)
 
 		g := GlobalFlags{
 			config:                  cCtx.StringSlice("config"),
 			configDir:               cCtx.StringSlice("config-directory"),
 			testWait:                cCtx.Int("test-wait"),
+			traceSample:             cCtx.Int("trace-sample"),
 			configURLRetryAttempts:  cCtx.Int("config-url-retry-attempts"),
 			configURLWatchInterval:  cCtx.Duration("config-url-watch-interval"),
+			controlAddr:             cCtx.String("control-addr"),
+			lastGoodConfig:          cCtx.String("last-good-config"),
 			watchConfig:             cCtx.String("watch-config"),
 			watchInterval:           cCtx.Duration("watch-interval"),
 			watchDebounceInterval:   cCtx.Duration("watch-debounce-interval"),
@@ -263,7 +275,9 @@ func runApp(args []string, outputBuffer io.Writer, pprof Server, c TelegrafConfi
 			oldEnvBehavior:          cCtx.Bool("old-env-behavior"),
 			nonStrictEnvVars:        cCtx.Bool("non-strict-env-handling"),
 			printPluginConfigSource: cCtx.Bool("print-plugin-config-source"),
+			hotReload:               cCtx.Bool("hot-reload"),
 			test:                    cCtx.Bool("test"),
+			trace:                   cCtx.Bool("trace"),
 			debug:                   cCtx.Bool("debug"),
 			once:                    cCtx.Bool("once"),
 			quiet:                   cCtx.Bool("quiet"),
@@ -288,6 +302,7 @@ func runApp(args []string, outputBuffer io.Writer, pprof Server, c TelegrafConfi
 		getSecretStoreCommands(m)...,
 	)
 	commands = append(commands, getPluginCommands(outputBuffer)...)
+	commands = append(commands, getBufferCommands(outputBuffer)...)
 	commands = append(commands, getServiceCommands(outputBuffer)...)
 
 	app := &cli.App{
@@ -307,12 +322,28 @@ func runApp(args []string, outputBuffer io.Writer, pprof Server, c TelegrafConfi
 						"Set to -1 for unlimited attempts.",
 					DefaultText: "3",
 				},
+				&cli.IntFlag{
+					Name:        "trace-sample",
+					Usage:       "trace every n-th metric in trace mode",
+					Value:       1,
+					DefaultText: "1",
+				},
 				//
 				// String flags
 				&cli.StringFlag{
 					Name:  "usage",
 					Usage: "print usage for a plugin, ie, 'telegraf --usage mysql'",
 				},
+				&cli.StringFlag{
+					Name: "control-addr",
+					Usage: "enable the control API on a unix socket (e.g. 'unix:///run/telegraf/control.sock') " +
+						"or loopback address (e.g. 'localhost:6061')",
+				},
+				&cli.StringFlag{
+					Name: "last-good-config",
+					Usage: "file to persist the last configuration started successfully to and to fall back to " +
+						"if loading or starting the configuration fails",
+				},
 				&cli.StringFlag{
 					Name:  "pprof-addr",
 					Usage: "pprof host/IP and port to listen on (e.g. 'localhost:6060')",
@@ -328,6 +359,10 @@ func runApp(args []string, outputBuffer io.Writer, pprof Server, c TelegrafConfi
 					DefaultText: "0s",
 					Value:       0,
 				},
+				&cli.BoolFlag{
+					Name:  "hot-reload",
+					Usage: "only restart the plugins affected by a config change instead of the whole agent",
+				},
 				&cli.StringFlag{
 					Name:  "pidfile",
 					Usage: "file to write our pid to",
@@ -362,6 +397,11 @@ func runApp(args []string, outputBuffer io.Writer, pprof Server, c TelegrafConfi
 					Name:  "unprotected",
 					Usage: "do not protect secrets in memory",
 				},
+				&cli.BoolFlag{
+					Name: "trace",
+					Usage: "enable trace mode: gather metrics once and print the journey of sampled metrics " +
+						"through processors, aggregators and outputs, and exit. Note: Outputs do not write any metric",
+				},
 				&cli.BoolFlag{
 					Name: "test",
 					Usage: "enable test mode: gather metrics, print them out, and exit. " +
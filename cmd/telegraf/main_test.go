@@ -6,15 +6,19 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/outputs"
 )
@@ -427,6 +431,83 @@ func TestCommandConfig(t *testing.T) {
 	}
 }
 
+func TestCommandConfigExpand(t *testing.T) {
+	cfg := `
+[[templates]]
+  name = "server"
+  config = '''
+[[inputs.memcached]]
+  servers = ["{{ .server }}"]
+'''
+
+[[instances]]
+  template = "server"
+  vars = { server = "cache-1:11211" }
+`
+	fn := filepath.Join(t.TempDir(), "telegraf.conf")
+	require.NoError(t, os.WriteFile(fn, []byte(cfg), 0600))
+
+	buf := new(bytes.Buffer)
+	args := os.Args[0:1]
+	args = append(args, "config", "expand", "--config", fn)
+	require.NoError(t, runApp(args, buf, NewMockServer(), NewMockConfig(buf), NewMockTelegraf()))
+
+	expected := "\n# Expanded from template \"server\"\n[[inputs.memcached]]\n  servers = [\"cache-1:11211\"]\n\n"
+	require.Equal(t, expected, buf.String())
+}
+
+func TestCommandBuffer(t *testing.T) {
+	// Create a disk buffer with some metrics
+	dir := t.TempDir()
+	buf, err := models.NewBuffer("test", "abc", "", 0, "disk_write_through", dir, true, models.DiskBufferOptions{})
+	require.NoError(t, err)
+	for i := range 3 {
+		buf.Add(metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(int64(i), 0)))
+	}
+	require.NoError(t, buf.Close())
+
+	// List the buffers
+	out := new(bytes.Buffer)
+	args := append(os.Args[0:1], "buffer", "list", "--buffer-directory", dir)
+	require.NoError(t, runApp(args, out, NewMockServer(), NewMockConfig(out), NewMockTelegraf()))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, []string{"abc", "3", "1970-01-01T00:00:00Z", "1970-01-01T00:00:02Z"}, strings.Fields(lines[1]))
+
+	// Dump the metrics
+	out.Reset()
+	args = append(os.Args[0:1], "buffer", "dump", "--buffer-directory", dir, "--count", "2", "abc")
+	require.NoError(t, runApp(args, out, NewMockServer(), NewMockConfig(out), NewMockTelegraf()))
+	require.Equal(t, "test value=0i 0\ntest value=1i 1000000000\n", out.String())
+
+	// Drop the oldest metric
+	out.Reset()
+	args = append(os.Args[0:1], "buffer", "drop", "--buffer-directory", dir, "--count", "1", "abc")
+	require.NoError(t, runApp(args, out, NewMockServer(), NewMockConfig(out), NewMockTelegraf()))
+
+	// Replay the remaining metrics into a file output and remove them
+	outfile := filepath.Join(t.TempDir(), "replay.out")
+	cfgfile := filepath.Join(t.TempDir(), "replay.conf")
+	cfg := fmt.Sprintf("[[outputs.file]]\n  files = [%q]\n  data_format = \"influx\"\n", outfile)
+	require.NoError(t, os.WriteFile(cfgfile, []byte(cfg), 0600))
+	out.Reset()
+	args = append(os.Args[0:1], "buffer", "replay", "--buffer-directory", dir, "--output-config", cfgfile, "--drop", "abc")
+	require.NoError(t, runApp(args, out, NewMockServer(), NewMockConfig(out), NewMockTelegraf()))
+	require.Contains(t, out.String(), "Wrote 2 metrics")
+
+	actual, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	require.Equal(t, "test value=1i 1000000000\ntest value=2i 2000000000\n", string(actual))
+
+	// The buffer must be empty now
+	out.Reset()
+	args = append(os.Args[0:1], "buffer", "list", "--buffer-directory", dir)
+	require.NoError(t, runApp(args, out, NewMockServer(), NewMockConfig(out), NewMockTelegraf()))
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, []string{"abc", "0", "-", "-"}, strings.Fields(lines[1]))
+}
+
 func TestCommandVersion(t *testing.T) {
 	tests := []struct {
 		Version        string
@@ -551,7 +632,12 @@ func TestFlagsAreSet(t *testing.T) {
 		"--quiet",
 		"--once",
 		"--test-wait", strconv.Itoa(expectedInt),
+		"--trace",
+		"--trace-sample", strconv.Itoa(expectedInt + 1),
 		"--watch-config", expectedString,
+		"--hot-reload",
+		"--control-addr", expectedString,
+		"--last-good-config", expectedString,
 		"--pidfile", expectedString,
 	}
 
@@ -569,6 +655,11 @@ func TestFlagsAreSet(t *testing.T) {
 	require.True(t, m.once)
 	require.True(t, m.quiet)
 	require.Equal(t, expectedInt, m.testWait)
+	require.True(t, m.trace)
+	require.Equal(t, expectedInt+1, m.traceSample)
 	require.Equal(t, expectedString, m.watchConfig)
+	require.True(t, m.hotReload)
+	require.Equal(t, expectedString, m.controlAddr)
+	require.Equal(t, expectedString, m.lastGoodConfig)
 	require.Equal(t, expectedString, m.pidFile)
 }
@@ -9,7 +9,9 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -23,22 +25,31 @@ import (
 	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/logger"
+	"github.com/influxdata/telegraf/models"
 	"github.com/influxdata/telegraf/plugins/aggregators"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/plugins/processors"
 	"github.com/influxdata/telegraf/plugins/secretstores"
+	"github.com/influxdata/telegraf/selfstat"
 )
 
 var stop chan struct{}
 
+// configReloadFailures counts the configuration changes failing to load or to
+// start
+var configReloadFailures = selfstat.Register("agent", "config_reload_failures", make(map[string]string))
+
 type GlobalFlags struct {
 	config                  []string
 	configDir               []string
 	testWait                int
+	traceSample             int
 	configURLRetryAttempts  int
 	configURLWatchInterval  time.Duration
+	controlAddr             string
+	lastGoodConfig          string
 	watchConfig             string
 	watchInterval           time.Duration
 	watchDebounceInterval   time.Duration
@@ -48,7 +59,9 @@ type GlobalFlags struct {
 	oldEnvBehavior          bool
 	nonStrictEnvVars        bool
 	printPluginConfigSource bool
+	hotReload               bool
 	test                    bool
+	trace                   bool
 	debug                   bool
 	once                    bool
 	quiet                   bool
@@ -83,6 +96,15 @@ type Telegraf struct {
 
 	cfg *config.Config
 
+	// The agent currently running and the signal channel of the reload loop
+	// used for hot reloading and controlling the agent
+	agent   *agent.Agent
+	signals chan os.Signal
+	agentMu sync.Mutex
+
+	// Snapshot of the last configuration started successfully
+	lastGood *config.Snapshot
+
 	GlobalFlags
 	WindowFlags
 }
@@ -141,7 +163,17 @@ func (t *Telegraf) GetSecretStore(id string) (telegraf.SecretStore, error) {
 }
 
 func (t *Telegraf) reloadLoop() error {
+	if t.controlAddr != "" {
+		server, err := NewControlServer(t.controlAddr, t.runningAgent, t.requestReload)
+		if err != nil {
+			return fmt.Errorf("starting control API failed: %w", err)
+		}
+		server.Start()
+		defer server.Stop()
+	}
+
 	reloadConfig := false
+	fallback := false
 	reload := make(chan bool, 1)
 	reload <- true
 	for <-reload {
@@ -151,70 +183,273 @@ func (t *Telegraf) reloadLoop() error {
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt, syscall.SIGHUP,
 			syscall.SIGTERM, syscall.SIGINT)
-		if t.watchConfig != "" {
-			for _, fConfig := range t.configFiles {
-				if isURL(fConfig) {
-					continue
-				}
-
-				if _, err := os.Stat(fConfig); err != nil {
-					log.Printf("W! Cannot watch config %s: %s", fConfig, err)
-				} else {
-					go t.watchLocalConfig(ctx, signals, fConfig)
-				}
-			}
-			for _, fConfigDirectory := range t.configDir {
-				if _, err := os.Stat(fConfigDirectory); err != nil {
-					log.Printf("W! Cannot watch config directory %s: %s", fConfigDirectory, err)
-				} else {
-					go t.watchLocalConfig(ctx, signals, fConfigDirectory)
-				}
-			}
-		}
-		if t.configURLWatchInterval > 0 {
-			remoteConfigs := make([]string, 0)
-			for _, fConfig := range t.configFiles {
-				if isURL(fConfig) {
-					remoteConfigs = append(remoteConfigs, fConfig)
-				}
-			}
-			if len(remoteConfigs) > 0 {
-				go t.watchRemoteConfigs(ctx, signals, t.configURLWatchInterval, remoteConfigs)
-			}
-		}
+		t.agentMu.Lock()
+		t.signals = signals
+		t.agentMu.Unlock()
+		stopWatchers := t.startConfigWatchers(ctx, signals)
 		go func() {
-			select {
-			case sig := <-signals:
-				if sig == syscall.SIGHUP {
-					log.Println("I! Reloading Telegraf config")
-					// May need to update the list of known config files
-					// if a delete or create occurred. That way on the reload
-					// we ensure we watch the correct files.
-					if err := t.getConfigFiles(); err != nil {
-						log.Println("E! Error loading config files: ", err)
+			for {
+				select {
+				case sig := <-signals:
+					if sig == syscall.SIGHUP {
+						log.Println("I! Reloading Telegraf config")
+						// May need to update the list of known config files
+						// if a delete or create occurred. That way on the reload
+						// we ensure we watch the correct files.
+						if err := t.getConfigFiles(); err != nil {
+							log.Println("E! Error loading config files: ", err)
+						}
+						if t.hotReload {
+							reloaded, err := t.reloadAgent()
+							if err != nil {
+								t.reloadFailed(err)
+								continue
+							}
+							if reloaded {
+								stopWatchers()
+								stopWatchers = t.startConfigWatchers(ctx, signals)
+								continue
+							}
+						} else if err := t.checkReload(); err != nil {
+							t.reloadFailed(err)
+							continue
+						}
+						<-reload
+						reload <- true
 					}
-					<-reload
-					reload <- true
+					cancel()
+				case err := <-t.pprofErr:
+					log.Printf("E! pprof server failed: %v", err)
+					cancel()
+				case <-stop:
+					cancel()
+				case <-ctx.Done():
 				}
-				cancel()
-			case err := <-t.pprofErr:
-				log.Printf("E! pprof server failed: %v", err)
-				cancel()
-			case <-stop:
-				cancel()
+				stopWatchers()
+				return
 			}
 		}()
 
 		err := t.runAgent(ctx, reloadConfig)
+		cancel()
 		if err != nil && !errors.Is(err, context.Canceled) {
-			return fmt.Errorf("[telegraf] Error running agent: %w", err)
+			// Keep running with the last configuration started successfully
+			// unless this configuration failed as well
+			if fallback {
+				return fmt.Errorf("[telegraf] Error running agent: %w", err)
+			}
+			c, ferr := t.lastKnownGoodConfiguration()
+			if ferr != nil {
+				log.Printf("E! Loading last-known-good configuration failed: %v", ferr)
+				return fmt.Errorf("[telegraf] Error running agent: %w", err)
+			}
+			t.reloadFailed(err)
+			log.Println("W! Falling back to the last-known-good configuration")
+			t.cfg = c
+			reloadConfig = false
+			fallback = true
+			<-reload
+			reload <- true
+			continue
 		}
 		reloadConfig = true
+		fallback = false
 	}
 
 	return nil
 }
 
+// reloadFailed logs and records a configuration change failing to load or
+// to start
+func (*Telegraf) reloadFailed(err error) {
+	log.Printf("E! Applying the changed configuration failed, keeping the previous one: %v", err)
+	configReloadFailures.Incr(1)
+}
+
+// checkReload loads the configuration to detect errors, e.g. syntax errors,
+// before stopping the running agent for a reload
+func (t *Telegraf) checkReload() error {
+	c := t.newConfig()
+
+	// Use the outputs of the running agent to not open output buffers twice
+	t.agentMu.Lock()
+	ag := t.agent
+	t.agentMu.Unlock()
+	var running []*models.RunningOutput
+	if ag != nil {
+		running = ag.Outputs()
+	}
+	c.ReuseOutputs(running)
+	defer func() {
+		for _, o := range c.Outputs {
+			if !slices.Contains(running, o) {
+				o.Discard()
+			}
+		}
+	}()
+
+	if err := c.LoadAll(t.configFiles...); err != nil {
+		return err
+	}
+	return t.checkConfiguration(c)
+}
+
+// lastKnownGoodConfiguration loads the last configuration started
+// successfully either from memory or, if configured, from disk
+func (t *Telegraf) lastKnownGoodConfiguration() (*config.Config, error) {
+	t.agentMu.Lock()
+	snapshot := t.lastGood
+	t.agentMu.Unlock()
+
+	if snapshot == nil {
+		if t.lastGoodConfig == "" {
+			return nil, errors.New("no configuration started successfully")
+		}
+		var err error
+		if snapshot, err = config.LoadSnapshotFile(t.lastGoodConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	c := t.newConfig()
+	if err := c.LoadSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	if err := t.checkConfiguration(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// rememberConfiguration keeps the configuration as last-known-good and
+// persists it if requested
+func (t *Telegraf) rememberConfiguration(c *config.Config) {
+	snapshot := c.Snapshot()
+	t.agentMu.Lock()
+	t.lastGood = snapshot
+	t.agentMu.Unlock()
+
+	if t.lastGoodConfig == "" {
+		return
+	}
+	if err := snapshot.Save(t.lastGoodConfig); err != nil {
+		log.Printf("W! Persisting last-known-good configuration failed: %v", err)
+	}
+}
+
+// startConfigWatchers starts watching the local and remote configuration
+// sources for changes and returns a function to stop the watchers.
+func (t *Telegraf) startConfigWatchers(ctx context.Context, signals chan os.Signal) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	if t.watchConfig != "" {
+		for _, fConfig := range t.configFiles {
+			if config.IsKVSource(fConfig) {
+				go t.watchKVConfig(ctx, signals, fConfig)
+				continue
+			}
+			if isURL(fConfig) {
+				continue
+			}
+
+			if _, err := os.Stat(fConfig); err != nil {
+				log.Printf("W! Cannot watch config %s: %s", fConfig, err)
+			} else {
+				go t.watchLocalConfig(ctx, signals, fConfig)
+			}
+		}
+		for _, fConfigDirectory := range t.configDir {
+			if _, err := os.Stat(fConfigDirectory); err != nil {
+				log.Printf("W! Cannot watch config directory %s: %s", fConfigDirectory, err)
+			} else {
+				go t.watchLocalConfig(ctx, signals, fConfigDirectory)
+			}
+		}
+	}
+	if t.configURLWatchInterval > 0 {
+		remoteConfigs := make([]string, 0)
+		for _, fConfig := range t.configFiles {
+			if isURL(fConfig) && !config.IsKVSource(fConfig) {
+				remoteConfigs = append(remoteConfigs, fConfig)
+			}
+		}
+		if len(remoteConfigs) > 0 {
+			go t.watchRemoteConfigs(ctx, signals, t.configURLWatchInterval, remoteConfigs)
+		}
+	}
+	return cancel
+}
+
+// runningAgent returns the agent currently running or nil
+func (t *Telegraf) runningAgent() controller {
+	t.agentMu.Lock()
+	defer t.agentMu.Unlock()
+	if t.agent == nil {
+		return nil
+	}
+	return t.agent
+}
+
+// requestReload triggers a configuration reload like a SIGHUP signal
+func (t *Telegraf) requestReload() {
+	t.agentMu.Lock()
+	signals := t.signals
+	t.agentMu.Unlock()
+	if signals == nil {
+		return
+	}
+
+	// A pending signal will reload the configuration anyway
+	select {
+	case signals <- syscall.SIGHUP:
+	default:
+	}
+}
+
+// reloadAgent applies the current configuration to the running agent without
+// restarting it. If false is returned the agent must be restarted instead.
+// An error is returned if the configuration is invalid and the running agent
+// should be kept.
+func (t *Telegraf) reloadAgent() (bool, error) {
+	t.agentMu.Lock()
+	ag := t.agent
+	t.agentMu.Unlock()
+	if ag == nil {
+		return false, nil
+	}
+
+	c := t.newConfig()
+	running := ag.Outputs()
+	c.ReuseOutputs(running)
+
+	// Release the new outputs if the configuration is not applied
+	discard := func() {
+		for _, o := range c.Outputs {
+			if !slices.Contains(running, o) {
+				o.Discard()
+			}
+		}
+	}
+	if err := c.LoadAll(t.configFiles...); err != nil {
+		discard()
+		return false, err
+	}
+	if err := t.checkConfiguration(c); err != nil {
+		discard()
+		return false, err
+	}
+
+	if err := ag.Reload(c); err != nil {
+		if errors.Is(err, agent.ErrRestartRequired) {
+			log.Printf("I! Restarting agent as configuration cannot be applied while running: %v", err)
+		} else {
+			log.Printf("E! Reloading configuration failed, restarting agent: %v", err)
+		}
+		return false, nil
+	}
+	t.rememberConfiguration(c)
+	return true, nil
+}
+
 func (t *Telegraf) watchLocalConfig(ctx context.Context, signals chan os.Signal, fConfig string) {
 	var mytomb tomb.Tomb
 	var watcher watch.FileWatcher
@@ -389,15 +624,25 @@ func (*Telegraf) watchRemoteConfigs(ctx context.Context, signals chan os.Signal,
 	}
 }
 
+func (*Telegraf) watchKVConfig(ctx context.Context, signals chan os.Signal, source string) {
+	log.Printf("I! Key-value config watcher started for: %s\n", source)
+	if err := config.WatchKVSource(ctx, source); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("E! Watching key-value config %s failed: %v\n", source, err)
+		}
+		return
+	}
+
+	log.Printf("I! Key-value config modified: %s\n", source)
+	select {
+	case signals <- syscall.SIGHUP:
+	case <-ctx.Done():
+	}
+}
+
 func (t *Telegraf) loadConfiguration() (*config.Config, error) {
 	// If no other options are specified, load the config file and run.
-	c := config.NewConfig()
-	c.Agent.Quiet = t.quiet
-	c.Agent.ConfigURLRetryAttempts = t.configURLRetryAttempts
-	c.OutputFilters = t.outputFilters
-	c.InputFilters = t.inputFilters
-	c.SecretStoreFilters = t.secretstoreFilters
-
+	c := t.newConfig()
 	if err := t.getConfigFiles(); err != nil {
 		return c, err
 	}
@@ -407,6 +652,41 @@ func (t *Telegraf) loadConfiguration() (*config.Config, error) {
 	return c, nil
 }
 
+// loadInitialConfiguration loads the configuration at startup and falls back
+// to the persisted last-known-good configuration if loading fails
+func (t *Telegraf) loadInitialConfiguration() (*config.Config, error) {
+	c, err := t.loadConfiguration()
+	if err == nil || t.lastGoodConfig == "" {
+		return c, err
+	}
+
+	// Release the outputs of the failed configuration as their buffers,
+	// e.g. the disk buffers, are reopened by the last-known-good one
+	for _, o := range c.Outputs {
+		o.Discard()
+	}
+	fc, ferr := t.lastKnownGoodConfiguration()
+	if ferr != nil {
+		log.Printf("E! Loading last-known-good configuration failed: %v", ferr)
+		return c, err
+	}
+	log.Printf("E! Loading config failed, falling back to the last-known-good configuration: %v", err)
+	configReloadFailures.Incr(1)
+	return fc, nil
+}
+
+// newConfig returns an empty configuration with the settings given on the
+// command line
+func (t *Telegraf) newConfig() *config.Config {
+	c := config.NewConfig()
+	c.Agent.Quiet = t.quiet
+	c.Agent.ConfigURLRetryAttempts = t.configURLRetryAttempts
+	c.OutputFilters = t.outputFilters
+	c.InputFilters = t.inputFilters
+	c.SecretStoreFilters = t.secretstoreFilters
+	return c
+}
+
 func (t *Telegraf) getConfigFiles() error {
 	var configFiles []string
 
@@ -436,24 +716,23 @@ func (t *Telegraf) runAgent(ctx context.Context, reloadConfig bool) error {
 	c := t.cfg
 	var err error
 	if reloadConfig {
-		if c, err = t.loadConfiguration(); err != nil {
-			return err
-		}
-	}
-
-	if !t.test && t.testWait == 0 && len(c.Outputs) == 0 {
-		return errors.New("no outputs found, probably invalid config file provided")
-	}
-	if t.plugindDir == "" && len(c.Inputs) == 0 {
-		return errors.New("no inputs found, probably invalid config file provided")
+		c, err = t.loadConfiguration()
 	}
 
-	if int64(c.Agent.Interval) <= 0 {
-		return fmt.Errorf("agent interval must be positive, found %v", c.Agent.Interval)
+	// Release the outputs not closed by the agent, e.g. if the configuration
+	// fails, before falling back to the last-known-good configuration
+	// reopening their buffers
+	defer func() {
+		for _, o := range c.Outputs {
+			o.Discard()
+		}
+	}()
+	if err != nil {
+		return err
 	}
 
-	if int64(c.Agent.FlushInterval) <= 0 {
-		return fmt.Errorf("agent flush_interval must be positive; found %v", c.Agent.Interval)
+	if err := t.checkConfiguration(c); err != nil {
+		return err
 	}
 
 	// Setup logging as configured.
@@ -487,7 +766,9 @@ func (t *Telegraf) runAgent(ctx context.Context, reloadConfig bool) error {
 	log.Printf("I! Loaded aggregators: %s\n%s", strings.Join(c.AggregatorNames(), " "), c.AggregatorNamesWithSources())
 	log.Printf("I! Loaded processors: %s\n%s", strings.Join(c.ProcessorNames(), " "), c.ProcessorNamesWithSources())
 	log.Printf("I! Loaded secretstores: %s\n%s", strings.Join(c.SecretstoreNames(), " "), c.SecretstoreNamesWithSources())
-	if !t.once && (t.test || t.testWait != 0) {
+	if t.trace {
+		log.Print("W! " + color.RedString("Outputs do not write any metric in trace mode!"))
+	} else if !t.once && (t.test || t.testWait != 0) {
 		log.Print("W! " + color.RedString("Outputs are not used in testing mode!"))
 	} else {
 		log.Printf("I! Loaded outputs: %s\n%s", strings.Join(c.OutputNames(), " "), c.OutputNamesWithSources())
@@ -532,6 +813,14 @@ func (t *Telegraf) runAgent(ctx context.Context, reloadConfig bool) error {
 	//nolint:errcheck // see above
 	daemon.SdNotify(false, daemon.SdNotifyReady)
 
+	if t.trace {
+		if t.traceSample < 1 {
+			return fmt.Errorf("invalid trace sample %d, must be positive", t.traceSample)
+		}
+		wait := time.Duration(t.testWait) * time.Second
+		return ag.Trace(ctx, wait, uint64(t.traceSample))
+	}
+
 	if t.once {
 		wait := time.Duration(t.testWait) * time.Second
 		return ag.Once(ctx, wait)
@@ -563,9 +852,46 @@ func (t *Telegraf) runAgent(ctx context.Context, reloadConfig bool) error {
 		}
 	}
 
+	t.agentMu.Lock()
+	t.agent = ag
+	t.agentMu.Unlock()
+	defer func() {
+		t.agentMu.Lock()
+		t.agent = nil
+		t.agentMu.Unlock()
+	}()
+
+	// Keep the configuration as last-known-good once all plugins started
+	go func() {
+		select {
+		case <-ag.Started():
+			t.rememberConfiguration(c)
+		case <-ctx.Done():
+		}
+	}()
+
 	return ag.Run(ctx)
 }
 
+// checkConfiguration checks the settings required to run the agent
+func (t *Telegraf) checkConfiguration(c *config.Config) error {
+	if !t.test && !t.trace && t.testWait == 0 && len(c.Outputs) == 0 {
+		return errors.New("no outputs found, probably invalid config file provided")
+	}
+	if t.plugindDir == "" && len(c.Inputs) == 0 {
+		return errors.New("no inputs found, probably invalid config file provided")
+	}
+
+	if int64(c.Agent.Interval) <= 0 {
+		return fmt.Errorf("agent interval must be positive, found %v", c.Agent.Interval)
+	}
+
+	if int64(c.Agent.FlushInterval) <= 0 {
+		return fmt.Errorf("agent flush_interval must be positive; found %v", c.Agent.Interval)
+	}
+	return nil
+}
+
 // isURL checks if string is valid url
 func isURL(str string) bool {
 	u, err := url.Parse(str)
@@ -4,6 +4,7 @@ package main
 
 import (
 	"log"
+	"net"
 	"runtime"
 	"syscall"
 )
@@ -12,7 +13,7 @@ func (t *Telegraf) Run() error {
 	stop = make(chan struct{})
 	defer close(stop)
 
-	cfg, err := t.loadConfiguration()
+	cfg, err := t.loadInitialConfiguration()
 	if err != nil {
 		return err
 	}
@@ -40,3 +41,13 @@ func getLockedMemoryLimit() uint64 {
 	//nolint:unconvert // required for e.g. FreeBSD that has the field as int64
 	return uint64(limit.Max)
 }
+
+// listenUnix creates a unix socket only accessible by the owner. The socket
+// is created with a restrictive umask to never be accessible by others, not
+// even for a short time.
+func listenUnix(path string) (net.Listener, error) {
+	umask := syscall.Umask(0o177)
+	defer syscall.Umask(umask)
+
+	return net.Listen("unix", path)
+}
@@ -224,3 +224,42 @@ func TestLoadConfigurationsPermissions(t *testing.T) {
 		})
 	}
 }
+
+func TestLastKnownGoodConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "telegraf.conf")
+	snapshot := filepath.Join(dir, "last-good.json")
+	require.NoError(t, os.WriteFile(cfg, []byte("[[inputs.cpu]]\n[[outputs.discard]]\n"), 0600))
+
+	// Define a version to prevent Telegraf startup failure
+	savedVersion := internal.Version
+	internal.Version = "0.0.0"
+	defer func() {
+		internal.Version = savedVersion
+	}()
+
+	// Remember the configuration started successfully
+	agent := &Telegraf{GlobalFlags: GlobalFlags{config: []string{cfg}, lastGoodConfig: snapshot}}
+	c, err := agent.loadInitialConfiguration()
+	require.NoError(t, err)
+	agent.rememberConfiguration(c)
+	require.FileExists(t, snapshot)
+
+	// Push a broken configuration
+	require.NoError(t, os.WriteFile(cfg, []byte("[[inputs.cpu]\n"), 0600))
+	require.Error(t, agent.checkReload())
+
+	// Fall back to the persisted configuration when starting
+	failures := configReloadFailures.Get()
+	agent = &Telegraf{GlobalFlags: GlobalFlags{config: []string{cfg}, lastGoodConfig: snapshot}}
+	c, err = agent.loadInitialConfiguration()
+	require.NoError(t, err)
+	require.Equal(t, []string{"cpu"}, c.InputNames())
+	require.Equal(t, []string{"discard"}, c.OutputNames())
+	require.Equal(t, failures+1, configReloadFailures.Get())
+
+	// Fail without a persisted configuration
+	agent = &Telegraf{GlobalFlags: GlobalFlags{config: []string{cfg}}}
+	_, err = agent.loadInitialConfiguration()
+	require.Error(t, err)
+}
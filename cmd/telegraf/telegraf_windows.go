@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -89,7 +90,7 @@ func (t *Telegraf) Run() error {
 	}
 
 	// Load the configuration file(s)
-	cfg, err := t.loadConfiguration()
+	cfg, err := t.loadInitialConfiguration()
 	if err != nil {
 		return err
 	}
@@ -120,7 +121,7 @@ func (t *Telegraf) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<
 	svclog.Info(eventID, fmt.Sprintf("Starting Telegraf %s...", internal.Version))
 
 	// Load the configuration file(s)
-	cfg, err := t.loadConfiguration()
+	cfg, err := t.loadInitialConfiguration()
 	if err != nil {
 		//nolint:errcheck // We have no way to route the error to the user so ignore it
 		svclog.Error(eventID, err.Error())
@@ -426,3 +427,9 @@ func stateDescription(state svc.State) string {
 	}
 	return fmt.Sprintf("unknown %v", state)
 }
+
+// listenUnix creates a unix socket. Windows ignores the file permissions of
+// sockets so access is controlled by the permissions of the directory.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -109,6 +109,21 @@ type Config struct {
 
 	Persister *persister.Persister
 
+	// AgentID identifies the agent settings and changes whenever any setting
+	// of the agent table changes.
+	AgentID string
+
+	// Running outputs used instead of new instances, see ReuseOutputs
+	reusableOutputs map[string][]*models.RunningOutput
+	reusedOutputs   map[*models.RunningOutput]bool
+
+	// Information collected while loading for linting the configuration
+	ignoredDataFormats []LintIssue
+	usedSecretStores   map[string]bool
+
+	// Data of all loaded configuration sources, see Snapshot
+	loaded []SnapshotSource
+
 	NumberSecrets uint64
 
 	seenAgentTable     bool
@@ -219,6 +234,11 @@ type AgentConfig struct {
 	// ie, a jitter of 5s and interval 10s means flushes will happen every 10-15s
 	FlushJitter Duration
 
+	// BandwidthLimit is the maximum number of bytes per second written by
+	// all outputs together. Outputs with a higher "priority" are served first.
+	// Zero means no limit.
+	BandwidthLimit Size `toml:"bandwidth_limit"`
+
 	// MetricBatchSize is the maximum number of metrics that is written to an
 	// output plugin in one call.
 	MetricBatchSize int
@@ -280,6 +300,10 @@ type AgentConfig struct {
 	// the state in the file will be restored for the plugins.
 	Statefile string `toml:"statefile"`
 
+	// Interval for periodically writing the state file while running. By
+	// default the states are only written on termination of Telegraf.
+	StatefileCheckpointInterval Duration `toml:"statefile_checkpoint_interval"`
+
 	// Flag to always keep tags explicitly defined in the plugin itself and
 	// ensure those tags always pass filtering.
 	AlwaysIncludeLocalTags bool `toml:"always_include_local_tags"`
@@ -298,11 +322,13 @@ type AgentConfig struct {
 	ConfigURLRetryAttempts int `toml:"config_url_retry_attempts"`
 
 	// BufferStrategy is the metric buffer type to use for a given output plugin.
-	// Supported types currently are "memory" and "disk_write_through" (alias: "disk").
+	// Supported types currently are "memory", "disk_write_through" (alias: "disk")
+	// and "memory_spill".
 	BufferStrategy string `toml:"buffer_strategy"`
 
 	// BufferDirectory is the directory to store buffer files for serialized
-	// to disk metrics when using the "disk_write_through" buffer strategy.
+	// to disk metrics when using the "disk_write_through" or "memory_spill"
+	// buffer strategy.
 	BufferDirectory string `toml:"buffer_directory"`
 
 	// BufferDiskSync controls writes durability when "disk" buffer strategy
@@ -310,6 +336,30 @@ type AgentConfig struct {
 	// metrics buffered in the last `flush_interval` in the event of a power
 	// cut.
 	BufferDiskSync *bool `toml:"buffer_disk_sync"`
+
+	// BufferDiskMaxSize is the maximum size of the serialized metrics kept in
+	// the "disk" buffer of each output. Zero means no limit.
+	BufferDiskMaxSize Size `toml:"buffer_disk_max_size"`
+
+	// BufferDiskOverflowPolicy controls the handling of new metrics if the
+	// "disk" buffer reached "buffer_disk_max_size". Supported policies are
+	// "drop_oldest" (default), "drop_newest" and "block_inputs".
+	BufferDiskOverflowPolicy string `toml:"buffer_disk_overflow_policy"`
+
+	// BufferDiskCorruptionRecovery controls the handling of corrupt "disk"
+	// buffer files on startup. Supported modes are "error" (default),
+	// "truncate" and "quarantine".
+	BufferDiskCorruptionRecovery string `toml:"buffer_disk_corruption_recovery"`
+
+	// BufferDiskCompression is the compression applied to the metrics
+	// persisted by the "disk" buffer. Supported algorithms are "none"
+	// (default), "zstd", "snappy", "gzip" and "zlib".
+	BufferDiskCompression string `toml:"buffer_disk_compression"`
+
+	// BufferDiskEncryptionKey is the hex-encoded AES key used to encrypt the
+	// metrics persisted by the "disk" buffer. The key should be referenced
+	// from a secret-store. Encryption is disabled if no key is given.
+	BufferDiskEncryptionKey Secret `toml:"buffer_disk_encryption_key"`
 }
 
 // InputNames returns a list of strings of the configured inputs.
@@ -557,12 +607,24 @@ func (c *Config) LoadConfig(path string) error {
 		log.Printf("I! Loading config: %s", path)
 	}
 
+	if IsKVSource(path) {
+		if err := c.loadKVConfig(path); err != nil {
+			return fmt.Errorf("loading config %s failed: %w", path, err)
+		}
+		return nil
+	}
+
 	data, _, err := LoadConfigFileWithRetries(path, c.Agent.ConfigURLRetryAttempts)
 	if err != nil {
 		return fmt.Errorf("loading config file %s failed: %w", path, err)
 	}
 
-	if err = c.LoadConfigData(data, path); err != nil {
+	signature, err := verifyConfig(path, data, c.Agent.ConfigURLRetryAttempts)
+	if err != nil {
+		return fmt.Errorf("loading config file %s failed: %w", path, err)
+	}
+
+	if err = c.loadConfigData(data, path, signature); err != nil {
 		return fmt.Errorf("loading config file %s failed: %w", path, err)
 	}
 
@@ -575,12 +637,21 @@ func (c *Config) LoadAll(configFiles ...string) error {
 			return err
 		}
 	}
+	return c.finishLoading()
+}
 
+// finishLoading completes the configuration after loading all sources
+func (c *Config) finishLoading() error {
 	// Sort the processors according to their `order` setting while
 	// using a stable sort to keep the file loading / file position order.
 	sort.Stable(c.Processors)
 	sort.Stable(c.AggProcessors)
 
+	// Connect the outputs to their dead-letter outputs
+	if err := c.linkDeadLetterOutputs(); err != nil {
+		return err
+	}
+
 	// Set snmp agent translator default
 	if c.Agent.SnmpTranslator == "" {
 		c.Agent.SnmpTranslator = "netsnmp"
@@ -612,11 +683,30 @@ func WithSourcePath(path string) cfgDataOption {
 
 // LoadConfigData loads TOML-formatted config data
 func (c *Config) LoadConfigData(data []byte, path string) error {
+	return c.loadConfigData(data, path, nil)
+}
+
+// loadConfigData loads TOML-formatted config data and records the data
+// together with its verified signature, if any, for snapshots
+func (c *Config) loadConfigData(data []byte, path string, signature []byte) error {
+	c.loaded = append(c.loaded, SnapshotSource{Path: path, Data: bytes.Clone(data), Signature: signature})
+
 	tbl, err := parseConfig(data)
 	if err != nil {
 		return fmt.Errorf("error parsing data: %w", err)
 	}
 
+	// Expand the template instances and parse the resulting configuration
+	if usesTemplates(tbl) {
+		expanded, err := ExpandTemplates(data)
+		if err != nil {
+			return fmt.Errorf("error expanding templates: %w", err)
+		}
+		if tbl, err = parseExpandedConfig(expanded); err != nil {
+			return fmt.Errorf("error parsing expanded data: %w", err)
+		}
+	}
+
 	// Parse tags tables first:
 	for _, tableName := range []string{"tags", "global_tags"} {
 		if val, ok := tbl.Fields[tableName]; ok {
@@ -646,6 +736,9 @@ func (c *Config) LoadConfigData(data []byte, path string) error {
 		if err = c.toml.UnmarshalTable(subTable, c.Agent); err != nil {
 			return fmt.Errorf("error parsing [agent]: %w", err)
 		}
+		if c.AgentID, err = generatePluginID("agent"+c.AgentID, subTable); err != nil {
+			return fmt.Errorf("error generating ID for [agent]: %w", err)
+		}
 		if c.Agent.CollectionOffset < 0 {
 			return fmt.Errorf("agent collection_offset must not be negative, found %v", c.Agent.CollectionOffset)
 		}
@@ -909,28 +1002,41 @@ func fetchConfig(u *url.URL, urlRetryAttempts int) ([]byte, error) {
 	req.Header.Add("Accept", "application/toml")
 	req.Header.Set("User-Agent", internal.ProductToken())
 
+	var body []byte
+	err = retryFetch("HTTP config", urlRetryAttempts, func() error {
+		var err error
+		body, err = requestURLConfig(req)
+		return err
+	})
+	return body, err
+}
+
+// retryFetch calls the fetch function until it succeeds or the number of
+// attempts is exhausted. A value of -1 retries forever while zero uses the
+// default of three retries.
+func retryFetch(what string, urlRetryAttempts int, fetch func() error) error {
 	var totalAttempts int
 	if urlRetryAttempts == -1 {
 		totalAttempts = -1
-		log.Printf("Using unlimited number of attempts to fetch HTTP config")
+		log.Printf("Using unlimited number of attempts to fetch %s", what)
 	} else if urlRetryAttempts == 0 {
 		totalAttempts = 3
 	} else if urlRetryAttempts > 0 {
 		totalAttempts = urlRetryAttempts
 	} else {
-		return nil, fmt.Errorf("invalid number of attempts: %d", urlRetryAttempts)
+		return fmt.Errorf("invalid number of attempts: %d", urlRetryAttempts)
 	}
 
 	attempt := 0
 	for {
-		body, err := requestURLConfig(req)
+		err := fetch()
 		if err == nil {
-			return body, nil
+			return nil
 		}
 
-		log.Printf("Error getting HTTP config (attempt %d of %d): %s", attempt, totalAttempts, err)
+		log.Printf("Error getting %s (attempt %d of %d): %s", what, attempt, totalAttempts, err)
 		if urlRetryAttempts != -1 && attempt >= totalAttempts {
-			return nil, err
+			return err
 		}
 
 		time.Sleep(httpLoadConfigRetryInterval)
@@ -981,6 +1087,16 @@ func parseConfig(contents []byte) (*ast.Table, error) {
 	return substituteEnvironmentStrict(contents, OldEnvVarReplacement)
 }
 
+// parseExpandedConfig parses a configuration returned by ExpandTemplates. In
+// non-strict mode, the environment variables were already substituted when
+// expanding and are not substituted a second time.
+func parseExpandedConfig(contents []byte) (*ast.Table, error) {
+	if NonStrictEnvVarHandling {
+		return toml.Parse(contents)
+	}
+	return parseConfig(contents)
+}
+
 func (c *Config) addAggregator(name, source string, table *ast.Table) error {
 	enabled, err := c.matchesLabelSelection(table)
 	if err != nil {
@@ -1005,6 +1121,7 @@ func (c *Config) addAggregator(name, source string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	c.checkDataFormat("aggregators", name, source, table, false)
 
 	if err := c.toml.UnmarshalTable(table, aggregator); err != nil {
 		return err
@@ -1092,6 +1209,10 @@ func (c *Config) LinkSecrets() error {
 			if !found {
 				return fmt.Errorf("unknown secret-store for %q", ref)
 			}
+			if c.usedSecretStores == nil {
+				c.usedSecretStores = make(map[string]bool)
+			}
+			c.usedSecretStores[storeID] = true
 			resolver, err := store.GetResolver(key)
 			if err != nil {
 				return fmt.Errorf("retrieving resolver for %q failed: %w", ref, err)
@@ -1246,6 +1367,7 @@ func (c *Config) addProcessor(name, source string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	c.checkDataFormat("processors", name, source, table, count > 0)
 	rf := models.NewRunningProcessor(processorBefore, processorBeforeConfig)
 	c.fileProcessors = append(c.fileProcessors, &OrderedPlugin{table.Line, rf})
 
@@ -1398,6 +1520,7 @@ func (c *Config) addOutput(name, source string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	c.checkDataFormat("outputs", name, source, table, missThreshold > 0)
 
 	if err := c.toml.UnmarshalTable(table, output); err != nil {
 		return err
@@ -1423,6 +1546,14 @@ func (c *Config) addOutput(name, source string, table *ast.Table) error {
 		}
 	}
 
+	// Use the running instance of unchanged outputs
+	if candidates := c.reusableOutputs[outputConfig.ID]; len(candidates) > 0 {
+		c.reusableOutputs[outputConfig.ID] = candidates[1:]
+		c.reusedOutputs[candidates[0]] = true
+		c.Outputs = append(c.Outputs, candidates[0])
+		return nil
+	}
+
 	ro, err := models.NewRunningOutput(output, outputConfig, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
 	if err != nil {
 		return err
@@ -1432,6 +1563,19 @@ func (c *Config) addOutput(name, source string, table *ast.Table) error {
 	return nil
 }
 
+// ReuseOutputs makes the configuration use the given running outputs instead
+// of creating new instances for outputs with the same ID. This is required
+// when loading a configuration to be applied to a running agent as otherwise
+// the buffers of unchanged outputs would be opened twice. The function must be
+// called before loading the configuration.
+func (c *Config) ReuseOutputs(outputs []*models.RunningOutput) {
+	c.reusableOutputs = make(map[string][]*models.RunningOutput, len(outputs))
+	c.reusedOutputs = make(map[*models.RunningOutput]bool, len(outputs))
+	for _, output := range outputs {
+		c.reusableOutputs[output.Config.ID] = append(c.reusableOutputs[output.Config.ID], output)
+	}
+}
+
 func (c *Config) addInput(name, source string, table *ast.Table) error {
 	if len(c.InputFilters) > 0 && !sliceContains(name, c.InputFilters) {
 		return nil
@@ -1493,6 +1637,7 @@ func (c *Config) addInput(name, source string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	c.checkDataFormat("inputs", name, source, table, missCountThreshold > 0)
 
 	if err := c.toml.UnmarshalTable(table, input); err != nil {
 		return err
@@ -1552,6 +1697,7 @@ func (c *Config) buildAggregator(name, source string, tbl *ast.Table) (*models.A
 	conf.MeasurementSuffix = c.getFieldString(tbl, "name_suffix")
 	conf.NameOverride = c.getFieldString(tbl, "name_override")
 	conf.Alias = c.getFieldString(tbl, "alias")
+	conf.Pipeline = c.getFieldString(tbl, "pipeline")
 	conf.LogLevel = c.getFieldString(tbl, "log_level")
 
 	conf.Tags = make(map[string]string)
@@ -1589,6 +1735,7 @@ func (c *Config) buildProcessor(category, name, source string, tbl *ast.Table) (
 
 	conf.Order = c.getFieldInt64(tbl, "order")
 	conf.Alias = c.getFieldString(tbl, "alias")
+	conf.Pipeline = c.getFieldString(tbl, "pipeline")
 	conf.LogLevel = c.getFieldString(tbl, "log_level")
 
 	if c.hasErrs() {
@@ -1711,6 +1858,7 @@ func (c *Config) buildInput(name, source string, tbl *ast.Table) (*models.InputC
 	cp.MeasurementSuffix = c.getFieldString(tbl, "name_suffix")
 	cp.NameOverride = c.getFieldString(tbl, "name_override")
 	cp.Alias = c.getFieldString(tbl, "alias")
+	cp.Pipeline = c.getFieldString(tbl, "pipeline")
 	cp.LogLevel = c.getFieldString(tbl, "log_level")
 
 	cp.Tags = make(map[string]string)
@@ -1757,12 +1905,29 @@ func (c *Config) buildOutput(name, source string, tbl *ast.Table) (*models.Outpu
 	}
 
 	oc := &models.OutputConfig{
-		Name:            name,
-		Source:          source,
-		Filter:          filter,
-		BufferStrategy:  bufferStrategy,
-		BufferDirectory: c.Agent.BufferDirectory,
-		BufferDiskSync:  bufferDiskSync,
+		Name:                         name,
+		Source:                       source,
+		Filter:                       filter,
+		BufferStrategy:               bufferStrategy,
+		BufferDirectory:              c.Agent.BufferDirectory,
+		BufferDiskSync:               bufferDiskSync,
+		BufferDiskMaxSize:            int64(c.Agent.BufferDiskMaxSize),
+		BufferDiskOverflowPolicy:     c.Agent.BufferDiskOverflowPolicy,
+		BufferDiskCorruptionRecovery: c.Agent.BufferDiskCorruptionRecovery,
+		BufferDiskCompression:        c.Agent.BufferDiskCompression,
+	}
+
+	// Resolve the encryption key on first use as secrets are not linked yet
+	if !c.Agent.BufferDiskEncryptionKey.Empty() {
+		key := &c.Agent.BufferDiskEncryptionKey
+		oc.BufferDiskEncryptionKey = func() ([]byte, error) {
+			secret, err := key.Get()
+			if err != nil {
+				return nil, err
+			}
+			defer secret.Destroy()
+			return bytes.Clone(secret.Bytes()), nil
+		}
 	}
 
 	// TODO: support FieldPass/FieldDrop on outputs
@@ -1772,18 +1937,44 @@ func (c *Config) buildOutput(name, source string, tbl *ast.Table) (*models.Outpu
 	oc.MetricBufferLimit = c.getFieldInt(tbl, "metric_buffer_limit")
 	oc.MetricBatchSize = c.getFieldInt(tbl, "metric_batch_size")
 	oc.Alias = c.getFieldString(tbl, "alias")
+	oc.Pipeline = c.getFieldString(tbl, "pipeline")
 	oc.NameOverride = c.getFieldString(tbl, "name_override")
 	oc.NameSuffix = c.getFieldString(tbl, "name_suffix")
 	oc.NamePrefix = c.getFieldString(tbl, "name_prefix")
 	oc.StartupErrorBehavior = c.getFieldString(tbl, "startup_error_behavior")
 	oc.LogLevel = c.getFieldString(tbl, "log_level")
+	oc.Priority = c.getFieldInt(tbl, "priority")
+	if size, ok := c.getFieldSize(tbl, "max_bytes_per_second"); ok {
+		oc.MaxBytesPerSecond = size
+	}
+	oc.DeadLetterOutput = c.getFieldString(tbl, "dead_letter_output")
+	oc.RetryInitialBackoff, _ = c.getFieldDuration(tbl, "retry_initial_backoff")
+	oc.RetryMaxBackoff, _ = c.getFieldDuration(tbl, "retry_max_backoff")
+	oc.RetryJitter, _ = c.getFieldDuration(tbl, "retry_jitter")
+	oc.RetryMaxAttempts = c.getFieldInt(tbl, "retry_max_attempts")
+	if oc.RetryMaxAttempts < 0 {
+		return nil, fmt.Errorf("invalid 'retry_max_attempts' setting %d", oc.RetryMaxAttempts)
+	}
+	oc.CircuitBreakerThreshold = c.getFieldInt(tbl, "circuit_breaker_threshold")
+	oc.CircuitBreakerTimeout, _ = c.getFieldDuration(tbl, "circuit_breaker_timeout")
+
+	// Allow to override the disk-buffer limits per output
+	if size, ok := c.getFieldSize(tbl, "buffer_disk_max_size"); ok {
+		oc.BufferDiskMaxSize = size
+	}
+	if policy := c.getFieldString(tbl, "buffer_disk_overflow_policy"); policy != "" {
+		oc.BufferDiskOverflowPolicy = policy
+	}
 
 	if c.hasErrs() {
 		return nil, c.firstErr()
 	}
 
-	if oc.BufferStrategy == "disk_write_through" {
+	switch oc.BufferStrategy {
+	case "disk_write_through":
 		log.Printf("W! Using disk-write-through buffer strategy for plugin outputs.%s, this is an experimental feature", name)
+	case "memory_spill":
+		log.Printf("W! Using memory-spill buffer strategy for plugin outputs.%s, this is an experimental feature", name)
 	}
 
 	// Generate an ID for the plugin
@@ -1791,21 +1982,76 @@ func (c *Config) buildOutput(name, source string, tbl *ast.Table) (*models.Outpu
 	return oc, err
 }
 
+// linkDeadLetterOutputs sets the dead-letter output for all outputs
+// referencing another output by its alias or, if unique, by its plugin name.
+func (c *Config) linkDeadLetterOutputs() error {
+	for _, output := range c.Outputs {
+		// Reused outputs are already linked
+		ref := output.Config.DeadLetterOutput
+		if ref == "" || c.reusedOutputs[output] {
+			continue
+		}
+
+		var target *models.RunningOutput
+		var candidates []*models.RunningOutput
+		for _, o := range c.Outputs {
+			if o.Config.Alias == ref {
+				target = o
+				break
+			}
+			if o.Config.Name == ref {
+				candidates = append(candidates, o)
+			}
+		}
+		if target == nil {
+			switch len(candidates) {
+			case 0:
+				return fmt.Errorf("dead-letter output %q of %s not found", ref, output.LogName())
+			case 1:
+				target = candidates[0]
+			default:
+				return fmt.Errorf("dead-letter output %q of %s is ambiguous, please use an alias", ref, output.LogName())
+			}
+		}
+
+		if target == output {
+			return fmt.Errorf("%s cannot be its own dead-letter output", output.LogName())
+		}
+		if target.Config.DeadLetterOutput != "" {
+			return fmt.Errorf("dead-letter output %s of %s cannot have a dead-letter output itself", target.LogName(), output.LogName())
+		}
+		if target.Config.Pipeline != output.Config.Pipeline {
+			return fmt.Errorf("dead-letter output %s of %s must be in the same pipeline", target.LogName(), output.LogName())
+		}
+
+		// Do not modify running outputs as the configuration is not validated
+		// yet. Changing the dead-letter routing requires a restart anyway.
+		if c.reusedOutputs[target] {
+			continue
+		}
+		output.SetDeadLetterOutput(target)
+	}
+	return nil
+}
+
 func (c *Config) missingTomlField(_ reflect.Type, key string) error {
 	switch key {
 	// General options to ignore
 	case "alias", "always_include_local_tags",
 		"buffer_strategy", "buffer_directory", "buffer_disk_sync",
+		"buffer_disk_max_size", "buffer_disk_overflow_policy",
+		"circuit_breaker_threshold", "circuit_breaker_timeout",
 		"collection_jitter", "collection_offset",
-		"data_format", "delay", "drop", "drop_original",
+		"data_format", "dead_letter_output", "delay", "drop", "drop_original",
 		"fielddrop", "fieldexclude", "fieldinclude", "fieldpass", "flush_interval", "flush_jitter",
 		"grace",
 		"interval",
 		"log_level", "lvm", // What is this used for?
-		"metric_batch_size", "metric_buffer_limit", "metricpass",
+		"max_bytes_per_second", "metric_batch_size", "metric_buffer_limit", "metricpass",
 		"name_override", "name_prefix", "name_suffix", "namedrop", "namedrop_separator", "namepass", "namepass_separator",
 		"order",
-		"pass", "period", "precision",
+		"pass", "period", "pipeline", "precision", "priority",
+		"retry_initial_backoff", "retry_jitter", "retry_max_attempts", "retry_max_backoff",
 		"tagdrop", "tagexclude", "taginclude", "tagpass", "tags", "startup_error_behavior", "labels":
 
 	// Secret-store options to ignore
@@ -1949,6 +2195,32 @@ func (c *Config) getFieldInt64(tbl *ast.Table, fieldName string) int64 {
 	return 0
 }
 
+func (c *Config) getFieldSize(tbl *ast.Table, fieldName string) (int64, bool) {
+	if node, ok := tbl.Fields[fieldName]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			var raw string
+			switch v := kv.Value.(type) {
+			case *ast.Integer:
+				raw = v.Value
+			case *ast.String:
+				raw = v.Value
+			default:
+				c.addError(tbl, fmt.Errorf("found unexpected format while parsing %q, expecting size", fieldName))
+				return 0, false
+			}
+
+			var size Size
+			if err := size.UnmarshalText([]byte(raw)); err != nil {
+				c.addError(tbl, fmt.Errorf("error parsing size: %w", err))
+				return 0, false
+			}
+			return int64(size), true
+		}
+	}
+
+	return 0, false
+}
+
 func (c *Config) getFieldStringSlice(tbl *ast.Table, fieldName string) []string {
 	var target []string
 	if node, ok := tbl.Fields[fieldName]; ok {
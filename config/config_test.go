@@ -541,6 +541,159 @@ func TestConfig_AzureMonitorNamespacePrefix(t *testing.T) {
 	}
 }
 
+func TestConfig_BufferDiskLimits(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/buffer_disk_limits.toml"))
+	require.Len(t, c.Outputs, 2)
+
+	// The first output inherits the agent settings
+	require.Equal(t, int64(10*1024*1024), c.Outputs[0].Config.BufferDiskMaxSize)
+	require.Equal(t, "drop_newest", c.Outputs[0].Config.BufferDiskOverflowPolicy)
+
+	// The second output overrides the agent settings
+	require.Equal(t, int64(1024), c.Outputs[1].Config.BufferDiskMaxSize)
+	require.Equal(t, "block_inputs", c.Outputs[1].Config.BufferDiskOverflowPolicy)
+}
+
+func TestConfig_BufferDiskEncryption(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/buffer_disk_encryption.toml"))
+	require.Len(t, c.Outputs, 1)
+	require.Equal(t, "zstd", c.Outputs[0].Config.BufferDiskCompression)
+	require.NotNil(t, c.Outputs[0].Config.BufferDiskEncryptionKey)
+
+	// The key is resolved on use after linking the secret-store
+	c.SecretStores["mock"] = &config.MockupSecretStore{
+		Secrets: map[string][]byte{"bufferkey": []byte("000102030405060708090a0b0c0d0e0f")},
+	}
+	require.NoError(t, c.LinkSecrets())
+
+	key, err := c.Outputs[0].Config.BufferDiskEncryptionKey()
+	require.NoError(t, err)
+	require.Equal(t, "000102030405060708090a0b0c0d0e0f", string(key))
+}
+
+func TestConfig_Bandwidth(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/bandwidth.toml"))
+	require.Empty(t, c.UnusedFields)
+	require.Equal(t, config.Size(64*1024), c.Agent.BandwidthLimit)
+	require.Len(t, c.Outputs, 2)
+
+	require.Equal(t, 10, c.Outputs[0].Config.Priority)
+	require.Zero(t, c.Outputs[0].Config.MaxBytesPerSecond)
+
+	require.Zero(t, c.Outputs[1].Config.Priority)
+	require.Equal(t, int64(8*1024), c.Outputs[1].Config.MaxBytesPerSecond)
+}
+
+func TestConfig_DeadLetterOutput(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadAll("./testdata/dead_letter.toml"))
+	require.Empty(t, c.UnusedFields)
+	require.Len(t, c.Outputs, 2)
+
+	require.Equal(t, "dlq", c.Outputs[0].Config.DeadLetterOutput)
+	require.False(t, c.Outputs[0].IsDeadLetterOutput())
+	require.True(t, c.Outputs[1].IsDeadLetterOutput())
+}
+
+func TestConfig_DeadLetterOutputInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      string
+		expected string
+	}{
+		{
+			name:     "not found",
+			cfg:      "[[outputs.http]]\n  dead_letter_output = \"foo\"",
+			expected: `dead-letter output "foo" of outputs.http not found`,
+		},
+		{
+			name:     "self",
+			cfg:      "[[outputs.http]]\n  alias = \"foo\"\n  dead_letter_output = \"foo\"",
+			expected: "outputs.http::foo cannot be its own dead-letter output",
+		},
+		{
+			name:     "ambiguous",
+			cfg:      "[[outputs.http]]\n  dead_letter_output = \"http\"\n[[outputs.http]]\n[[outputs.http]]",
+			expected: `dead-letter output "http" of outputs.http is ambiguous`,
+		},
+		{
+			name:     "chained",
+			cfg:      "[[outputs.http]]\n  alias = \"a\"\n  dead_letter_output = \"b\"\n[[outputs.http]]\n  alias = \"b\"\n  dead_letter_output = \"a\"",
+			expected: "cannot have a dead-letter output itself",
+		},
+		{
+			name:     "other pipeline",
+			cfg:      "[[outputs.http]]\n  dead_letter_output = \"dlq\"\n[[outputs.http]]\n  alias = \"dlq\"\n  pipeline = \"other\"",
+			expected: "outputs.http::dlq of outputs.http must be in the same pipeline",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), "telegraf.conf")
+			require.NoError(t, os.WriteFile(fn, []byte(tt.cfg), 0600))
+
+			c := config.NewConfig()
+			require.ErrorContains(t, c.LoadAll(fn), tt.expected)
+		})
+	}
+}
+
+func TestConfig_RetryPolicy(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/retry_policy.toml"))
+	require.Empty(t, c.UnusedFields)
+	require.Len(t, c.Outputs, 1)
+
+	oc := c.Outputs[0].Config
+	require.Equal(t, time.Second, oc.RetryInitialBackoff)
+	require.Equal(t, time.Minute, oc.RetryMaxBackoff)
+	require.Equal(t, 500*time.Millisecond, oc.RetryJitter)
+	require.Equal(t, 10, oc.RetryMaxAttempts)
+}
+
+func TestConfig_CircuitBreaker(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/circuit_breaker.toml"))
+	require.Empty(t, c.UnusedFields)
+	require.Len(t, c.Outputs, 1)
+
+	oc := c.Outputs[0].Config
+	require.Equal(t, 5, oc.CircuitBreakerThreshold)
+	require.Equal(t, time.Minute, oc.CircuitBreakerTimeout)
+}
+
+func TestConfig_ReuseOutputs(t *testing.T) {
+	running := config.NewConfig()
+	require.NoError(t, running.LoadAll("./testdata/dead_letter.toml"))
+	require.Len(t, running.Outputs, 2)
+
+	c := config.NewConfig()
+	c.ReuseOutputs(running.Outputs)
+	require.NoError(t, c.LoadAll("./testdata/dead_letter.toml"))
+	require.Equal(t, running.Outputs, c.Outputs)
+	require.Equal(t, running.AgentID, c.AgentID)
+}
+
+func TestConfig_ReuseOutputsDeadLetterUnchanged(t *testing.T) {
+	running := config.NewConfig()
+	require.NoError(t, running.LoadConfigData([]byte("[[outputs.http]]\n  alias = \"dlq\"\n"), config.EmptySourcePath))
+	require.NoError(t, running.LoadAll())
+	require.Len(t, running.Outputs, 1)
+
+	// Referencing a running output as dead-letter output must not modify it
+	// before the configuration is applied
+	c := config.NewConfig()
+	c.ReuseOutputs(running.Outputs)
+	require.NoError(t, c.LoadAll("./testdata/dead_letter.toml"))
+	require.Len(t, c.Outputs, 2)
+	require.Same(t, running.Outputs[0], c.Outputs[1])
+	require.False(t, running.Outputs[0].IsDeadLetterOutput())
+}
+
 func TestGetDefaultConfigPathFromEnvURL(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -1466,6 +1619,35 @@ func TestConfigEnvVarsNonStrictMalicious(t *testing.T) {
 	require.Len(t, c.Inputs, 2)
 }
 
+func TestConfig_TemplatesNonStrictEnvironmentSubstitutedOnce(t *testing.T) {
+	config.NonStrictEnvVarHandling = true
+	t.Cleanup(func() {
+		config.NonStrictEnvVarHandling = false
+	})
+	t.Setenv("COMMAND", "echo ${SECRET}")
+	t.Setenv("SECRET", "leaked")
+
+	data := []byte(`
+[[templates]]
+  name = "server"
+  config = '''
+[[inputs.memcached]]
+  command = "{{ .command }}"
+'''
+[[instances]]
+  template = "server"
+  vars = { command = "${COMMAND}" }
+`)
+
+	// Values of environment variables must not be substituted again
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfigData(data, "test"))
+	require.Len(t, c.Inputs, 1)
+	input, ok := c.Inputs[0].Input.(*MockupInputPlugin)
+	require.True(t, ok)
+	require.Equal(t, "echo ${SECRET}", input.Command)
+}
+
 // Mockup INPUT plugin for (new) parser testing to avoid cyclic dependencies
 type MockupInputPluginParserNew struct {
 	Parser     telegraf.Parser
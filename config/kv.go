@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+var (
+	// kvSchemes maps the schemes of key-value store sources to the scheme
+	// of the store's HTTP API
+	kvSchemes = map[string]string{
+		"consul":  "http",
+		"consuls": "https",
+	}
+
+	// kvWatchWait is the maximum time a watch request blocks in the store
+	kvWatchWait = 5 * time.Minute
+
+	// kvWatchRetryInterval is the time to wait before retrying a failed watch
+	// request or polling stores not supporting blocking requests
+	kvWatchRetryInterval = 10 * time.Second
+
+	// kvFetchTimeout is the maximum time to wait for the store to respond
+	// in addition to the wait time of blocking requests
+	kvFetchTimeout = 30 * time.Second
+
+	// kvLoaded contains the fragments of the last configuration loaded from
+	// each key-value store source, used as baseline when watching the source
+	kvLoaded   = make(map[string][]kvFragment)
+	kvLoadedMu sync.Mutex
+)
+
+// kvFragment is the configuration stored in a single key of the store
+type kvFragment struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// kvSource is a configuration source backed by a key-value store with a
+// Consul compatible HTTP API. All keys below the prefix are configuration
+// fragments loaded in the order of their keys.
+type kvSource struct {
+	name     string
+	endpoint string
+	prefix   string
+	cache    string
+	client   *http.Client
+}
+
+// IsKVSource returns true if the given configuration path references a
+// key-value store such as 'consul://localhost:8500/telegraf/'
+func IsKVSource(path string) bool {
+	u, err := url.Parse(path)
+	if err != nil {
+		return false
+	}
+	_, found := kvSchemes[u.Scheme]
+	return found
+}
+
+func newKVSource(path string) (*kvSource, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	scheme, found := kvSchemes[u.Scheme]
+	if !found {
+		return nil, fmt.Errorf("scheme %q not supported", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("missing host of key-value store")
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix == "" {
+		return nil, errors.New("missing key prefix")
+	}
+
+	endpoint := url.URL{Scheme: scheme, Host: u.Host, Path: "/v1/kv/" + prefix + "/"}
+	return &kvSource{
+		name:     u.Scheme + "://" + u.Host + "/" + prefix,
+		endpoint: endpoint.String(),
+		prefix:   prefix + "/",
+		cache:    u.Query().Get("cache"),
+		client:   &http.Client{},
+	}, nil
+}
+
+// fetch returns the fragments stored below the prefix together with the
+// modification index of the store. For a non-zero index the request blocks
+// until the data changed after the given index or the wait time elapsed.
+func (s *kvSource) fetch(ctx context.Context, index uint64, wait time.Duration) ([]kvFragment, uint64, error) {
+	params := url.Values{}
+	params.Set("recurse", "true")
+	if index > 0 {
+		params.Set("index", strconv.FormatUint(index, 10))
+		params.Set("wait", wait.String())
+	}
+
+	// Do not hang forever on unresponsive stores
+	ctx, cancel := context.WithTimeout(ctx, wait+kvFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v, exists := os.LookupEnv("CONSUL_HTTP_TOKEN"); exists {
+		req.Header.Set("X-Consul-Token", v)
+	}
+	req.Header.Set("User-Agent", internal.ProductToken())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to connect to key-value store: %w", err)
+	}
+	defer resp.Body.Close()
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// There are no keys below the prefix
+		return nil, next, nil
+	default:
+		return nil, 0, fmt.Errorf("failed to fetch config from key-value store: %s", resp.Status)
+	}
+
+	var entries []struct {
+		Key   string
+		Value []byte
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("decoding response of key-value store failed: %w", err)
+	}
+
+	fragments := make([]kvFragment, 0, len(entries))
+	for _, e := range entries {
+		// Skip folders and empty keys
+		if strings.HasSuffix(e.Key, "/") || len(e.Value) == 0 {
+			continue
+		}
+		fragments = append(fragments, kvFragment{
+			Key:   strings.TrimPrefix(e.Key, s.prefix),
+			Value: e.Value,
+		})
+	}
+	sort.Slice(fragments, func(i, j int) bool { return fragments[i].Key < fragments[j].Key })
+
+	return fragments, next, nil
+}
+
+// readCache returns the fragments of the last configuration loaded
+// successfully from the store
+func (s *kvSource) readCache() ([]kvFragment, error) {
+	buf, err := os.ReadFile(s.cache)
+	if err != nil {
+		return nil, err
+	}
+
+	var fragments []kvFragment
+	if err := json.Unmarshal(buf, &fragments); err != nil {
+		return nil, fmt.Errorf("decoding cache %q failed: %w", s.cache, err)
+	}
+	return fragments, nil
+}
+
+// writeCache atomically replaces the cache with the given fragments
+func (s *kvSource) writeCache(fragments []kvFragment) error {
+	buf, err := json.Marshal(fragments)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cache, buf)
+}
+
+// loadKVConfig loads all fragments of the key-value store source. If the
+// store is unreachable, the last configuration loaded successfully is used
+// if a cache file is configured.
+func (c *Config) loadKVConfig(path string) error {
+	source, err := newKVSource(path)
+	if err != nil {
+		return err
+	}
+
+	var fragments []kvFragment
+	err = retryFetch("key-value config", c.Agent.ConfigURLRetryAttempts, func() error {
+		var err error
+		fragments, _, err = source.fetch(context.Background(), 0, 0)
+		return err
+	})
+	var cached bool
+	if err != nil {
+		if source.cache == "" {
+			return err
+		}
+		log.Printf("W! Fetching config from %s failed: %v; using cached config %q", source.name, err, source.cache)
+		if fragments, err = source.readCache(); err != nil {
+			return fmt.Errorf("reading cached config failed: %w", err)
+		}
+		cached = true
+	}
+
+	// Watch for changes against the configuration actually loaded, e.g. the
+	// cached one, and not against the first response of the store. This also
+	// holds for invalid configurations to only reload once they changed.
+	kvLoadedMu.Lock()
+	kvLoaded[source.name] = fragments
+	kvLoadedMu.Unlock()
+
+	// Keys with the signature suffix contain the signature of the
+	// configuration stored in the key without the suffix
+	signatures := make(map[string][]byte)
+	for _, f := range fragments {
+		if key, found := strings.CutSuffix(f.Key, signatureSuffix); found {
+			signatures[key] = f.Value
+		}
+	}
+
+	for _, f := range fragments {
+		if strings.HasSuffix(f.Key, signatureSuffix) {
+			continue
+		}
+		signature, found := signatures[f.Key]
+		if len(configPublicKeys) > 0 {
+			if !found {
+				return fmt.Errorf("loading key %q failed: missing signature", f.Key)
+			}
+			if err := verifySignature(f.Value, signature); err != nil {
+				return fmt.Errorf("loading key %q failed: verifying signature failed: %w", f.Key, err)
+			}
+		}
+		if err := c.loadConfigData(f.Value, source.name+"/"+f.Key, signature); err != nil {
+			return fmt.Errorf("loading key %q failed: %w", f.Key, err)
+		}
+	}
+
+	// Only keep configurations loading successfully as last-known-good copy
+	if source.cache != "" && !cached {
+		if err := source.writeCache(fragments); err != nil {
+			log.Printf("W! Writing config cache %q failed: %v", source.cache, err)
+		}
+	}
+
+	sourcesMu.Lock()
+	sources = append(sources, source.name)
+	sourcesMu.Unlock()
+
+	return nil
+}
+
+// WatchKVSource blocks until the configuration stored in the key-value store
+// source differs from the configuration last loaded from the source or the
+// context is cancelled. Without a loaded configuration, changes are detected
+// against the first response of the store. Errors accessing the store are
+// logged and the request is retried.
+func WatchKVSource(ctx context.Context, path string) error {
+	source, err := newKVSource(path)
+	if err != nil {
+		return err
+	}
+
+	var index uint64
+	kvLoadedMu.Lock()
+	current, initialized := kvLoaded[source.name]
+	kvLoadedMu.Unlock()
+	for {
+		fragments, next, err := source.fetch(ctx, index, kvWatchWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("W! Watching config %s failed: %v", source.name, err)
+			if err := internal.SleepContext(ctx, kvWatchRetryInterval); err != nil {
+				return err
+			}
+			continue
+		}
+
+		changed := !slices.EqualFunc(current, fragments, func(a, b kvFragment) bool {
+			return a.Key == b.Key && bytes.Equal(a.Value, b.Value)
+		})
+		if initialized && changed {
+			// Use the changed configuration as new baseline to not trigger
+			// again if it fails to load
+			kvLoadedMu.Lock()
+			kvLoaded[source.name] = fragments
+			kvLoadedMu.Unlock()
+			return nil
+		}
+		current = fragments
+		initialized = true
+
+		// Fall back to polling if the store does not support blocking
+		// requests and restart from the beginning if the index went backwards
+		// e.g. due to a restore of the store.
+		switch {
+		case next == 0:
+			if err := internal.SleepContext(ctx, kvWatchRetryInterval); err != nil {
+				return err
+			}
+		case next < index:
+			index = 0
+		default:
+			index = next
+		}
+	}
+}
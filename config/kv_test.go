@@ -0,0 +1,276 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// kvStore is a minimal stand-in for a Consul key-value store supporting
+// recursive and blocking queries
+type kvStore struct {
+	sync.Mutex
+	index   uint64
+	data    map[string]string
+	changed chan struct{}
+
+	// Number of completed requests
+	requests atomic.Int64
+}
+
+func newKVStore(data map[string]string) *kvStore {
+	return &kvStore{index: 1, data: data, changed: make(chan struct{})}
+}
+
+func (s *kvStore) set(key, value string) {
+	s.Lock()
+	defer s.Unlock()
+	s.data[key] = value
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *kvStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer s.requests.Add(1)
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	// Block until the data changes for watch requests
+	if idx := r.URL.Query().Get("index"); idx != "" {
+		index, err := strconv.ParseUint(idx, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.Lock()
+		current, changed := s.index, s.changed
+		s.Unlock()
+		if current <= index {
+			select {
+			case <-changed:
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	type entry struct {
+		Key   string
+		Value []byte
+	}
+	entries := make([]entry, 0, len(s.data))
+	for k, v := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			entries = append(entries, entry{Key: k, Value: []byte(v)})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestKVSourceLoad(t *testing.T) {
+	store := newKVStore(map[string]string{
+		"telegraf/prod/":           "",
+		"telegraf/prod/agent":      "[agent]\n  interval = \"42s\"\n",
+		"telegraf/prod/tags/dc":    "[global_tags]\n  dc = \"eu-west\"\n",
+		"telegraf/prod/tags/rack":  "[global_tags]\n  rack = \"r12\"\n",
+		"telegraf/production/tags": "[global_tags]\n  other = \"true\"\n",
+	})
+	ts := httptest.NewServer(store)
+	defer ts.Close()
+
+	source := strings.Replace(ts.URL, "http://", "consul://", 1) + "/telegraf/prod"
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(source))
+	require.Equal(t, 42*time.Second, time.Duration(c.Agent.Interval))
+	require.Equal(t, "eu-west", c.Tags["dc"])
+	require.Equal(t, "r12", c.Tags["rack"])
+	require.NotContains(t, c.Tags, "other")
+}
+
+func TestKVSourceCache(t *testing.T) {
+	httpLoadConfigRetryInterval = 0 * time.Second
+
+	store := newKVStore(map[string]string{
+		"telegraf/tags": "[global_tags]\n  dc = \"eu-west\"\n",
+	})
+	ts := httptest.NewServer(store)
+	addr := ts.URL
+
+	cache := filepath.Join(t.TempDir(), "kv.cache")
+	source := strings.Replace(addr, "http://", "consul://", 1) + "/telegraf?cache=" + cache
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(source))
+	require.FileExists(t, cache)
+
+	// Load the last-known-good configuration while the store is unreachable
+	ts.Close()
+	c = NewConfig()
+	require.NoError(t, c.LoadConfig(source))
+	require.Equal(t, "eu-west", c.Tags["dc"])
+
+	// Fail without a cache
+	c = NewConfig()
+	source = strings.Replace(addr, "http://", "consul://", 1) + "/telegraf"
+	require.ErrorContains(t, c.LoadConfig(source), "failed to connect to key-value store")
+}
+
+func TestKVSourceInvalidConfigNotCached(t *testing.T) {
+	store := newKVStore(map[string]string{
+		"telegraf/tags": "[global_tags\n",
+	})
+	ts := httptest.NewServer(store)
+	defer ts.Close()
+
+	cache := filepath.Join(t.TempDir(), "kv.cache")
+	source := strings.Replace(ts.URL, "http://", "consul://", 1) + "/telegraf?cache=" + cache
+
+	c := NewConfig()
+	require.ErrorContains(t, c.LoadConfig(source), `loading key "tags" failed`)
+	require.NoFileExists(t, cache)
+}
+
+func TestKVSourceInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "missing host",
+			path:     "consul:///telegraf",
+			expected: "missing host of key-value store",
+		},
+		{
+			name:     "missing prefix",
+			path:     "consul://localhost:8500/",
+			expected: "missing key prefix",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.True(t, IsKVSource(tt.path))
+			c := NewConfig()
+			require.ErrorContains(t, c.LoadConfig(tt.path), tt.expected)
+		})
+	}
+	require.False(t, IsKVSource("http://localhost:8500/telegraf"))
+	require.False(t, IsKVSource("/etc/telegraf/telegraf.conf"))
+}
+
+func TestWatchKVSource(t *testing.T) {
+	store := newKVStore(map[string]string{
+		"telegraf/tags": "[global_tags]\n  dc = \"eu-west\"\n",
+	})
+	ts := httptest.NewServer(store)
+	defer ts.Close()
+	source := strings.Replace(ts.URL, "http://", "consul://", 1) + "/telegraf"
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchKVSource(ctx, source)
+	}()
+	require.Eventually(t, func() bool {
+		return store.requests.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Changing keys outside of the prefix must not trigger
+	store.set("other/tags", "[global_tags]\n  dc = \"us-east\"\n")
+	select {
+	case err := <-done:
+		require.Failf(t, "unexpected return", "error: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	store.set("telegraf/tags", "[global_tags]\n  dc = \"us-east\"\n")
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		require.Fail(t, "watch did not return on change")
+	}
+}
+
+func TestWatchKVSourceChangedAfterLoad(t *testing.T) {
+	store := newKVStore(map[string]string{
+		"telegraf/tags": "[global_tags]\n  dc = \"eu-west\"\n",
+	})
+	ts := httptest.NewServer(store)
+	defer ts.Close()
+	source := strings.Replace(ts.URL, "http://", "consul://", 1) + "/telegraf"
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(source))
+
+	// Changes between loading and watching the source must trigger
+	store.set("telegraf/tags", "[global_tags]\n  dc = \"us-east\"\n")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, WatchKVSource(ctx, source))
+}
+
+func TestKVSourceFetchTimeout(t *testing.T) {
+	httpLoadConfigRetryInterval = 0 * time.Second
+	timeout := kvFetchTimeout
+	kvFetchTimeout = 100 * time.Millisecond
+	defer func() { kvFetchTimeout = timeout }()
+
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+	source := strings.Replace(ts.URL, "http://", "consul://", 1) + "/telegraf"
+
+	c := NewConfig()
+	c.Agent.ConfigURLRetryAttempts = 1
+	require.ErrorIs(t, c.LoadConfig(source), context.DeadlineExceeded)
+}
+
+func TestWatchKVSourceCancel(t *testing.T) {
+	ts := httptest.NewServer(newKVStore(make(map[string]string)))
+	defer ts.Close()
+	source := strings.Replace(ts.URL, "http://", "consul://", 1) + "/telegraf"
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchKVSource(ctx, source)
+	}()
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/toml/ast"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/models"
+)
+
+// LintIssue describes a likely mistake in the configuration that does not
+// prevent loading the configuration.
+type LintIssue struct {
+	// Name of the check reporting the issue
+	Check string `json:"check"`
+	// Plugin the issue refers to in the form used for logging, e.g.
+	// "outputs.influxdb::myalias"
+	Plugin string `json:"plugin,omitempty"`
+	// Source of the plugin configuration if known
+	Source  string `json:"source,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	msg := i.Message
+	if i.Plugin != "" {
+		msg = i.Plugin + ": " + msg
+	}
+	if i.Source != "" {
+		msg += " (" + i.Source + ")"
+	}
+	return fmt.Sprintf("[%s] %s", i.Check, msg)
+}
+
+// Lint checks the loaded configuration for semantic mistakes across plugins
+// and returns the issues found. The configuration must be loaded with LoadAll
+// before calling this function.
+func (c *Config) Lint() []LintIssue {
+	var issues []LintIssue
+	issues = append(issues, c.lintNamePass()...)
+	issues = append(issues, c.lintProcessorOrder()...)
+	issues = append(issues, c.lintBatchSize()...)
+	issues = append(issues, c.lintAliases()...)
+	issues = append(issues, c.lintSecretStores()...)
+	issues = append(issues, c.ignoredDataFormats...)
+
+	// Plugins of different types are loaded in random order, so sort the
+	// issues to get a stable output
+	slices.SortStableFunc(issues, func(a, b LintIssue) int {
+		return cmp.Or(
+			strings.Compare(a.Check, b.Check),
+			strings.Compare(a.Plugin, b.Plugin),
+			strings.Compare(a.Source, b.Source),
+			strings.Compare(a.Message, b.Message),
+		)
+	})
+	return issues
+}
+
+// namePattern describes the names of the metrics produced by a plugin. If the
+// name is empty, the metric can have any name with the given prefix and suffix.
+// Note, the plugin name is not used as the default metric name as many plugins
+// produce metrics with other names, e.g. 'inputs.net' produces 'netstat' or
+// parser based plugins produce any name. Therefore, plugins without name
+// override, prefix or suffix can produce every name.
+type namePattern struct {
+	name   string
+	prefix string
+	suffix string
+}
+
+func newNamePattern(override, prefix, suffix string) namePattern {
+	if override != "" {
+		return namePattern{name: prefix + override + suffix}
+	}
+	return namePattern{prefix: prefix, suffix: suffix}
+}
+
+// mayMatch returns false if none of the given filter patterns can ever match
+// a name described by the name pattern
+func (p namePattern) mayMatch(f filter.Filter, patterns []string) bool {
+	if p.name != "" {
+		return f.Match(p.name)
+	}
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			return true
+		}
+		if strings.HasPrefix(pattern, p.prefix) && strings.HasSuffix(pattern, p.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintNamePass reports namepass filters not matching any of the metric names
+// produced by the inputs. As every processor might rename metrics, the names
+// are unknown after the first processor. Therefore, the check is limited to
+// the first processor in execution order or, if there are no processors, to
+// the aggregators and outputs.
+func (c *Config) lintNamePass() []LintIssue {
+	produced := make([]namePattern, 0, len(c.Inputs))
+	for _, input := range c.Inputs {
+		produced = append(produced, newNamePattern(input.Config.NameOverride, input.Config.MeasurementPrefix, input.Config.MeasurementSuffix))
+	}
+
+	var issues []LintIssue
+	check := func(plugin, source string, f models.Filter, names []namePattern) {
+		if len(f.NamePass) == 0 || len(names) == 0 {
+			return
+		}
+		compiled, err := filter.Compile(f.NamePass, []rune(f.NamePassSeparators)...)
+		if err != nil {
+			return
+		}
+		for _, n := range names {
+			if n.mayMatch(compiled, f.NamePass) {
+				return
+			}
+		}
+		issues = append(issues, LintIssue{
+			Check:   "namepass",
+			Plugin:  plugin,
+			Source:  source,
+			Message: fmt.Sprintf("namepass %q never matches any metric name produced by the inputs", f.NamePass),
+		})
+	}
+
+	// Processors are sorted by their execution order when loading
+	if len(c.Processors) > 0 {
+		processor := c.Processors[0]
+		check(processor.LogName(), processor.Config.Source, processor.Config.Filter, produced)
+		return issues
+	}
+
+	aggregated := slices.Clone(produced)
+	for _, aggregator := range c.Aggregators {
+		check(aggregator.LogName(), aggregator.Config.Source, aggregator.Config.Filter, produced)
+		cfg := aggregator.Config
+		if cfg.NameOverride != "" || cfg.MeasurementPrefix != "" || cfg.MeasurementSuffix != "" {
+			aggregated = append(aggregated, newNamePattern(cfg.NameOverride, cfg.MeasurementPrefix, cfg.MeasurementSuffix))
+		}
+	}
+	for _, output := range c.Outputs {
+		if output.IsDeadLetterOutput() {
+			continue
+		}
+		check(output.LogName(), output.Config.Source, output.Config.Filter, aggregated)
+	}
+	return issues
+}
+
+// lintProcessorOrder reports processors sharing the same explicit order as
+// their execution order then depends on the loading order of the files.
+func (c *Config) lintProcessorOrder() []LintIssue {
+	byOrder := make(map[int64][]*models.RunningProcessor)
+	for _, processor := range c.Processors {
+		if processor.Config.Order != 0 {
+			byOrder[processor.Config.Order] = append(byOrder[processor.Config.Order], processor)
+		}
+	}
+
+	orders := make([]int64, 0, len(byOrder))
+	for order := range byOrder {
+		orders = append(orders, order)
+	}
+	slices.Sort(orders)
+
+	var issues []LintIssue
+	for _, order := range orders {
+		processors := byOrder[order]
+		if len(processors) < 2 {
+			continue
+		}
+		names := make([]string, 0, len(processors)-1)
+		for _, p := range processors[1:] {
+			names = append(names, p.LogName())
+		}
+		issues = append(issues, LintIssue{
+			Check:   "processor-order",
+			Plugin:  processors[0].LogName(),
+			Source:  processors[0].Config.Source,
+			Message: fmt.Sprintf("order %d is also used by %s", order, strings.Join(names, ", ")),
+		})
+	}
+	return issues
+}
+
+// lintBatchSize reports outputs that can never fill a batch
+func (c *Config) lintBatchSize() []LintIssue {
+	var issues []LintIssue
+	for _, output := range c.Outputs {
+		// The buffer limit does not apply for those strategies
+		if output.Config.BufferStrategy == "disk_write_through" || output.Config.BufferStrategy == "memory_spill" {
+			continue
+		}
+		if output.MetricBatchSize > output.MetricBufferLimit {
+			issues = append(issues, LintIssue{
+				Check:  "batch-size",
+				Plugin: output.LogName(),
+				Source: output.Config.Source,
+				Message: fmt.Sprintf("metric_batch_size %d exceeds metric_buffer_limit %d",
+					output.MetricBatchSize, output.MetricBufferLimit),
+			})
+		}
+	}
+	return issues
+}
+
+// lintAliases reports aliases used by more than one plugin of the same type
+func (c *Config) lintAliases() []LintIssue {
+	type plugin struct {
+		name   string
+		source string
+	}
+	aliases := make(map[string]map[string][]plugin)
+	add := func(category, alias, name, source string) {
+		if alias == "" {
+			return
+		}
+		if aliases[category] == nil {
+			aliases[category] = make(map[string][]plugin)
+		}
+		aliases[category][alias] = append(aliases[category][alias], plugin{name, source})
+	}
+	for _, p := range c.Inputs {
+		add("inputs", p.Config.Alias, p.LogName(), p.Config.Source)
+	}
+	for _, p := range c.Processors {
+		add("processors", p.Config.Alias, p.LogName(), p.Config.Source)
+	}
+	for _, p := range c.Aggregators {
+		add("aggregators", p.Config.Alias, p.LogName(), p.Config.Source)
+	}
+	for _, p := range c.Outputs {
+		add("outputs", p.Config.Alias, p.LogName(), p.Config.Source)
+	}
+
+	var issues []LintIssue
+	for _, category := range []string{"inputs", "processors", "aggregators", "outputs"} {
+		names := make([]string, 0, len(aliases[category]))
+		for alias := range aliases[category] {
+			names = append(names, alias)
+		}
+		sort.Strings(names)
+		for _, alias := range names {
+			plugins := aliases[category][alias]
+			if len(plugins) < 2 {
+				continue
+			}
+			slices.SortFunc(plugins, func(a, b plugin) int {
+				return cmp.Or(strings.Compare(a.name, b.name), strings.Compare(a.source, b.source))
+			})
+			issues = append(issues, LintIssue{
+				Check:   "duplicate-alias",
+				Plugin:  plugins[0].name,
+				Source:  plugins[0].source,
+				Message: fmt.Sprintf("alias %q is used by %d %s", alias, len(plugins), category),
+			})
+		}
+	}
+	return issues
+}
+
+// lintSecretStores reports secret-stores not referenced by any secret
+func (c *Config) lintSecretStores() []LintIssue {
+	ids := make([]string, 0, len(c.SecretStores))
+	for id := range c.SecretStores {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var issues []LintIssue
+	for _, id := range ids {
+		if c.usedSecretStores[id] {
+			continue
+		}
+		issues = append(issues, LintIssue{
+			Check:   "unused-secretstore",
+			Message: fmt.Sprintf("secret-store %q is not referenced by any secret", id),
+		})
+	}
+	return issues
+}
+
+// checkDataFormat records an issue if the plugin does not use a parser or
+// serializer and would silently ignore the 'data_format' setting
+func (c *Config) checkDataFormat(category, name, source string, table *ast.Table, supported bool) {
+	if supported {
+		return
+	}
+	if _, found := table.Fields["data_format"]; !found {
+		return
+	}
+
+	plugin := category + "." + name
+	if alias := c.getFieldString(table, "alias"); alias != "" {
+		plugin += "::" + alias
+	}
+	c.ignoredDataFormats = append(c.ignoredDataFormats, LintIssue{
+		Check:   "data-format",
+		Plugin:  plugin,
+		Source:  source,
+		Message: fmt.Sprintf("data_format %q is ignored as the plugin does not support data formats", c.getFieldString(table, "data_format")),
+	})
+}
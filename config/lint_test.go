@@ -0,0 +1,190 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      string
+		expected []LintIssue
+	}{
+		{
+			name: "clean",
+			cfg: `
+[[inputs.file]]
+  name_override = "foo"
+[[inputs.memcached]]
+  name_prefix = "mc_"
+[[outputs.http]]
+  namepass = ["foo"]
+[[outputs.http]]
+  namepass = ["mc_hits"]
+`,
+		},
+		{
+			name: "namepass",
+			cfg: `
+[[inputs.file]]
+  name_override = "foo"
+[[inputs.memcached]]
+  name_prefix = "mc_"
+[[outputs.http]]
+  namepass = ["bar", "memcached"]
+[[outputs.http]]
+  namepass = ["f*"]
+`,
+			expected: []LintIssue{
+				{
+					Check:   "namepass",
+					Plugin:  "outputs.http",
+					Message: `namepass ["bar" "memcached"] never matches any metric name produced by the inputs`,
+				},
+			},
+		},
+		{
+			name: "namepass without name settings",
+			cfg: `
+[[inputs.memcached]]
+[[outputs.http]]
+  namepass = ["memcachedd"]
+`,
+		},
+		{
+			name: "namepass after processors",
+			cfg: `
+[[inputs.file]]
+  name_override = "foo"
+[[processors.processor]]
+  order = 1
+[[processors.processor]]
+  order = 2
+  namepass = ["renamed"]
+[[outputs.http]]
+  namepass = ["renamed"]
+`,
+		},
+		{
+			name: "namepass with processors",
+			cfg: `
+[[inputs.file]]
+  name_override = "foo"
+[[processors.processor]]
+  namepass = ["bar"]
+[[outputs.http]]
+  namepass = ["renamed"]
+`,
+			expected: []LintIssue{
+				{
+					Check:   "namepass",
+					Plugin:  "processors.processor",
+					Message: `namepass ["bar"] never matches any metric name produced by the inputs`,
+				},
+			},
+		},
+		{
+			name: "processor order",
+			cfg: `
+[[processors.processor]]
+  alias = "first"
+  order = 1
+[[processors.processor]]
+  alias = "second"
+  order = 1
+[[processors.processor]]
+  order = 2
+`,
+			expected: []LintIssue{
+				{
+					Check:   "processor-order",
+					Plugin:  "processors.processor::first",
+					Message: "order 1 is also used by processors.processor::second",
+				},
+			},
+		},
+		{
+			name: "batch size",
+			cfg: `
+[[outputs.http]]
+  metric_batch_size = 2000
+  metric_buffer_limit = 1000
+`,
+			expected: []LintIssue{
+				{
+					Check:   "batch-size",
+					Plugin:  "outputs.http",
+					Message: "metric_batch_size 2000 exceeds metric_buffer_limit 1000",
+				},
+			},
+		},
+		{
+			name: "duplicate alias",
+			cfg: `
+[[inputs.file]]
+  alias = "dup"
+[[inputs.memcached]]
+  alias = "dup"
+[[outputs.http]]
+  alias = "dup"
+`,
+			expected: []LintIssue{
+				{
+					Check:   "duplicate-alias",
+					Plugin:  "inputs.file::dup",
+					Message: `alias "dup" is used by 2 inputs`,
+				},
+			},
+		},
+		{
+			name: "unused secret-store",
+			cfg: `
+[[secretstores.mockup]]
+  id = "used"
+[[secretstores.mockup]]
+  id = "unused"
+[[inputs.mockup]]
+  secret = "@{used:password}"
+`,
+			expected: []LintIssue{
+				{
+					Check:   "unused-secretstore",
+					Message: `secret-store "unused" is not referenced by any secret`,
+				},
+			},
+		},
+		{
+			name: "data format",
+			cfg: `
+[[inputs.file]]
+  data_format = "json"
+[[outputs.http]]
+  alias = "remote"
+  data_format = "json"
+`,
+			expected: []LintIssue{
+				{
+					Check:   "data-format",
+					Plugin:  "outputs.http::remote",
+					Message: `data_format "json" is ignored as the plugin does not support data formats`,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() { unlinkedSecrets = make([]*Secret, 0) }()
+
+			c := NewConfig()
+			require.NoError(t, c.LoadConfigData([]byte(tt.cfg), EmptySourcePath))
+			for _, store := range c.SecretStores {
+				store.(*MockupSecretStore).Secrets = map[string][]byte{"password": []byte("secret")}
+			}
+			require.NoError(t, c.LinkSecrets())
+			require.Equal(t, tt.expected, c.Lint())
+		})
+	}
+}
@@ -50,17 +50,24 @@ func splitToSections(root *ast.Table) ([]section, error) {
 				}
 			}
 		default:
-			tbl, ok := elements.(*ast.Table)
-			if !ok {
+			var tbls []*ast.Table
+			switch e := elements.(type) {
+			case *ast.Table:
+				tbls = []*ast.Table{e}
+			case []*ast.Table:
+				tbls = e
+			default:
 				return nil, fmt.Errorf("%q is not a table (%T)", name, elements)
 			}
-			s := section{
-				name:    name,
-				begin:   tbl.Line,
-				content: tbl,
-				raw:     &bytes.Buffer{},
+			for _, tbl := range tbls {
+				s := section{
+					name:    name,
+					begin:   tbl.Line,
+					content: tbl,
+					raw:     &bytes.Buffer{},
+				}
+				sections = append(sections, s)
 			}
-			sections = append(sections, s)
 		}
 	}
 
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// signatureSuffix is appended to the configuration file, URL or key to
+// locate the detached signature of a configuration
+const signatureSuffix = ".sig"
+
+// configPublicKeys are the keys to verify configuration signatures with. If
+// no key is set, configurations are loaded without verification.
+var configPublicKeys []ed25519.PublicKey
+
+// SetConfigPublicKeys reads the ed25519 public keys from the given PEM files
+// and requires all configurations loaded afterwards to be signed by any of
+// those keys.
+func SetConfigPublicKeys(files []string) error {
+	keys := make([]ed25519.PublicKey, 0, len(files))
+	for _, fn := range files {
+		buf, err := os.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("reading public key failed: %w", err)
+		}
+		key, err := parsePublicKey(buf)
+		if err != nil {
+			return fmt.Errorf("parsing public key %q failed: %w", fn, err)
+		}
+		keys = append(keys, key)
+	}
+	configPublicKeys = keys
+	return nil
+}
+
+func parsePublicKey(buf []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T, expected ed25519", key)
+	}
+	return pub, nil
+}
+
+// decodeSignature accepts raw signatures, e.g. as produced by
+// 'openssl pkeyutl -sign -rawin', as well as base64 encoded ones
+func decodeSignature(buf []byte) ([]byte, error) {
+	if len(buf) == ed25519.SignatureSize {
+		return buf, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(buf)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, errors.New("invalid signature format")
+	}
+	return sig, nil
+}
+
+// verifySignature checks the configuration data against the signature
+// using the configured public keys
+func verifySignature(data, signature []byte) error {
+	sig, err := decodeSignature(signature)
+	if err != nil {
+		return err
+	}
+	for _, key := range configPublicKeys {
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match")
+}
+
+// verifyConfig loads the detached signature next to the configuration file
+// or URL and verifies the configuration data if public keys are set. The
+// verified signature is returned to allow verifying the data again later.
+func verifyConfig(path string, data []byte, urlRetryAttempts int) ([]byte, error) {
+	if len(configPublicKeys) == 0 {
+		return nil, nil
+	}
+
+	var signature []byte
+	if fetchURLRe.MatchString(path) {
+		u, err := url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		u.Path += signatureSuffix
+		if signature, err = fetchConfig(u, urlRetryAttempts); err != nil {
+			return nil, fmt.Errorf("fetching signature failed: %w", err)
+		}
+	} else {
+		var err error
+		if signature, err = os.ReadFile(path + signatureSuffix); err != nil {
+			return nil, fmt.Errorf("reading signature failed: %w", err)
+		}
+	}
+
+	if err := verifySignature(data, signature); err != nil {
+		return nil, fmt.Errorf("verifying signature failed: %w", err)
+	}
+	return signature, nil
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const signedConfig = "[global_tags]\n  dc = \"eu-west\"\n"
+
+// setupSigningKey creates a new key-pair, sets the public key for config
+// verification and returns the private key for signing
+func setupSigningKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	fn := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(fn, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+	require.NoError(t, SetConfigPublicKeys([]string{fn}))
+	t.Cleanup(func() { configPublicKeys = nil })
+
+	return priv
+}
+
+func TestSetConfigPublicKeysInvalid(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(fn, []byte("not a key"), 0600))
+	require.ErrorContains(t, SetConfigPublicKeys([]string{fn}), "no PEM encoded public key found")
+	require.Error(t, SetConfigPublicKeys([]string{filepath.Join(t.TempDir(), "missing.pem")}))
+}
+
+func TestSignedConfigFile(t *testing.T) {
+	priv := setupSigningKey(t)
+	_, other, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		data      string
+		signature []byte
+		expected  string
+	}{
+		{
+			name:      "raw signature",
+			data:      signedConfig,
+			signature: ed25519.Sign(priv, []byte(signedConfig)),
+		},
+		{
+			name:      "base64 signature",
+			data:      signedConfig,
+			signature: []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(signedConfig))) + "\n"),
+		},
+		{
+			name:     "missing signature",
+			data:     signedConfig,
+			expected: "reading signature failed",
+		},
+		{
+			name:      "tampered config",
+			data:      strings.Replace(signedConfig, "eu-west", "us-east", 1),
+			signature: ed25519.Sign(priv, []byte(signedConfig)),
+			expected:  "signature does not match",
+		},
+		{
+			name:      "foreign key",
+			data:      signedConfig,
+			signature: ed25519.Sign(other, []byte(signedConfig)),
+			expected:  "signature does not match",
+		},
+		{
+			name:      "invalid signature",
+			data:      signedConfig,
+			signature: []byte("garbage"),
+			expected:  "invalid signature format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), "telegraf.conf")
+			require.NoError(t, os.WriteFile(fn, []byte(tt.data), 0600))
+			if tt.signature != nil {
+				require.NoError(t, os.WriteFile(fn+".sig", tt.signature, 0600))
+			}
+
+			c := NewConfig()
+			err := c.LoadConfig(fn)
+			if tt.expected != "" {
+				require.ErrorContains(t, err, tt.expected)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "eu-west", c.Tags["dc"])
+		})
+	}
+}
+
+func TestSignedConfigURL(t *testing.T) {
+	priv := setupSigningKey(t)
+
+	var tampered atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		switch r.URL.Path {
+		case "/telegraf.conf":
+			body = []byte(signedConfig)
+			if tampered.Load() {
+				body = []byte("[[inputs.exec]]\n  commands = [\"rm -rf /\"]\n")
+			}
+		case "/telegraf.conf.sig":
+			body = ed25519.Sign(priv, []byte(signedConfig))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, err := w.Write(body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			t.Error(err)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(ts.URL+"/telegraf.conf"))
+	require.Equal(t, "eu-west", c.Tags["dc"])
+
+	tampered.Store(true)
+	c = NewConfig()
+	require.ErrorContains(t, c.LoadConfig(ts.URL+"/telegraf.conf"), "signature does not match")
+	require.Empty(t, c.Inputs)
+}
+
+func TestSignedKVSource(t *testing.T) {
+	priv := setupSigningKey(t)
+
+	store := newKVStore(map[string]string{
+		"telegraf/tags":     signedConfig,
+		"telegraf/tags.sig": string(ed25519.Sign(priv, []byte(signedConfig))),
+	})
+	ts := httptest.NewServer(store)
+	defer ts.Close()
+	source := strings.Replace(ts.URL, "http://", "consul://", 1) + "/telegraf"
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(source))
+	require.Equal(t, "eu-west", c.Tags["dc"])
+
+	store.set("telegraf/agent", "[agent]\n  interval = \"1s\"\n")
+	c = NewConfig()
+	require.ErrorContains(t, c.LoadConfig(source), `loading key "agent" failed: missing signature`)
+}
+
+func TestSignedSnapshot(t *testing.T) {
+	priv := setupSigningKey(t)
+
+	fn := filepath.Join(t.TempDir(), "telegraf.conf")
+	require.NoError(t, os.WriteFile(fn, []byte(signedConfig), 0600))
+	require.NoError(t, os.WriteFile(fn+".sig", ed25519.Sign(priv, []byte(signedConfig)), 0600))
+
+	c := NewConfig()
+	require.NoError(t, c.LoadAll(fn))
+	snapshot := c.Snapshot()
+
+	// The signature file might change or vanish after taking the snapshot
+	require.NoError(t, os.Remove(fn+".sig"))
+	restored := NewConfig()
+	require.NoError(t, restored.LoadSnapshot(snapshot))
+	require.Equal(t, "eu-west", restored.Tags["dc"])
+	require.Equal(t, snapshot, restored.Snapshot())
+
+	tampered := &Snapshot{Sources: []SnapshotSource{snapshot.Sources[0]}}
+	tampered.Sources[0].Data = []byte(strings.Replace(signedConfig, "eu-west", "us-east", 1))
+	require.ErrorContains(t, NewConfig().LoadSnapshot(tampered), "signature does not match")
+
+	unsigned := &Snapshot{Sources: []SnapshotSource{{Path: fn, Data: []byte(signedConfig)}}}
+	require.ErrorContains(t, NewConfig().LoadSnapshot(unsigned), "missing signature")
+}
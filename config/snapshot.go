@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Snapshot contains the raw data of all sources loaded into a configuration
+// allowing to load the same configuration again, e.g. as fallback if loading
+// a changed configuration fails
+type Snapshot struct {
+	Sources []SnapshotSource `json:"sources"`
+}
+
+// SnapshotSource is the data loaded from a single configuration source
+type SnapshotSource struct {
+	Path string `json:"path"`
+	Data []byte `json:"data"`
+	// Signature the data was verified with when loading the source
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Snapshot returns the data of all sources loaded into the configuration
+func (c *Config) Snapshot() *Snapshot {
+	return &Snapshot{Sources: slices.Clone(c.loaded)}
+}
+
+// LoadSnapshot loads the configuration from the data of the given snapshot
+// in the same way as LoadAll loads the configuration files. If public keys
+// are set, the data is verified against the signature stored in the snapshot
+// as the snapshot file might have been modified.
+func (c *Config) LoadSnapshot(s *Snapshot) error {
+	for _, source := range s.Sources {
+		if !c.Agent.Quiet {
+			log.Printf("I! Loading config snapshot of: %s", source.Path)
+		}
+		if len(configPublicKeys) > 0 {
+			if len(source.Signature) == 0 {
+				return fmt.Errorf("loading config snapshot of %s failed: missing signature", source.Path)
+			}
+			if err := verifySignature(source.Data, source.Signature); err != nil {
+				return fmt.Errorf("loading config snapshot of %s failed: verifying signature failed: %w", source.Path, err)
+			}
+		}
+		if err := c.loadConfigData(source.Data, source.Path, source.Signature); err != nil {
+			return fmt.Errorf("loading config snapshot of %s failed: %w", source.Path, err)
+		}
+	}
+	return c.finishLoading()
+}
+
+// Save atomically writes the snapshot to the given file
+func (s *Snapshot) Save(filename string) error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, buf)
+}
+
+// LoadSnapshotFile reads a snapshot previously written using Save
+func LoadSnapshotFile(filename string) (*Snapshot, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return nil, fmt.Errorf("decoding config snapshot %q failed: %w", filename, err)
+	}
+	return &s, nil
+}
+
+// writeFileAtomic replaces the given file with the data without leaving a
+// partially written file behind. The file is only accessible by the owner as
+// configurations might contain credentials.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,29 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadAll("./testdata/single_plugin.toml", "./testdata/templates.toml"))
+
+	fn := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, c.Snapshot().Save(fn))
+	snapshot, err := config.LoadSnapshotFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, c.Snapshot(), snapshot)
+
+	restored := config.NewConfig()
+	require.NoError(t, restored.LoadSnapshot(snapshot))
+	require.Len(t, restored.Inputs, len(c.Inputs))
+	for i, input := range c.Inputs {
+		require.Equal(t, input.Config.ID, restored.Inputs[i].Config.ID)
+		require.Equal(t, input.Config.Source, restored.Inputs[i].Config.Source)
+	}
+}
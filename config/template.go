@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"text/template"
+
+	"github.com/influxdata/toml"
+	"github.com/influxdata/toml/ast"
+)
+
+// templateDefinition is a named configuration snippet in Go template syntax
+// defined via [[templates]]
+type templateDefinition struct {
+	Name   string `toml:"name"`
+	Config string `toml:"config"`
+}
+
+// templateInstance expands a template with the given variables and is
+// defined via [[instances]]
+type templateInstance struct {
+	Template string                 `toml:"template"`
+	Vars     map[string]interface{} `toml:"vars"`
+}
+
+// templatesRe matches the table headers of template definitions and instances
+var templatesRe = regexp.MustCompile(`(?m)^\s*\[\[\s*(templates|instances)\s*\]\]`)
+
+// usesTemplates returns true if the configuration contains template
+// definitions or instances
+func usesTemplates(tbl *ast.Table) bool {
+	_, hasTemplates := tbl.Fields["templates"]
+	_, hasInstances := tbl.Fields["instances"]
+	return hasTemplates || hasInstances
+}
+
+// ExpandTemplates replaces each template instance of the configuration by the
+// rendered template and removes the template definitions. All other parts of
+// the configuration, including comments, are kept as-is. Configurations
+// without templates are returned unchanged without parsing them. If non-strict
+// environment variable handling is enabled, the variables are substituted
+// before parsing, as done when loading the configuration, so the returned
+// configuration must not be substituted again.
+func ExpandTemplates(data []byte) ([]byte, error) {
+	data = trimBOM(data)
+	if NonStrictEnvVarHandling {
+		var err error
+		if data, err = substituteEnvironmentNonStrict(data, OldEnvVarReplacement); err != nil {
+			return nil, fmt.Errorf("substituting environment variables failed: %w", err)
+		}
+	}
+
+	if !templatesRe.Match(data) {
+		return data, nil
+	}
+
+	root, err := toml.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing failed: %w", err)
+	}
+	if !usesTemplates(root) {
+		return data, nil
+	}
+
+	templates, err := parseTemplates(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split the configuration into sections to replace the template related
+	// parts while keeping the remaining text
+	sections, err := splitToSections(root)
+	if err != nil {
+		return nil, fmt.Errorf("splitting to sections failed: %w", err)
+	}
+	sections, err = assignTextToSections(data, sections)
+	if err != nil {
+		return nil, fmt.Errorf("assigning text failed: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for _, s := range sections {
+		switch s.name {
+		case "templates":
+			continue
+		case "instances":
+			rendered, err := renderInstance(s.content, templates)
+			if err != nil {
+				return nil, fmt.Errorf("expanding instance in line %d failed: %w", s.begin, err)
+			}
+			buf.Write(rendered)
+		default:
+			if _, err := s.raw.WriteTo(&buf); err != nil {
+				return nil, fmt.Errorf("writing section %q failed: %w", s.name, err)
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func parseTemplates(root *ast.Table) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	raw, found := root.Fields["templates"]
+	if !found {
+		return templates, nil
+	}
+	tbls, ok := raw.([]*ast.Table)
+	if !ok {
+		return nil, errors.New("templates must be defined as array of tables using [[templates]]")
+	}
+
+	for _, tbl := range tbls {
+		var def templateDefinition
+		if err := toml.UnmarshalTable(tbl, &def); err != nil {
+			return nil, fmt.Errorf("parsing template in line %d failed: %w", tbl.Line, err)
+		}
+		if def.Name == "" {
+			return nil, fmt.Errorf("template in line %d has no name", tbl.Line)
+		}
+		if _, exists := templates[def.Name]; exists {
+			return nil, fmt.Errorf("template %q in line %d is already defined", def.Name, tbl.Line)
+		}
+
+		tmpl, err := template.New(def.Name).Option("missingkey=error").Parse(def.Config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template %q in line %d failed: %w", def.Name, tbl.Line, err)
+		}
+		templates[def.Name] = tmpl
+	}
+
+	return templates, nil
+}
+
+func renderInstance(tbl *ast.Table, templates map[string]*template.Template) ([]byte, error) {
+	var inst templateInstance
+	if err := toml.UnmarshalTable(tbl, &inst); err != nil {
+		return nil, err
+	}
+	tmpl, found := templates[inst.Template]
+	if !found {
+		return nil, fmt.Errorf("undefined template %q", inst.Template)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, inst.Vars); err != nil {
+		return nil, fmt.Errorf("rendering template %q failed: %w", inst.Template, err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Expanded from template %q\n", inst.Template)
+	buf.Write(bytes.TrimSpace(out.Bytes()))
+	buf.WriteString("\n\n")
+
+	// Make sure the result is a valid configuration to provide a meaningful
+	// error instead of failing on the combined configuration later
+	rendered, err := toml.Parse(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("rendered template %q is invalid: %w", inst.Template, err)
+	}
+	if usesTemplates(rendered) {
+		return nil, fmt.Errorf("rendered template %q must not contain templates or instances", inst.Template)
+	}
+	for key, field := range rendered.Fields {
+		if _, ok := field.(*ast.KeyValue); ok {
+			return nil, fmt.Errorf("rendered template %q contains option %q outside of a table", inst.Template, key)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,152 @@
+package config_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestExpandTemplates(t *testing.T) {
+	data, err := os.ReadFile("./testdata/templates.toml")
+	require.NoError(t, err)
+	expected, err := os.ReadFile("./testdata/templates_expected.toml")
+	require.NoError(t, err)
+
+	actual, err := config.ExpandTemplates(data)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(actual))
+}
+
+func TestExpandTemplatesWithoutTemplates(t *testing.T) {
+	data := []byte("[[inputs.memcached]]\n  servers = [\"localhost:11211\"] # local server\n")
+
+	actual, err := config.ExpandTemplates(data)
+	require.NoError(t, err)
+	require.Equal(t, data, actual)
+}
+
+func TestExpandTemplatesUnparsableWithoutTemplates(t *testing.T) {
+	// Environment variables might only result in valid TOML after substitution
+	data := []byte("[[inputs.memcached]]\n  servers = ${SERVERS}\n")
+
+	actual, err := config.ExpandTemplates(data)
+	require.NoError(t, err)
+	require.Equal(t, data, actual)
+}
+
+func TestExpandTemplatesNonStrictEnvironment(t *testing.T) {
+	defer func() { config.NonStrictEnvVarHandling = false }()
+	config.NonStrictEnvVarHandling = true
+	t.Setenv("PORT", "11211")
+
+	data := []byte(`
+[[templates]]
+  name = "server"
+  config = '''
+[[inputs.memcached]]
+  servers = ["localhost:{{ .port }}"]
+'''
+[[instances]]
+  template = "server"
+  vars = { port = ${PORT} }
+`)
+	expected := "\n# Expanded from template \"server\"\n[[inputs.memcached]]\n  servers = [\"localhost:11211\"]\n\n"
+
+	actual, err := config.ExpandTemplates(data)
+	require.NoError(t, err)
+	require.Equal(t, expected, string(actual))
+}
+
+func TestExpandTemplatesInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      string
+		expected string
+	}{
+		{
+			name: "undefined template",
+			cfg: `
+[[instances]]
+  template = "unknown"
+`,
+			expected: `expanding instance in line 2 failed: undefined template "unknown"`,
+		},
+		{
+			name: "duplicate template",
+			cfg: `
+[[templates]]
+  name = "server"
+  config = ""
+[[templates]]
+  name = "server"
+  config = ""
+`,
+			expected: `template "server" in line 5 is already defined`,
+		},
+		{
+			name: "missing variable",
+			cfg: `
+[[templates]]
+  name = "server"
+  config = '''
+[[inputs.memcached]]
+  servers = ["{{ .server }}"]
+'''
+[[instances]]
+  template = "server"
+  vars = { host = "localhost" }
+`,
+			expected: "map has no entry for key",
+		},
+		{
+			name: "invalid result",
+			cfg: `
+[[templates]]
+  name = "server"
+  config = '''
+[[inputs.memcached]]
+  servers = [{{ .server }}]
+'''
+[[instances]]
+  template = "server"
+  vars = { server = "localhost" }
+`,
+			expected: `rendered template "server" is invalid`,
+		},
+		{
+			name: "option outside of table",
+			cfg: `
+[[templates]]
+  name = "server"
+  config = 'servers = ["{{ .server }}"]'
+[[instances]]
+  template = "server"
+  vars = { server = "localhost" }
+`,
+			expected: `rendered template "server" contains option "servers" outside of a table`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.ExpandTemplates([]byte(tt.cfg))
+			require.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestConfig_Templates(t *testing.T) {
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/templates.toml"))
+	require.Len(t, c.Inputs, 4)
+
+	servers := make([]string, 0, len(c.Inputs))
+	for _, input := range c.Inputs {
+		servers = append(servers, input.Input.(*MockupInputPlugin).Servers...)
+	}
+	require.Equal(t, []string{"localhost:11211", "cache-1:11211", "cache-2:11211", "cache-3:11211"}, servers)
+	require.Equal(t, map[string]string{"role": "primary"}, c.Inputs[1].Config.Tags)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/golang/snappy"
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zlib"
 	"github.com/klauspost/compress/zstd"
@@ -113,6 +114,8 @@ func NewContentEncoder(encoding string, options ...EncodingOption) (ContentEncod
 		return NewZlibEncoder(options...)
 	case "zstd":
 		return NewZstdEncoder(options...)
+	case "snappy":
+		return NewSnappyEncoder(options...)
 	default:
 		return nil, errors.New("invalid value for content_encoding")
 	}
@@ -156,6 +159,8 @@ func NewContentDecoder(encoding string, options ...DecodingOption) (ContentDecod
 		return NewZlibDecoder(options...), nil
 	case "zstd":
 		return NewZstdDecoder(options...)
+	case "snappy":
+		return NewSnappyDecoder(options...), nil
 	default:
 		return nil, errors.New("invalid value for content_encoding")
 	}
@@ -318,6 +323,21 @@ func (e *ZstdEncoder) Encode(data []byte) ([]byte, error) {
 	return e.encoder.EncodeAll(data, make([]byte, 0, len(data))), nil
 }
 
+// SnappyEncoder compresses the buffer using the snappy block format.
+type SnappyEncoder struct{}
+
+func NewSnappyEncoder(options ...EncodingOption) (*SnappyEncoder, error) {
+	if len(options) > 0 {
+		return nil, errors.New("snappy encoder does not support options")
+	}
+
+	return &SnappyEncoder{}, nil
+}
+
+func (*SnappyEncoder) Encode(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
 // IdentityEncoder is a null encoder that applies no transformation.
 type IdentityEncoder struct{}
 
@@ -480,6 +500,33 @@ func (d *ZstdDecoder) Decode(data []byte) ([]byte, error) {
 	return d.decoder.DecodeAll(data, nil)
 }
 
+// SnappyDecoder decompresses buffers in the snappy block format.
+type SnappyDecoder struct {
+	maxDecompressionSize int64
+}
+
+func NewSnappyDecoder(options ...DecodingOption) *SnappyDecoder {
+	cfg := decoderConfig{maxDecompressionSize: defaultMaxDecompressionSize}
+	for _, o := range options {
+		o(&cfg)
+	}
+
+	return &SnappyDecoder{maxDecompressionSize: cfg.maxDecompressionSize}
+}
+
+func (*SnappyDecoder) SetEncoding(string) {}
+
+func (d *SnappyDecoder) Decode(data []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > d.maxDecompressionSize {
+		return nil, fmt.Errorf("size of decoded data exceeds allowed size %d", d.maxDecompressionSize)
+	}
+	return snappy.Decode(nil, data)
+}
+
 // IdentityDecoder is a null decoder that returns the input.
 type IdentityDecoder struct {
 }
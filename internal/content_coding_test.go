@@ -112,6 +112,32 @@ func TestZstdReuse(t *testing.T) {
 	require.Equal(t, "doody", string(actual))
 }
 
+func TestSnappyEncodeDecode(t *testing.T) {
+	enc, err := NewSnappyEncoder()
+	require.NoError(t, err)
+	dec := NewSnappyDecoder(WithMaxDecompressionSize(maxDecompressionSize))
+
+	payload, err := enc.Encode([]byte("howdy"))
+	require.NoError(t, err)
+
+	actual, err := dec.Decode(payload)
+	require.NoError(t, err)
+
+	require.Equal(t, "howdy", string(actual))
+}
+
+func TestSnappyEncodeDecodeWithTooLargeMessage(t *testing.T) {
+	enc, err := NewSnappyEncoder()
+	require.NoError(t, err)
+	dec := NewSnappyDecoder(WithMaxDecompressionSize(3))
+
+	payload, err := enc.Encode([]byte("howdy"))
+	require.NoError(t, err)
+
+	_, err = dec.Decode(payload)
+	require.ErrorContains(t, err, "size of decoded data exceeds allowed size 3")
+}
+
 func TestIdentityEncodeDecode(t *testing.T) {
 	dec := NewIdentityDecoder(WithMaxDecompressionSize(maxDecompressionSize))
 	enc, err := NewIdentityEncoder()
@@ -1,6 +1,9 @@
 package internal
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrNotConnected     = errors.New("not connected")
@@ -61,3 +64,35 @@ func (e *PartialWriteError) Error() string {
 func (e *PartialWriteError) Unwrap() error {
 	return e.Err
 }
+
+// PermanentError indicates that writing the metrics failed and will never
+// succeed, e.g. because the metrics are malformed or refused by the service.
+// The metrics should be removed from the buffer instead of being retried.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// RetryableError indicates a temporary failure in writing the metrics, e.g.
+// due to connectivity issues or throttling by the service. The metrics should
+// be retried later. The optional 'RetryAfter' duration denotes the minimum
+// time to wait before retrying as e.g. requested by the service.
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+const (
+	// Minimum and maximum time to wait before retrying to acquire bandwidth
+	minBandwidthWait = 10 * time.Millisecond
+	maxBandwidthWait = time.Second
+)
+
+// BandwidthLimiter limits the number of bytes per second written by one or
+// more outputs. Outputs sharing a limiter are served by priority, i.e. an
+// output only gets bandwidth if no output with a higher priority is waiting.
+type BandwidthLimiter struct {
+	sync.Mutex
+
+	rate    float64 // Bytes per second
+	tokens  float64 // Available bytes, negative if we are in debt
+	updated time.Time
+
+	// Number of waiting writers per priority
+	waiting map[int]int
+}
+
+// NewBandwidthLimiter creates a limiter for the given number of bytes per
+// second allowing a burst of up to one second of traffic.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		rate:    float64(bytesPerSecond),
+		tokens:  float64(bytesPerSecond),
+		updated: time.Now(),
+		waiting: make(map[int]int),
+	}
+}
+
+// Acquire blocks until the given number of bytes can be written by a writer
+// with the given priority. Higher values denote a higher priority. As the
+// size of a batch is not known exactly before writing, a writer might exceed
+// the available bandwidth. This debt is compensated by delaying the following
+// writes.
+func (l *BandwidthLimiter) Acquire(priority int, size int64) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.waiting[priority]++
+	defer func() {
+		l.waiting[priority]--
+		if l.waiting[priority] == 0 {
+			delete(l.waiting, priority)
+		}
+	}()
+
+	for {
+		l.refill()
+		if l.tokens > 0 && !l.preempted(priority) {
+			l.tokens -= float64(size)
+			return
+		}
+
+		// Wait for the debt to be paid off or for the higher priority writers
+		// to finish
+		wait := minBandwidthWait
+		if l.tokens <= 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+		wait = min(max(wait, minBandwidthWait), maxBandwidthWait)
+
+		l.Unlock()
+		time.Sleep(wait)
+		l.Lock()
+	}
+}
+
+// refill adds the bandwidth accumulated since the last update
+func (l *BandwidthLimiter) refill() {
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.updated).Seconds()*l.rate, l.rate)
+	l.updated = now
+}
+
+// preempted returns true if a writer with a higher priority is waiting
+func (l *BandwidthLimiter) preempted(priority int) bool {
+	for p := range l.waiting {
+		if p > priority {
+			return true
+		}
+	}
+	return false
+}
+
+// estimateSize returns the approximate number of bytes required to transmit
+// the given metrics, i.e. the size of the name, the tags and the fields.
+func estimateSize(metrics []telegraf.Metric) int64 {
+	var size int
+	for _, m := range metrics {
+		size += len(m.Name()) + 8 // timestamp
+		for _, tag := range m.TagList() {
+			size += len(tag.Key) + len(tag.Value)
+		}
+		for _, field := range m.FieldList() {
+			size += len(field.Key)
+			if v, ok := field.Value.(string); ok {
+				size += len(v)
+			} else {
+				size += 8
+			}
+		}
+	}
+	return int64(size)
+}
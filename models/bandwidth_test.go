@@ -0,0 +1,73 @@
+package models
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestBandwidthLimiterRate(t *testing.T) {
+	limiter := NewBandwidthLimiter(100000)
+
+	// The initial burst is available immediately, the debt caused by the
+	// second write must delay the third write
+	start := time.Now()
+	limiter.Acquire(0, 100000)
+	limiter.Acquire(0, 20000)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	limiter.Acquire(0, 1)
+	require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestBandwidthLimiterPriority(t *testing.T) {
+	limiter := NewBandwidthLimiter(100000)
+
+	// Exhaust the bandwidth so the following writers need to wait
+	limiter.Acquire(0, 120000)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for _, priority := range []int{1, 10} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Acquire(priority, 100000)
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+		}()
+		// Make sure the low priority writer is waiting first
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+
+	require.Equal(t, []int{10, 1}, order)
+}
+
+func TestRunningOutputMaxBytesPerSecond(t *testing.T) {
+	m := metric.New("cpu", map[string]string{"host": "localhost"}, map[string]interface{}{"value": 42.0}, time.Unix(0, 0))
+	size := estimateSize([]telegraf.Metric{m})
+	require.Equal(t, int64(len("cpu")+8+len("host")+len("localhost")+len("value")+8), size)
+
+	conf := &OutputConfig{
+		Filter:            Filter{},
+		MaxBytesPerSecond: 10 * size,
+	}
+	ro, err := NewRunningOutput(&mockOutput{}, conf, 10, 1000)
+	require.NoError(t, err)
+
+	// Writing the first batch uses up the burst, the second one causes a debt
+	// of one second which delays the third batch
+	start := time.Now()
+	for range 30 {
+		ro.AddMetric(m)
+	}
+	require.NoError(t, ro.Write())
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
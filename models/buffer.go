@@ -41,6 +41,13 @@ func (tx *Transaction) AcceptAll() {
 	}
 }
 
+func (tx *Transaction) RejectAll() {
+	tx.Reject = make([]int, len(tx.Batch))
+	for i := range tx.Batch {
+		tx.Reject[i] = i
+	}
+}
+
 func (*Transaction) KeepAll() {}
 
 func (tx *Transaction) InferKeep() []int {
@@ -92,12 +99,16 @@ type BufferStats struct {
 	MetricsDropped  selfstat.Stat
 	BufferSize      selfstat.Stat
 	BufferLimit     selfstat.Stat
+
+	// Statistics on recovering corrupt buffer files
+	BufferRecoveries selfstat.Stat
+	MetricsLost      selfstat.Stat
 }
 
 // NewBuffer returns a new empty Buffer with the given capacity.
 //
 //nolint:revive //will move to structs later
-func NewBuffer(name, id, alias string, capacity int, strategy, path string, diskSync bool) (Buffer, error) {
+func NewBuffer(name, id, alias string, capacity int, strategy, path string, diskSync bool, diskOpts DiskBufferOptions) (Buffer, error) {
 	registerGob()
 
 	tags := map[string]string{
@@ -113,7 +124,9 @@ func NewBuffer(name, id, alias string, capacity int, strategy, path string, disk
 	case "", "memory":
 		return NewMemoryBuffer(capacity, bs)
 	case "disk_write_through":
-		return NewDiskBuffer(id, path, bs, diskSync)
+		return NewDiskBuffer(id, path, bs, diskSync, diskOpts)
+	case "memory_spill":
+		return NewSpillBuffer(id, path, capacity, bs, diskSync, diskOpts)
 	}
 	return nil, fmt.Errorf("invalid buffer strategy %q", strategy)
 }
@@ -150,6 +163,16 @@ func NewBufferStats(tags map[string]string, capacity int) BufferStats {
 			"buffer_limit",
 			tags,
 		),
+		BufferRecoveries: selfstat.Register(
+			"write",
+			"buffer_recoveries",
+			tags,
+		),
+		MetricsLost: selfstat.Register(
+			"write",
+			"metrics_lost",
+			tags,
+		),
 	}
 	bs.BufferSize.Set(int64(0))
 	bs.BufferLimit.Set(int64(capacity))
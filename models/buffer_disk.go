@@ -15,12 +15,57 @@ import (
 	"github.com/influxdata/telegraf/metric"
 )
 
+// DiskBufferOptions contains optional settings for disk-backed buffers
+type DiskBufferOptions struct {
+	// MaxSize is the maximum number of bytes of serialized metrics kept in
+	// the buffer. A value of zero disables the limit.
+	MaxSize int64
+
+	// OverflowPolicy determines how to handle new metrics if the buffer
+	// reached its maximum size. Valid values are "drop_oldest" (default),
+	// "drop_newest" and "block_inputs".
+	OverflowPolicy string
+
+	// CorruptionRecovery determines how to handle a corrupt WAL file on
+	// startup. Valid values are "error" (default), "truncate" and
+	// "quarantine".
+	CorruptionRecovery string
+
+	// Compression of the persisted metrics. Valid values are "none" (default),
+	// "zstd", "snappy", "gzip" and "zlib".
+	Compression string
+
+	// EncryptionKey returns the hex-encoded AES key used to encrypt the
+	// persisted metrics. The function is called on first use of the key. A
+	// nil function disables encryption.
+	EncryptionKey func() ([]byte, error)
+}
+
+// diskTransactionState holds the offsets and sizes of the metrics in a
+// transaction relative to the start of the WAL file.
+type diskTransactionState struct {
+	offsets []int
+	sizes   []int64
+}
+
 type DiskBuffer struct {
 	BufferStats
 	sync.Mutex
 
-	file *wal.Log
-	path string
+	file  *wal.Log
+	path  string
+	codec *diskCodec
+
+	maxSize        int64      // Maximum number of bytes for the buffered metrics
+	overflowPolicy string     // Handling of new metrics if the buffer is full
+	size           int64      // Number of bytes of the metrics in the buffer
+	space          *sync.Cond // Signaled if buffer space is freed up
+	unblocked      bool       // Do not block on a full buffer anymore
+	closed         bool
+
+	// Offsets of the metrics that are part of the currently active transaction
+	// and must not be evicted.
+	inflight []int
 
 	batchFirst uint64 // Index of the first metric in the batch
 	batchSize  uint64 // Number of metrics currently in the batch
@@ -35,12 +80,44 @@ type DiskBuffer struct {
 	mask []int
 }
 
-func NewDiskBuffer(id, path string, stats BufferStats, diskSync bool) (*DiskBuffer, error) {
+func NewDiskBuffer(id, path string, stats BufferStats, diskSync bool, opts DiskBufferOptions) (*DiskBuffer, error) {
+	switch opts.OverflowPolicy {
+	case "":
+		opts.OverflowPolicy = "drop_oldest"
+	case "drop_oldest", "drop_newest", "block_inputs":
+	default:
+		return nil, fmt.Errorf("invalid buffer overflow policy %q", opts.OverflowPolicy)
+	}
+	if opts.MaxSize < 0 {
+		return nil, fmt.Errorf("invalid maximum buffer size %d", opts.MaxSize)
+	}
+	switch opts.CorruptionRecovery {
+	case "", "error", "truncate", "quarantine":
+	default:
+		return nil, fmt.Errorf("invalid buffer corruption recovery %q", opts.CorruptionRecovery)
+	}
+	codec, err := newDiskCodec(opts.Compression, opts.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
 	filePath := filepath.Join(path, id)
-	walFile, err := wal.Open(filePath, &wal.Options{
+	walOpts := &wal.Options{
 		AllowEmpty: true,
 		NoSync:     !diskSync,
-	})
+	}
+	walFile, err := wal.Open(filePath, walOpts)
+	if errors.Is(err, wal.ErrCorrupt) && opts.CorruptionRecovery != "" && opts.CorruptionRecovery != "error" {
+		lost, rerr := recoverWAL(filePath, opts.CorruptionRecovery)
+		if rerr != nil {
+			return nil, fmt.Errorf("recovering corrupt wal file at %q failed: %w", filePath, rerr)
+		}
+		log.Printf("W! Recovered corrupt wal file at %q using %q, lost %d metrics", filePath, opts.CorruptionRecovery, lost)
+		stats.BufferRecoveries.Incr(1)
+		stats.MetricsLost.Incr(int64(lost))
+
+		walFile, err = wal.Open(filePath, walOpts)
+	}
 	if err != nil {
 		if errors.Is(err, wal.ErrCorrupt) {
 			return nil, fmt.Errorf("wal file is corrupt, you have to manually delete the wal at %q and restart Telegraf", filePath)
@@ -49,13 +126,29 @@ func NewDiskBuffer(id, path string, stats BufferStats, diskSync bool) (*DiskBuff
 	}
 
 	buf := &DiskBuffer{
-		BufferStats: stats,
-		file:        walFile,
-		path:        filePath,
+		BufferStats:    stats,
+		file:           walFile,
+		path:           filePath,
+		codec:          codec,
+		maxSize:        opts.MaxSize,
+		overflowPolicy: opts.OverflowPolicy,
 	}
+	buf.space = sync.NewCond(&buf.Mutex)
 	if buf.Len() > 0 {
 		buf.originalEnd = buf.writeIndex()
 	}
+
+	// Determine the size of the existing metrics to keep the accounting
+	// consistent when removing them later on
+	for idx := buf.readIndex(); idx > 0 && idx < buf.writeIndex(); idx++ {
+		data, err := walFile.Read(idx)
+		if err != nil {
+			walFile.Close()
+			return nil, fmt.Errorf("reading wal entry %d failed: %w", idx, err)
+		}
+		buf.size += int64(len(data))
+	}
+
 	return buf, nil
 }
 
@@ -98,30 +191,167 @@ func (b *DiskBuffer) Add(metrics ...telegraf.Metric) int {
 	b.Lock()
 	defer b.Unlock()
 
+	// Metrics might still be routed to the output while it is being removed
+	if b.closed {
+		for _, m := range metrics {
+			b.metricDropped(m)
+		}
+		return len(metrics)
+	}
+
 	var batch wal.Batch
+	var dropped, batchLen int
+	var batchSize int64
 	idx := b.writeIndex()
-	startIdx := idx
-	for _, m := range metrics {
+	for i, m := range metrics {
 		data, err := metric.ToBytes(m)
 		if err != nil {
 			panic(err)
 		}
+		if data, err = b.codec.encode(data); err != nil {
+			log.Printf("E! Encoding metric for buffer %q failed: %v", b.path, err)
+			b.metricDropped(m)
+			dropped++
+			continue
+		}
+		size := int64(len(data))
+
+		// Make sure the metric fits into the buffer if a size limit is set
+		if b.maxSize > 0 && b.size+batchSize+size > b.maxSize {
+			// Persist the pending metrics first as they might need to be
+			// evicted or as the lock is released while waiting for space.
+			if batchLen > 0 {
+				if n := b.writeBatch(&batch, batchLen, batchSize); n > 0 {
+					return dropped + n + len(metrics) - i
+				}
+				batch.Clear()
+				batchLen, batchSize = 0, 0
+			}
+
+			if size > b.maxSize {
+				b.metricDropped(m)
+				dropped++
+				continue
+			}
+			evicted, ok := b.makeRoom(size)
+			dropped += evicted
+			if !ok {
+				b.metricDropped(m)
+				dropped++
+				continue
+			}
+			idx = b.writeIndex() + uint64(batchLen)
+		}
+
 		batch.Write(idx, data)
+		batchLen++
+		batchSize += size
 		idx++
 	}
+	dropped += b.writeBatch(&batch, batchLen, batchSize)
+
+	b.BufferSize.Set(int64(b.length()))
+	return dropped
+}
 
-	if err := b.file.WriteBatch(&batch); err != nil {
+// writeBatch persists the given batch containing the given number of metrics
+// with the given size and returns the number of metrics that failed to write.
+func (b *DiskBuffer) writeBatch(batch *wal.Batch, count int, size int64) int {
+	startIdx := b.writeIndex()
+	if err := b.file.WriteBatch(batch); err != nil {
 		// This calculation assumes a single writer to the WAL, which is
 		// guaranteed by the mutex and one WAL per buffer instance.
-		dropped := uint64(len(metrics)) - (b.writeIndex() - startIdx)
-		return int(dropped)
+		return count - int(b.writeIndex()-startIdx)
 	}
 
-	b.metricAdded(int64(len(metrics)))
-	b.BufferSize.Set(int64(b.length()))
+	b.size += size
+	b.metricAdded(int64(count))
 	return 0
 }
 
+// makeRoom frees up the given amount of buffer space according to the
+// overflow policy. The function returns the number of evicted metrics and
+// false if the space cannot be freed and new metrics must be dropped.
+func (b *DiskBuffer) makeRoom(size int64) (int, bool) {
+	switch b.overflowPolicy {
+	case "drop_newest":
+		return 0, false
+	case "block_inputs":
+		// Wait for metrics being written by the output to free up space. We
+		// cannot wait if the buffer does not contain any metric as no space
+		// will ever be freed up in this case.
+		for b.size+size > b.maxSize && b.length() > 0 && !b.closed && !b.unblocked {
+			b.space.Wait()
+		}
+		return 0, !b.closed && b.size+size <= b.maxSize
+	}
+
+	// Drop the oldest metrics not being part of the current transaction
+	// until the new metric fits into the buffer
+	evicted := b.evict(b.size + size - b.maxSize)
+	return evicted, b.size+size <= b.maxSize
+}
+
+// evict removes the oldest metrics until at least the given number of bytes
+// is freed up and returns the number of evicted metrics. Metrics being part of
+// the currently active transaction are skipped.
+func (b *DiskBuffer) evict(size int64) int {
+	if b.entries() == 0 {
+		return 0
+	}
+
+	var evicted int
+	var freed int64
+	readIndex := b.readIndex()
+	endIndex := b.writeIndex()
+	for offset := 0; freed < size && readIndex < endIndex; offset++ {
+		idx := readIndex
+		readIndex++
+		if slices.Contains(b.mask, offset) || slices.Contains(b.inflight, offset) {
+			continue
+		}
+
+		data, err := b.file.Read(idx)
+		if err != nil {
+			// Stop evicting as we cannot determine the size of the entry
+			log.Printf("E! Reading metric %d of buffer %q failed: %v", idx, b.path, err)
+			break
+		}
+		b.mask = append(b.mask, offset)
+		b.size -= int64(len(data))
+		freed += int64(len(data))
+		evicted++
+
+		decoded, err := b.codec.decode(data)
+		if err != nil {
+			// The metric cannot be restored so we cannot notify anyone.
+			b.MetricsLost.Incr(1)
+			continue
+		}
+		m, err := metric.FromBytes(decoded)
+		if err != nil {
+			if !errors.Is(err, metric.ErrSkipTracking) {
+				// The entry is corrupted so we cannot notify anyone.
+				log.Printf("E! Deserializing metric of buffer %q failed, dropping metric: %v", b.path, err)
+				b.MetricsLost.Incr(1)
+			}
+			// Otherwise there is no tracking information for this metric
+			// anymore so we cannot notify anyone either.
+			continue
+		}
+		b.metricDropped(m)
+	}
+	sort.Ints(b.mask)
+
+	// We can only remove the metrics from the file if there is no active
+	// transaction as the offsets of the transaction would be invalid otherwise.
+	if len(b.inflight) == 0 {
+		b.truncate()
+	}
+
+	return evicted
+}
+
 func (b *DiskBuffer) BeginTransaction(batchSize int) *Transaction {
 	b.Lock()
 	defer b.Unlock()
@@ -134,6 +364,7 @@ func (b *DiskBuffer) BeginTransaction(batchSize int) *Transaction {
 
 	metrics := make([]telegraf.Metric, 0, batchSize)
 	offsets := make([]int, 0, batchSize)
+	sizes := make([]int64, 0, batchSize)
 	readIndex := b.batchFirst
 	endIndex := b.writeIndex()
 	for offset := 0; batchSize > 0 && readIndex < endIndex; offset++ {
@@ -156,12 +387,29 @@ func (b *DiskBuffer) BeginTransaction(batchSize int) *Transaction {
 		// - ErrSkipTracking:  means that the tracking information was unable to be found for a tracking ID.
 		// - Outside of range: means that the metric was guaranteed to be left over from the previous instance
 		//                     as it was here when we opened the wal file in this instance.
-		m, err := metric.FromBytes(data)
+		decoded, err := b.codec.decode(data)
+		if err != nil {
+			if errors.Is(err, errDiskKeyUnavailable) || errors.Is(err, errDiskKeyMismatch) {
+				// Keep the metrics in the buffer and retry on the next write
+				// as the key might be fixed, e.g. in the secret-store
+				log.Printf("E! Decoding metrics of buffer %q failed, keeping metrics: %v", b.path, err)
+				break
+			}
+			// The entry is corrupted so the metric is lost. Mask it so it is
+			// truncated later on.
+			log.Printf("E! Decoding metric of buffer %q failed, dropping metric: %v", b.path, err)
+			b.mask = append(b.mask, offset)
+			b.size -= int64(len(data))
+			b.MetricsLost.Incr(1)
+			continue
+		}
+		m, err := metric.FromBytes(decoded)
 		if err != nil {
 			if errors.Is(err, metric.ErrSkipTracking) {
 				// Could not look up tracking information for metric so skip
 				// the metric and mask it so it is truncated later on.
 				b.mask = append(b.mask, offset)
+				b.size -= int64(len(data))
 				continue
 			}
 			// non-recoverable error in deserialization, abort
@@ -173,15 +421,20 @@ func (b *DiskBuffer) BeginTransaction(batchSize int) *Transaction {
 			// after restarting Telegraf. Skip the metric and mask it so it is
 			// trucated later on
 			b.mask = append(b.mask, offset)
+			b.size -= int64(len(data))
 			continue
 		}
 
 		metrics = append(metrics, m)
 		offsets = append(offsets, offset)
+		sizes = append(sizes, int64(len(data)))
 		b.batchSize++
 		batchSize--
 	}
-	return &Transaction{Batch: metrics, valid: true, state: offsets}
+	b.inflight = offsets
+
+	state := &diskTransactionState{offsets: offsets, sizes: sizes}
+	return &Transaction{Batch: metrics, valid: true, state: state}
 }
 
 func (b *DiskBuffer) EndTransaction(tx *Transaction) {
@@ -195,73 +448,103 @@ func (b *DiskBuffer) EndTransaction(tx *Transaction) {
 	}
 	tx.valid = false
 
-	// Get the metric offsets from the transaction
-	offsets := tx.state.([]int)
+	// Get the metric offsets and sizes from the transaction
+	state := tx.state.(*diskTransactionState)
 
 	b.Lock()
 	defer b.Unlock()
 
+	// Wake up waiting writers as buffer space might have been freed up. This
+	// is deferred to also wake them up if the transaction ends early.
+	defer b.space.Broadcast()
+
 	// Mark metrics which should be removed in the internal mask
 	remove := make([]int, 0, len(tx.Accept)+len(tx.Reject))
 	for _, idx := range tx.Accept {
 		b.metricWritten(tx.Batch[idx])
-		remove = append(remove, offsets[idx])
+		remove = append(remove, state.offsets[idx])
+		b.size -= state.sizes[idx]
 	}
 	for _, idx := range tx.Reject {
 		b.metricRejected(tx.Batch[idx])
-		remove = append(remove, offsets[idx])
+		remove = append(remove, state.offsets[idx])
+		b.size -= state.sizes[idx]
 	}
 	b.mask = append(b.mask, remove...)
 	sort.Ints(b.mask)
+	b.inflight = nil
 
 	// Remove the metrics that are marked for removal from the front of the
 	// WAL file. All other metrics must be kept.
+	if !b.truncate() {
+		return
+	}
+
+	// check if the original end index is still valid, clear if not
+	if b.originalEnd < b.readIndex() {
+		b.originalEnd = 0
+	}
+
+	b.resetBatch()
+	b.BufferSize.Set(int64(b.length()))
+}
+
+// truncate removes the metrics marked for removal from the front of the WAL
+// file and returns true if any metric was removed.
+func (b *DiskBuffer) truncate() bool {
 	if len(b.mask) == 0 || b.mask[0] != 0 {
 		// Mask is empty or the first index is not the front of the file, so
 		// exit early as there is nothing to remove
-		return
+		return false
 	}
 
-	// Determine up to which index we can remove the entries from the WAL file
-	var correction int
+	// Determine up to which index we can remove the entries from the WAL file.
+	// The 'removeIdx' denotes the index to use when truncating the file and
+	// mask and is also the offset to subtract from the remaining mask (if any).
+	var removeIdx int
 	for i, offset := range b.mask {
 		if offset != i {
 			break
 		}
-		correction = offset
+		removeIdx = offset + 1
 	}
-	// The 'correction' denotes the offset to subtract from the remaining mask
-	// (if any) and the 'removalIdx' denotes the index to use when truncating
-	// the file and mask. Keep them separate to be able to handle the special
-	// "the file cannot be empty" property of the WAL file.
-	removeIdx := correction + 1
 
 	// Remove the metrics in front from the WAL file
-	if err := b.file.TruncateFront(b.batchFirst + uint64(removeIdx)); err != nil {
-		log.Printf("E! batch length: %d, first: %d, size: %d", len(tx.Batch), b.batchFirst, b.batchSize)
+	first := b.readIndex()
+	if err := b.file.TruncateFront(first + uint64(removeIdx)); err != nil {
+		log.Printf("E! first: %d, batch first: %d, size: %d", first, b.batchFirst, b.batchSize)
 		panic(err)
 	}
 
 	// Truncate the mask and update the relative offsets
 	b.mask = b.mask[removeIdx:]
 	for i := range b.mask {
-		b.mask[i] -= correction
+		b.mask[i] -= removeIdx
 	}
 
-	// check if the original end index is still valid, clear if not
-	if b.originalEnd < b.readIndex() {
-		b.originalEnd = 0
-	}
-
-	b.resetBatch()
-	b.BufferSize.Set(int64(b.length()))
+	return true
 }
 
 func (b *DiskBuffer) Stats() BufferStats {
 	return b.BufferStats
 }
 
+// Unblock makes adding metrics to a full buffer drop the new metrics instead of
+// waiting for space to be freed up with the "block_inputs" overflow policy.
+func (b *DiskBuffer) Unblock() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.unblocked = true
+	b.space.Broadcast()
+}
+
 func (b *DiskBuffer) Close() error {
+	b.Lock()
+	b.closed = true
+	b.space.Broadcast()
+	b.Unlock()
+
 	if err := b.file.Close(); err != nil {
 		return fmt.Errorf("closing buffer failed: %w", err)
 	}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+// Entries written with compression or encryption enabled are prefixed by a
+// header consisting of a marker byte followed by the compression and the
+// encryption identifiers. Gob encoded metrics never start with a zero byte, so
+// entries without the marker are plain metrics e.g. written by older versions.
+const (
+	diskEntryMarker     byte = 0x00
+	diskEntryHeaderSize      = 3
+)
+
+const (
+	diskEncryptionNone byte = iota
+	diskEncryptionAESGCM
+)
+
+// Identifiers of the compression algorithms stored in the entry header. Do not
+// change the values as they are persisted on disk!
+var diskCompressions = map[string]byte{
+	"none":   0,
+	"zstd":   1,
+	"snappy": 2,
+	"gzip":   3,
+	"zlib":   4,
+}
+
+// errDiskKeyUnavailable is returned if the encryption key cannot be retrieved
+var errDiskKeyUnavailable = errors.New("encryption key unavailable")
+
+// errDiskKeyMismatch is returned if an entry fails the authentication, e.g.
+// because it was encrypted with another key. AES-GCM cannot distinguish this
+// from a tampered entry.
+var errDiskKeyMismatch = errors.New("authentication failed, possibly encrypted with another key")
+
+// diskCodec encodes and decodes the metric data persisted in the WAL file
+// applying the configured compression and encryption
+type diskCodec struct {
+	compression byte
+	encoder     internal.ContentEncoder
+	decoders    map[byte]internal.ContentDecoder
+
+	key  func() ([]byte, error)
+	aead cipher.AEAD
+}
+
+func newDiskCodec(compression string, key func() ([]byte, error)) (*diskCodec, error) {
+	if compression == "" {
+		compression = "none"
+	}
+	id, found := diskCompressions[compression]
+	if !found {
+		return nil, fmt.Errorf("invalid buffer compression %q", compression)
+	}
+
+	c := &diskCodec{
+		compression: id,
+		decoders:    make(map[byte]internal.ContentDecoder),
+		key:         key,
+	}
+	if compression != "none" {
+		encoder, err := internal.NewContentEncoder(compression)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s encoder failed: %w", compression, err)
+		}
+		c.encoder = encoder
+	}
+	return c, nil
+}
+
+// encode compresses and encrypts the given serialized metric
+func (c *diskCodec) encode(data []byte) ([]byte, error) {
+	// Keep the plain format if there is nothing to do
+	if c.encoder == nil && c.key == nil {
+		return data, nil
+	}
+
+	header := []byte{diskEntryMarker, c.compression, diskEncryptionNone}
+	if c.encoder != nil {
+		encoded, err := c.encoder.Encode(data)
+		if err != nil {
+			return nil, fmt.Errorf("compressing entry failed: %w", err)
+		}
+		data = encoded
+	}
+	if c.key == nil {
+		return append(header, data...), nil
+	}
+
+	aead, err := c.cipher()
+	if err != nil {
+		return nil, err
+	}
+	header[2] = diskEncryptionAESGCM
+
+	// Output the header followed by the nonce and the sealed data. The header
+	// is authenticated to detect tampering with the compression settings.
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce failed: %w", err)
+	}
+	out := make([]byte, 0, diskEntryHeaderSize+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+// decode decrypts and decompresses the given WAL entry
+func (c *diskCodec) decode(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != diskEntryMarker {
+		return data, nil
+	}
+	if len(data) < diskEntryHeaderSize {
+		return nil, errors.New("entry header too short")
+	}
+	header, payload := data[:diskEntryHeaderSize], data[diskEntryHeaderSize:]
+
+	switch header[2] {
+	case diskEncryptionNone:
+	case diskEncryptionAESGCM:
+		if c.key == nil {
+			return nil, fmt.Errorf("entry is encrypted: %w", errDiskKeyUnavailable)
+		}
+		aead, err := c.cipher()
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) < aead.NonceSize() {
+			return nil, errors.New("encrypted entry too short")
+		}
+		nonce, sealed := payload[:aead.NonceSize()], payload[aead.NonceSize():]
+		plain, err := aead.Open(nil, nonce, sealed, header)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting entry failed: %w", errDiskKeyMismatch)
+		}
+		payload = plain
+	default:
+		return nil, fmt.Errorf("unknown encryption %d", header[2])
+	}
+
+	if header[1] == diskCompressions["none"] {
+		return payload, nil
+	}
+	decoder, err := c.decoder(header[1])
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decoder.Decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing entry failed: %w", err)
+	}
+	return decoded, nil
+}
+
+// decoder returns the decoder for the given compression identifier. Entries
+// might be written with another compression than the configured one, e.g.
+// after changing the setting, so all decoders must be available.
+func (c *diskCodec) decoder(id byte) (internal.ContentDecoder, error) {
+	if d, found := c.decoders[id]; found {
+		return d, nil
+	}
+
+	for name, cid := range diskCompressions {
+		if cid != id {
+			continue
+		}
+		d, err := internal.NewContentDecoder(name)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s decoder failed: %w", name, err)
+		}
+		c.decoders[id] = d
+		return d, nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", id)
+}
+
+// cipher lazily creates the AES-GCM cipher as the key might be resolved from
+// a secret-store which is not available when creating the buffer.
+func (c *diskCodec) cipher() (cipher.AEAD, error) {
+	if c.aead != nil {
+		return c.aead, nil
+	}
+
+	raw, err := c.key()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDiskKeyUnavailable, err)
+	}
+	key, err := parseDiskEncryptionKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDiskKeyUnavailable, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher failed: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher failed: %w", err)
+	}
+	c.aead = aead
+
+	return aead, nil
+}
+
+// parseDiskEncryptionKey decodes the given hex-encoded AES key
+func parseDiskEncryptionKey(raw []byte) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key failed: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("invalid encryption key length %d, expected 16, 24 or 32 bytes", len(key))
+	}
+	return key, nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/tidwall/wal"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// DiskBufferFile provides offline access to the WAL file of a disk buffer e.g.
+// for inspecting or modifying the buffer content while Telegraf is not running.
+type DiskBufferFile struct {
+	file  *wal.Log
+	path  string
+	codec *diskCodec
+}
+
+// OpenDiskBufferFile opens the existing buffer file at the given path. The
+// encryption key is only required for reading encrypted buffers and might be
+// nil otherwise.
+func OpenDiskBufferFile(path string, encryptionKey func() ([]byte, error)) (*DiskBufferFile, error) {
+	registerGob()
+
+	// Do not implicitly create a new buffer file
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	// Compression is detected per entry when decoding
+	codec, err := newDiskCodec("", encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	walFile, err := wal.Open(path, &wal.Options{AllowEmpty: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening wal file %q failed: %w", path, err)
+	}
+	return &DiskBufferFile{file: walFile, path: path, codec: codec}, nil
+}
+
+// Len returns the number of metrics in the buffer file
+func (f *DiskBufferFile) Len() (int, error) {
+	first, last, err := f.indices()
+	if err != nil {
+		return 0, err
+	}
+	return int(last - first), nil
+}
+
+// Walk calls the given function for up to 'count' metrics starting from the
+// oldest metric in the buffer. A negative count walks all metrics.
+func (f *DiskBufferFile) Walk(count int, fn func(telegraf.Metric) error) error {
+	first, last, err := f.indices()
+	if err != nil {
+		return err
+	}
+
+	for idx := first; idx < last && count != 0; idx++ {
+		data, err := f.file.Read(idx)
+		if err != nil {
+			return fmt.Errorf("reading entry %d failed: %w", idx, err)
+		}
+
+		if data, err = f.codec.decode(data); err != nil {
+			return fmt.Errorf("decoding entry %d failed: %w", idx, err)
+		}
+
+		// Tracking information is not available outside of the running
+		// instance so ignore the error and use the plain metric.
+		m, err := metric.FromBytes(data)
+		if err != nil && !errors.Is(err, metric.ErrSkipTracking) {
+			return fmt.Errorf("decoding entry %d failed: %w", idx, err)
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+		count--
+	}
+	return nil
+}
+
+// Drop removes the given number of the oldest metrics from the buffer file
+func (f *DiskBufferFile) Drop(count int) error {
+	first, last, err := f.indices()
+	if err != nil {
+		return err
+	}
+
+	if first == last {
+		return nil
+	}
+
+	idx := min(first+uint64(count), last)
+	if err := f.file.TruncateFront(idx); err != nil {
+		return fmt.Errorf("truncating wal file failed: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying WAL file
+func (f *DiskBufferFile) Close() error {
+	return f.file.Close()
+}
+
+// indices returns the index of the first metric and one after the index
+// of the last metric.
+func (f *DiskBufferFile) indices() (first, last uint64, err error) {
+	first, err = f.file.FirstIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+	if first == 0 {
+		return 0, 0, nil
+	}
+	last, err = f.file.LastIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+	return first, last + 1, nil
+}
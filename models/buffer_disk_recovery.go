@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// recoverWAL tries to recover the corrupt WAL file at the given path using
+// the given mode and returns the number of metrics lost in the process.
+func recoverWAL(path, mode string) (int, error) {
+	switch mode {
+	case "truncate":
+		lost, err := truncateWAL(path)
+		if err == nil {
+			return lost, nil
+		}
+		// Fall back to moving the file out of the way if we are not able to
+		// repair the file
+		quarantined, qerr := quarantineWAL(path)
+		if qerr != nil {
+			return 0, errors.Join(err, qerr)
+		}
+		return lost + quarantined, nil
+	case "quarantine":
+		return quarantineWAL(path)
+	}
+	return 0, fmt.Errorf("invalid recovery mode %q", mode)
+}
+
+// truncateWAL removes the corrupt data starting at the first invalid entry
+// including all subsequent segments.
+func truncateWAL(path string) (int, error) {
+	segments, err := walSegments(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var lost int
+	var truncated bool
+	for i, segment := range segments {
+		// Remove all segments following the corrupted one as those cannot
+		// be read anymore due to the index gap.
+		if truncated {
+			if n, err := countWALEntries(segment); err == nil {
+				lost += n
+			}
+			if err := os.Remove(segment); err != nil {
+				return lost, fmt.Errorf("removing segment failed: %w", err)
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(segment)
+		if err != nil {
+			return 0, fmt.Errorf("reading segment failed: %w", err)
+		}
+		valid := validWALEntries(data)
+		if valid == len(data) {
+			continue
+		}
+
+		// Cut the segment at the last valid entry, the remaining data is
+		// considered one corrupt entry. Remove the segment completely if
+		// there is no valid data left and it is not the first segment.
+		truncated = true
+		lost++
+		if valid == 0 && i > 0 {
+			err = os.Remove(segment)
+		} else {
+			err = os.Truncate(segment, int64(valid))
+		}
+		if err != nil {
+			return lost, fmt.Errorf("truncating segment failed: %w", err)
+		}
+	}
+
+	if !truncated {
+		return 0, errors.New("no corrupt segment found")
+	}
+	return lost, nil
+}
+
+// quarantineWAL moves the WAL directory to a sibling with ".corrupt" suffix
+// to allow a later inspection of the data.
+func quarantineWAL(path string) (int, error) {
+	segments, err := walSegments(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var lost int
+	for _, segment := range segments {
+		if n, err := countWALEntries(segment); err == nil {
+			lost += n
+		}
+	}
+
+	target := path + ".corrupt"
+	if _, err := os.Stat(target); err == nil {
+		target = path + "." + strconv.FormatInt(time.Now().Unix(), 10) + ".corrupt"
+	}
+	if err := os.Rename(path, target); err != nil {
+		return lost, fmt.Errorf("moving corrupt wal file failed: %w", err)
+	}
+	return lost, nil
+}
+
+// walSegments returns the sorted list of segment files of the WAL at path.
+// Segments with an interrupted truncation (.START or .END files) are not
+// supported and cause an error.
+func walSegments(path string) ([]string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading wal directory failed: %w", err)
+	}
+
+	segments := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || len(name) < 20 {
+			continue
+		}
+		if _, err := strconv.ParseUint(name[:20], 10, 64); err != nil {
+			continue
+		}
+		if len(name) != 20 {
+			return nil, fmt.Errorf("unsupported segment %q", name)
+		}
+		segments = append(segments, filepath.Join(path, name))
+	}
+	slices.Sort(segments)
+
+	return segments, nil
+}
+
+// countWALEntries returns the number of valid entries in the given segment
+func countWALEntries(segment string) (int, error) {
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for len(data) > 0 {
+		n := nextWALEntry(data)
+		if n == 0 {
+			break
+		}
+		data = data[n:]
+		count++
+	}
+	return count, nil
+}
+
+// validWALEntries returns the number of bytes of valid entries at the start
+// of the given segment data
+func validWALEntries(data []byte) int {
+	var pos int
+	for pos < len(data) {
+		n := nextWALEntry(data[pos:])
+		if n == 0 {
+			break
+		}
+		pos += n
+	}
+	return pos
+}
+
+// nextWALEntry returns the length of the next entry in binary WAL format
+// consisting of the data size followed by the data. The function returns zero
+// if the entry is invalid.
+func nextWALEntry(data []byte) int {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return 0
+	}
+	return n + int(size)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"os"
 	"path/filepath"
 	"sync"
 	"testing"
@@ -18,7 +19,7 @@ import (
 // https://github.com/influxdata/telegraf/issues/16696
 func TestDiskBufferTruncate(t *testing.T) {
 	// Create a disk buffer
-	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true)
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, DiskBufferOptions{})
 	require.NoError(t, err)
 	defer buf.Close()
 	diskBuf, ok := buf.(*DiskBuffer)
@@ -71,12 +72,50 @@ func TestDiskBufferTruncate(t *testing.T) {
 	require.Empty(t, tx.Batch)
 }
 
+// TestDiskBufferTruncatePartial makes sure the metrics are correctly masked
+// after only a part of the front of the WAL file could be truncated.
+func TestDiskBufferTruncatePartial(t *testing.T) {
+	// Create a disk buffer
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, DiskBufferOptions{})
+	require.NoError(t, err)
+	defer buf.Close()
+	diskBuf, ok := buf.(*DiskBuffer)
+	require.True(t, ok, "buffer is not a disk buffer")
+
+	// Add some metrics to the buffer
+	expected := make([]telegraf.Metric, 0, 5)
+	for i := range 5 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Now())
+		buf.Add(m)
+		expected = append(expected, m)
+	}
+
+	// Get a batch and acknowledge all metrics except for the third one
+	tx := buf.BeginTransaction(4)
+	testutil.RequireMetricsEqual(t, expected[:4], tx.Batch)
+	tx.Accept = []int{0, 1, 3}
+	buf.EndTransaction(tx)
+
+	// The first two metrics must be removed and the accepted fourth metric
+	// must be masked
+	require.Equal(t, 3, diskBuf.entries())
+	require.Equal(t, []int{1}, diskBuf.mask)
+
+	// The next batch must only contain the kept and the unsent metric
+	tx = buf.BeginTransaction(4)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{expected[2], expected[4]}, tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+	require.Zero(t, diskBuf.entries())
+	require.Empty(t, diskBuf.mask)
+}
+
 // TestDiskBufferEmptyReuse is a regression test for making sure all metrics are
 // output after being added to an fully drained (i.e. empty) buffer. Related to
 // https://github.com/influxdata/telegraf/issues/16981
 func TestDiskBufferEmptyReuse(t *testing.T) {
 	// Create a disk buffer
-	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true)
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, DiskBufferOptions{})
 	require.NoError(t, err)
 	defer buf.Close()
 	diskBuf, ok := buf.(*DiskBuffer)
@@ -126,7 +165,7 @@ func TestDiskBufferEmptyClose(t *testing.T) {
 	tmpdir := t.TempDir()
 
 	// Create a disk buffer
-	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true)
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true, DiskBufferOptions{})
 	require.NoError(t, err)
 	defer buf.Close()
 	diskBuf, ok := buf.(*DiskBuffer)
@@ -154,7 +193,7 @@ func TestDiskBufferEmptyClose(t *testing.T) {
 	require.NoError(t, diskBuf.Close())
 
 	// Reopen the buffer with the parameters above to see the same buffer
-	reopened, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true)
+	reopened, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true, DiskBufferOptions{})
 	require.NoError(t, err)
 	defer reopened.Close()
 	_, ok = reopened.(*DiskBuffer)
@@ -183,7 +222,7 @@ func TestDiskBufferRetainsTrackingInformation(t *testing.T) {
 	var delivered int
 	mm, _ := metric.WithTracking(m, func(telegraf.DeliveryInfo) { delivered++ })
 
-	buf, err := NewBuffer("test", "123", "", 0, "disk_write_through", t.TempDir(), true)
+	buf, err := NewBuffer("test", "123", "", 0, "disk_write_through", t.TempDir(), true, DiskBufferOptions{})
 	require.NoError(t, err)
 	buf.Stats().MetricsAdded.Set(0)
 	buf.Stats().MetricsWritten.Set(0)
@@ -244,7 +283,7 @@ func TestDiskBufferTrackingDroppedFromOldWal(t *testing.T) {
 	walfile.Close()
 
 	// Create a buffer
-	buf, err := NewBuffer("123", "123", "", 0, "disk_write_through", path, true)
+	buf, err := NewBuffer("123", "123", "", 0, "disk_write_through", path, true, DiskBufferOptions{})
 	require.NoError(t, err)
 	buf.Stats().MetricsAdded.Set(0)
 	buf.Stats().MetricsWritten.Set(0)
@@ -299,7 +338,7 @@ func TestDiskBufferTrackingOnOutputOutage(t *testing.T) {
 	}
 
 	// Create a disk buffer
-	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true)
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, DiskBufferOptions{})
 	require.NoError(t, err)
 	defer buf.Close()
 	diskBuf, ok := buf.(*DiskBuffer)
@@ -359,3 +398,495 @@ func TestDiskBufferTrackingOnOutputOutage(t *testing.T) {
 	defer mu.Unlock()
 	require.ElementsMatch(t, created, delivered, "tracking information mismatch")
 }
+
+func TestDiskBufferMaxSizeDropOldest(t *testing.T) {
+	registerGob()
+
+	// Create metrics of equal serialized size
+	inputs := make([]telegraf.Metric, 0, 10)
+	for i := range 10 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Create a disk buffer holding five metrics at most
+	opts := DiskBufferOptions{MaxSize: 5 * size, OverflowPolicy: "drop_oldest"}
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, opts)
+	require.NoError(t, err)
+	defer buf.Close()
+	buf.Stats().MetricsDropped.Set(0)
+
+	// Overfill the buffer and check that the oldest metrics are evicted
+	require.Equal(t, 5, buf.Add(inputs...))
+	require.Equal(t, 5, buf.Len())
+	require.Equal(t, int64(5), buf.Stats().MetricsDropped.Get())
+
+	tx := buf.BeginTransaction(10)
+	testutil.RequireMetricsEqual(t, inputs[5:], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+	require.Zero(t, buf.Len())
+}
+
+func TestDiskBufferMaxSizeDropOldestWithTransaction(t *testing.T) {
+	registerGob()
+
+	// Create metrics of equal serialized size
+	inputs := make([]telegraf.Metric, 0, 10)
+	for i := range 10 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Create a disk buffer holding five metrics at most
+	opts := DiskBufferOptions{MaxSize: 5 * size}
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, opts)
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// Fill the buffer and start a transaction with the first two metrics
+	require.Zero(t, buf.Add(inputs[:5]...))
+	tx := buf.BeginTransaction(2)
+	testutil.RequireMetricsEqual(t, inputs[:2], tx.Batch)
+
+	// Adding more metrics must evict the oldest metrics not being part of the
+	// transaction
+	require.Equal(t, 2, buf.Add(inputs[5:7]...))
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+
+	// The remaining metrics must not contain the evicted ones
+	tx = buf.BeginTransaction(10)
+	expected := append([]telegraf.Metric{inputs[4]}, inputs[5:7]...)
+	testutil.RequireMetricsEqual(t, expected, tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+	require.Zero(t, buf.Len())
+}
+
+func TestDiskBufferMaxSizeDropNewest(t *testing.T) {
+	registerGob()
+
+	// Create metrics of equal serialized size
+	inputs := make([]telegraf.Metric, 0, 10)
+	for i := range 10 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Create a disk buffer holding five metrics at most
+	opts := DiskBufferOptions{MaxSize: 5 * size, OverflowPolicy: "drop_newest"}
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, opts)
+	require.NoError(t, err)
+	defer buf.Close()
+	buf.Stats().MetricsDropped.Set(0)
+
+	// Overfill the buffer and check that the new metrics are dropped
+	require.Equal(t, 5, buf.Add(inputs...))
+	require.Equal(t, 5, buf.Len())
+	require.Equal(t, int64(5), buf.Stats().MetricsDropped.Get())
+
+	tx := buf.BeginTransaction(10)
+	testutil.RequireMetricsEqual(t, inputs[:5], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+	require.Zero(t, buf.Len())
+}
+
+func TestDiskBufferMaxSizeBlockInputs(t *testing.T) {
+	registerGob()
+
+	// Create metrics of equal serialized size
+	inputs := make([]telegraf.Metric, 0, 4)
+	for i := range 4 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Create a disk buffer holding two metrics at most
+	opts := DiskBufferOptions{MaxSize: 2 * size, OverflowPolicy: "block_inputs"}
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, opts)
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// Fill the buffer and make sure adding more metrics blocks
+	require.Zero(t, buf.Add(inputs[:2]...))
+	done := make(chan int)
+	go func() {
+		done <- buf.Add(inputs[2:]...)
+	}()
+	select {
+	case <-done:
+		require.Fail(t, "adding metrics to a full buffer did not block")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Writing the metrics must unblock the input
+	tx := buf.BeginTransaction(2)
+	testutil.RequireMetricsEqual(t, inputs[:2], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+
+	select {
+	case dropped := <-done:
+		require.Zero(t, dropped)
+	case <-time.After(3 * time.Second):
+		require.Fail(t, "adding metrics did not unblock")
+	}
+
+	tx = buf.BeginTransaction(2)
+	testutil.RequireMetricsEqual(t, inputs[2:], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+}
+
+func TestDiskBufferMaxSizeBlockInputsUnblock(t *testing.T) {
+	registerGob()
+
+	// Create metrics of equal serialized size
+	inputs := make([]telegraf.Metric, 0, 4)
+	for i := range 4 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Create a disk buffer holding two metrics at most
+	opts := DiskBufferOptions{MaxSize: 2 * size, OverflowPolicy: "block_inputs"}
+	b, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, opts)
+	require.NoError(t, err)
+	buf := b.(*DiskBuffer)
+	defer buf.Close()
+
+	// Fill the buffer and block adding more metrics
+	require.Zero(t, buf.Add(inputs[:2]...))
+	done := make(chan int)
+	go func() {
+		done <- buf.Add(inputs[2:]...)
+	}()
+	select {
+	case <-done:
+		require.Fail(t, "adding metrics to a full buffer did not block")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Unblocking must drop the new metrics without waiting for the output
+	buf.Unblock()
+	select {
+	case dropped := <-done:
+		require.Equal(t, 2, dropped)
+	case <-time.After(3 * time.Second):
+		require.Fail(t, "adding metrics did not unblock")
+	}
+	require.Equal(t, 2, buf.Add(inputs[2:]...))
+	require.Equal(t, 2, buf.Len())
+
+	// Adding metrics to a closed buffer drops them
+	require.NoError(t, buf.Close())
+	require.Equal(t, 2, buf.Add(inputs[2:]...))
+}
+
+func TestDiskBufferMaxSizeEvictCorrupt(t *testing.T) {
+	registerGob()
+
+	inputs := make([]telegraf.Metric, 0, 2)
+	for i := range 2 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Prefill the WAL file with an entry that cannot be deserialized
+	path := t.TempDir()
+	walfile, err := wal.Open(filepath.Join(path, "id123"), &wal.Options{AllowEmpty: true})
+	require.NoError(t, err)
+	require.NoError(t, walfile.Write(1, []byte("garbage")))
+	require.NoError(t, walfile.Close())
+
+	// Create a disk buffer holding two metrics at most
+	opts := DiskBufferOptions{MaxSize: 2 * size, OverflowPolicy: "drop_oldest"}
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", path, true, opts)
+	require.NoError(t, err)
+	defer buf.Close()
+	buf.Stats().MetricsLost.Set(0)
+
+	// Adding the metrics must evict the corrupt entry
+	require.Equal(t, 1, buf.Add(inputs...))
+	require.Equal(t, int64(1), buf.Stats().MetricsLost.Get())
+	require.Equal(t, 2, buf.Len())
+
+	tx := buf.BeginTransaction(10)
+	testutil.RequireMetricsEqual(t, inputs, tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+	require.Zero(t, buf.Len())
+}
+
+func TestDiskBufferSizeRestoredUnlimited(t *testing.T) {
+	registerGob()
+
+	inputs := make([]telegraf.Metric, 0, 3)
+	for i := range 3 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Create a disk buffer without size limit, fill it and close it again
+	tmpdir := t.TempDir()
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true, DiskBufferOptions{})
+	require.NoError(t, err)
+	require.Zero(t, buf.Add(inputs...))
+	require.NoError(t, buf.Close())
+
+	// Reopen the buffer and make sure the size is accounted for correctly
+	b, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true, DiskBufferOptions{})
+	require.NoError(t, err)
+	reopened := b.(*DiskBuffer)
+	defer reopened.Close()
+	require.Equal(t, 3*size, reopened.size)
+
+	tx := reopened.BeginTransaction(10)
+	tx.AcceptAll()
+	reopened.EndTransaction(tx)
+	require.Zero(t, reopened.size)
+}
+
+func TestDiskBufferMaxSizeRestored(t *testing.T) {
+	registerGob()
+
+	// Create metrics of equal serialized size
+	inputs := make([]telegraf.Metric, 0, 5)
+	for i := range 5 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	data, err := metric.ToBytes(inputs[0])
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	// Create a disk buffer, fill it and close it again
+	tmpdir := t.TempDir()
+	opts := DiskBufferOptions{MaxSize: 4 * size, OverflowPolicy: "drop_newest"}
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true, opts)
+	require.NoError(t, err)
+	require.Zero(t, buf.Add(inputs[:3]...))
+	require.NoError(t, buf.Close())
+
+	// Reopen the buffer and make sure the existing metrics are accounted for
+	reopened, err := NewBuffer("test", "id123", "", 0, "disk_write_through", tmpdir, true, opts)
+	require.NoError(t, err)
+	defer reopened.Close()
+	require.Equal(t, 1, reopened.Add(inputs[3:]...))
+	require.Equal(t, 4, reopened.Len())
+}
+
+func TestDiskBufferInvalidOverflowPolicy(t *testing.T) {
+	opts := DiskBufferOptions{MaxSize: 1024, OverflowPolicy: "foo"}
+	_, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, opts)
+	require.ErrorContains(t, err, "invalid buffer overflow policy")
+}
+
+func TestDiskBufferCorruptionRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		recovery string
+		expected int
+		lost     int64
+	}{
+		{
+			name:     "truncate",
+			recovery: "truncate",
+			expected: 5,
+			lost:     1,
+		},
+		{
+			name:     "quarantine",
+			recovery: "quarantine",
+			lost:     5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registerGob()
+
+			// Prefill the WAL file and corrupt it by appending an incomplete
+			// entry simulating a power loss during write
+			path := t.TempDir()
+			walfile, err := wal.Open(filepath.Join(path, tt.name), &wal.Options{AllowEmpty: true})
+			require.NoError(t, err)
+			inputs := make([]telegraf.Metric, 0, 5)
+			for i := range 5 {
+				m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+				data, err := metric.ToBytes(m)
+				require.NoError(t, err)
+				require.NoError(t, walfile.Write(uint64(i+1), data))
+				inputs = append(inputs, m)
+			}
+			require.NoError(t, walfile.Close())
+			segment := filepath.Join(path, tt.name, "00000000000000000001")
+			f, err := os.OpenFile(segment, os.O_APPEND|os.O_WRONLY, 0o640)
+			require.NoError(t, err)
+			_, err = f.Write([]byte{0x64, 0x01, 0x02})
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			// Check that we fail without recovery
+			_, err = NewBuffer("test", tt.name, "", 0, "disk_write_through", path, true, DiskBufferOptions{})
+			require.ErrorContains(t, err, "wal file is corrupt")
+
+			// Create a buffer with recovery enabled
+			opts := DiskBufferOptions{CorruptionRecovery: tt.recovery}
+			buf, err := NewBuffer("test", tt.name, "", 0, "disk_write_through", path, true, opts)
+			require.NoError(t, err)
+			defer buf.Close()
+			require.Equal(t, int64(1), buf.Stats().BufferRecoveries.Get())
+			require.Equal(t, tt.lost, buf.Stats().MetricsLost.Get())
+			require.Equal(t, tt.expected, buf.Len())
+
+			if tt.expected > 0 {
+				tx := buf.BeginTransaction(10)
+				testutil.RequireMetricsEqual(t, inputs[:tt.expected], tx.Batch)
+				tx.AcceptAll()
+				buf.EndTransaction(tx)
+			}
+
+			// Check the new data can be written
+			require.Zero(t, buf.Add(inputs[0]))
+			tx := buf.BeginTransaction(10)
+			testutil.RequireMetricsEqual(t, inputs[:1], tx.Batch)
+
+			if tt.recovery == "quarantine" {
+				require.DirExists(t, filepath.Join(path, tt.name+".corrupt"))
+			}
+		})
+	}
+}
+
+func TestDiskBufferCompressionEncryption(t *testing.T) {
+	key := func() ([]byte, error) {
+		return []byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"), nil
+	}
+
+	tests := []struct {
+		name        string
+		compression string
+		key         func() ([]byte, error)
+	}{
+		{name: "zstd", compression: "zstd"},
+		{name: "snappy", compression: "snappy"},
+		{name: "gzip", compression: "gzip"},
+		{name: "encrypted", key: key},
+		{name: "zstd encrypted", compression: "zstd", key: key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir()
+			opts := DiskBufferOptions{Compression: tt.compression, EncryptionKey: tt.key}
+
+			// Add some metrics to the buffer
+			buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", path, true, opts)
+			require.NoError(t, err)
+			expected := make([]telegraf.Metric, 0, 5)
+			for i := range 5 {
+				m := metric.New("test", map[string]string{"customer": "secret_customer"}, map[string]interface{}{"value": i}, time.Unix(int64(i), 0))
+				buf.Add(m)
+				expected = append(expected, m)
+			}
+			require.NoError(t, buf.Close())
+
+			// Encrypted data must not contain any plain-text data
+			if tt.key != nil {
+				segments, err := filepath.Glob(filepath.Join(path, "id123", "*"))
+				require.NoError(t, err)
+				for _, fn := range segments {
+					data, err := os.ReadFile(fn)
+					require.NoError(t, err)
+					require.NotContains(t, string(data), "secret_customer")
+				}
+			}
+
+			// Reopen the buffer and check the metrics can be restored
+			buf, err = NewBuffer("test", "id123", "", 0, "disk_write_through", path, true, opts)
+			require.NoError(t, err)
+			defer buf.Close()
+			tx := buf.BeginTransaction(10)
+			testutil.RequireMetricsEqual(t, expected, tx.Batch)
+		})
+	}
+}
+
+func TestDiskBufferCompressionReadsPlainEntries(t *testing.T) {
+	path := t.TempDir()
+
+	// Write metrics without compression
+	buf, err := NewBuffer("test", "id123", "", 0, "disk_write_through", path, true, DiskBufferOptions{})
+	require.NoError(t, err)
+	m := metric.New("test", map[string]string{}, map[string]interface{}{"value": 42}, time.Unix(0, 0))
+	buf.Add(m)
+	require.NoError(t, buf.Close())
+
+	// Enabling compression must keep existing metrics readable
+	buf, err = NewBuffer("test", "id123", "", 0, "disk_write_through", path, true, DiskBufferOptions{Compression: "snappy"})
+	require.NoError(t, err)
+	defer buf.Close()
+	buf.Add(m)
+	tx := buf.BeginTransaction(10)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{m, m}, tx.Batch)
+}
+
+func TestDiskBufferEncryptionWrongKey(t *testing.T) {
+	path := t.TempDir()
+
+	key := func() ([]byte, error) { return []byte("000102030405060708090a0b0c0d0e0f"), nil }
+	buf, err := NewBuffer("test", "wrongkey", "", 0, "disk_write_through", path, true, DiskBufferOptions{EncryptionKey: key})
+	require.NoError(t, err)
+	buf.Add(metric.New("test", map[string]string{}, map[string]interface{}{"value": 42}, time.Unix(0, 0)))
+	require.NoError(t, buf.Close())
+
+	// Metrics encrypted with another key cannot be restored but are kept as
+	// the key might be wrong, e.g. a mistyped secret
+	for _, raw := range []string{"0f0e0d0c0b0a09080706050403020100", "not a key"} {
+		other := func() ([]byte, error) { return []byte(raw), nil }
+		buf, err = NewBuffer("test", "wrongkey", "", 0, "disk_write_through", path, true, DiskBufferOptions{EncryptionKey: other})
+		require.NoError(t, err)
+		tx := buf.BeginTransaction(10)
+		require.Empty(t, tx.Batch)
+		buf.EndTransaction(tx)
+		require.Equal(t, 1, buf.Len())
+		require.Zero(t, buf.Stats().MetricsLost.Get())
+		require.NoError(t, buf.Close())
+	}
+
+	// Metrics are restored with the correct key
+	buf, err = NewBuffer("test", "wrongkey", "", 0, "disk_write_through", path, true, DiskBufferOptions{EncryptionKey: key})
+	require.NoError(t, err)
+	defer buf.Close()
+	tx := buf.BeginTransaction(10)
+	require.Len(t, tx.Batch, 1)
+}
+
+func TestDiskBufferInvalidCompression(t *testing.T) {
+	_, err := NewBuffer("test", "id123", "", 0, "disk_write_through", t.TempDir(), true, DiskBufferOptions{Compression: "lz4"})
+	require.ErrorContains(t, err, "invalid buffer compression")
+}
@@ -19,6 +19,8 @@ type MemoryBuffer struct {
 
 	batchFirst int // index of the first metric in the batch
 	batchSize  int // number of metrics currently in the batch
+
+	closed bool
 }
 
 func NewMemoryBuffer(capacity int, stats BufferStats) (*MemoryBuffer, error) {
@@ -40,6 +42,14 @@ func (b *MemoryBuffer) Add(metrics ...telegraf.Metric) int {
 	b.Lock()
 	defer b.Unlock()
 
+	// Metrics might still be routed to the output while it is being removed
+	if b.closed {
+		for _, m := range metrics {
+			b.metricDropped(m)
+		}
+		return len(metrics)
+	}
+
 	dropped := 0
 	for i := range metrics {
 		if n := b.addMetric(metrics[i]); n != 0 {
@@ -119,7 +129,11 @@ func (b *MemoryBuffer) EndTransaction(tx *Transaction) {
 	b.BufferSize.Set(int64(b.length()))
 }
 
-func (*MemoryBuffer) Close() error {
+func (b *MemoryBuffer) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.closed = true
 	return nil
 }
 
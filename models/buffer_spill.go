@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+)
+
+// SpillBuffer keeps metrics in memory as long as the number of buffered
+// metrics is below the memory capacity and spills all further metrics to disk.
+// Metrics are only added to memory again once the disk part is drained to
+// preserve the metric order.
+type SpillBuffer struct {
+	sync.Mutex
+	BufferStats
+
+	memory *MemoryBuffer
+	disk   *DiskBuffer
+
+	// Buffer used for the currently active transaction
+	active Buffer
+}
+
+func NewSpillBuffer(id, path string, capacity int, stats BufferStats, diskSync bool, diskOpts DiskBufferOptions) (*SpillBuffer, error) {
+	memory, err := NewMemoryBuffer(capacity, stats)
+	if err != nil {
+		return nil, err
+	}
+	disk, err := NewDiskBuffer(id, path, stats, diskSync, diskOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &SpillBuffer{
+		BufferStats: stats,
+		memory:      memory,
+		disk:        disk,
+	}
+	buf.BufferSize.Set(int64(buf.length()))
+	return buf, nil
+}
+
+func (b *SpillBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.length()
+}
+
+func (b *SpillBuffer) Add(metrics ...telegraf.Metric) int {
+	b.Lock()
+	var dropped int
+	var spilled []telegraf.Metric
+	for i, m := range metrics {
+		// Spill all remaining metrics to disk if the memory is full or if
+		// there are metrics on disk already to keep the metric order.
+		if b.disk.Len() > 0 || b.memory.Len() >= b.memory.cap {
+			spilled = metrics[i:]
+			break
+		}
+		dropped += b.memory.Add(m)
+	}
+	b.Unlock()
+
+	// Do not hold the lock while adding to disk as the disk buffer might
+	// block until a transaction frees up space.
+	if len(spilled) > 0 {
+		dropped += b.disk.Add(spilled...)
+	}
+
+	b.BufferSize.Set(int64(b.Len()))
+	return dropped
+}
+
+func (b *SpillBuffer) BeginTransaction(batchSize int) *Transaction {
+	b.Lock()
+	defer b.Unlock()
+
+	// Always drain the memory first as it contains the oldest metrics
+	b.active = b.disk
+	if b.memory.Len() > 0 {
+		b.active = b.memory
+	}
+	return b.active.BeginTransaction(batchSize)
+}
+
+func (b *SpillBuffer) EndTransaction(tx *Transaction) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.active == nil {
+		return
+	}
+	b.active.EndTransaction(tx)
+	b.active = nil
+
+	b.BufferSize.Set(int64(b.length()))
+}
+
+// Unblock makes adding metrics to the full disk part of the buffer drop the
+// new metrics instead of waiting for space, see DiskBuffer.Unblock
+func (b *SpillBuffer) Unblock() {
+	b.disk.Unblock()
+}
+
+func (b *SpillBuffer) Stats() BufferStats {
+	return b.BufferStats
+}
+
+func (b *SpillBuffer) Close() error {
+	return errors.Join(b.memory.Close(), b.disk.Close())
+}
+
+func (b *SpillBuffer) length() int {
+	return b.memory.Len() + b.disk.Len()
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestSpillBufferSpillsToDisk(t *testing.T) {
+	buf, err := NewBuffer("test", "id123", "", 3, "memory_spill", t.TempDir(), true, DiskBufferOptions{})
+	require.NoError(t, err)
+	defer buf.Close()
+	spillBuf, ok := buf.(*SpillBuffer)
+	require.True(t, ok, "buffer is not a spill buffer")
+
+	inputs := make([]telegraf.Metric, 0, 8)
+	for i := range 8 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+
+	// Metrics within the memory capacity must not hit the disk
+	require.Zero(t, buf.Add(inputs[:3]...))
+	require.Equal(t, 3, spillBuf.memory.Len())
+	require.Zero(t, spillBuf.disk.Len())
+
+	// Additional metrics must be spilled to disk instead of being dropped
+	require.Zero(t, buf.Add(inputs[3:6]...))
+	require.Equal(t, 3, spillBuf.memory.Len())
+	require.Equal(t, 3, spillBuf.disk.Len())
+	require.Equal(t, 6, buf.Len())
+
+	// The memory must be drained first
+	tx := buf.BeginTransaction(5)
+	testutil.RequireMetricsEqual(t, inputs[:3], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+
+	// New metrics must go to disk as long as there are metrics on disk to
+	// preserve the order
+	require.Zero(t, buf.Add(inputs[6]))
+	require.Zero(t, spillBuf.memory.Len())
+	require.Equal(t, 4, spillBuf.disk.Len())
+
+	tx = buf.BeginTransaction(5)
+	testutil.RequireMetricsEqual(t, inputs[3:7], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+	require.Zero(t, buf.Len())
+
+	// Once the disk is drained, metrics must be kept in memory again
+	require.Zero(t, buf.Add(inputs[7]))
+	require.Equal(t, 1, spillBuf.memory.Len())
+	require.Zero(t, spillBuf.disk.Len())
+}
+
+func TestSpillBufferKeepInMemory(t *testing.T) {
+	buf, err := NewBuffer("test", "id123", "", 2, "memory_spill", t.TempDir(), true, DiskBufferOptions{})
+	require.NoError(t, err)
+	defer buf.Close()
+
+	inputs := make([]telegraf.Metric, 0, 4)
+	for i := range 4 {
+		m := metric.New("test", map[string]string{}, map[string]interface{}{"value": i}, time.Unix(0, 0))
+		inputs = append(inputs, m)
+	}
+	require.Zero(t, buf.Add(inputs[:2]...))
+
+	// Simulate a failing write with new metrics arriving in the meantime
+	tx := buf.BeginTransaction(2)
+	testutil.RequireMetricsEqual(t, inputs[:2], tx.Batch)
+	require.Zero(t, buf.Add(inputs[2:]...))
+	tx.KeepAll()
+	buf.EndTransaction(tx)
+
+	// No metric must be lost and the order must be kept
+	require.Equal(t, 4, buf.Len())
+	tx = buf.BeginTransaction(4)
+	testutil.RequireMetricsEqual(t, inputs[:2], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+
+	tx = buf.BeginTransaction(4)
+	testutil.RequireMetricsEqual(t, inputs[2:], tx.Batch)
+	tx.AcceptAll()
+	buf.EndTransaction(tx)
+	require.Zero(t, buf.Len())
+}
@@ -24,7 +24,7 @@ func (s *BufferSuiteTest) SetupTest() {
 	switch s.bufferType {
 	case "", "memory":
 		s.hasMaxCapacity = true
-	case "disk_write_through":
+	case "disk_write_through", "memory_spill":
 		path, err := os.MkdirTemp("", "*-buffer-test")
 		s.Require().NoError(err)
 		s.bufferPath = path
@@ -47,9 +47,13 @@ func TestDiskBufferSuite(t *testing.T) {
 	suite.Run(t, &BufferSuiteTest{bufferType: "disk_write_through"})
 }
 
+func TestSpillBufferSuite(t *testing.T) {
+	suite.Run(t, &BufferSuiteTest{bufferType: "memory_spill"})
+}
+
 func (s *BufferSuiteTest) newTestBuffer(capacity int) Buffer {
 	s.T().Helper()
-	buf, err := NewBuffer("test", "123", "", capacity, s.bufferType, s.bufferPath, true)
+	buf, err := NewBuffer("test", "123", "", capacity, s.bufferType, s.bufferPath, true, DiskBufferOptions{})
 	s.Require().NoError(err)
 	buf.Stats().MetricsAdded.Set(0)
 	buf.Stats().MetricsWritten.Set(0)
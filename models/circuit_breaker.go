@@ -0,0 +1,95 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// States of the circuit breaker as exported via selfstat
+const (
+	circuitClosed int64 = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops writing to an output after a number of consecutive
+// failures. After the given timeout a single probe write is allowed and the
+// breaker is closed again if the probe succeeds.
+type circuitBreaker struct {
+	sync.Mutex
+
+	threshold int
+	timeout   time.Duration
+	log       telegraf.Logger
+
+	state    int64
+	failures int
+	openedAt time.Time
+
+	State selfstat.Stat
+	Trips selfstat.Stat
+}
+
+func newCircuitBreaker(threshold int, timeout time.Duration, log telegraf.Logger, tags map[string]string) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		timeout:   timeout,
+		log:       log,
+		State:     selfstat.Register("write", "circuit_breaker_state", tags),
+		Trips:     selfstat.Register("write", "circuit_breaker_trips", tags),
+	}
+}
+
+// allow returns true if a write should be attempted. The returned probe flag
+// is true if the write is a probe in half-open state and should only contain
+// a single metric.
+func (b *circuitBreaker) allow() (ok, probe bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.timeout {
+			return false, false
+		}
+		b.setState(circuitHalfOpen)
+		b.log.Debug("Circuit breaker half-open, probing output")
+		return true, true
+	case circuitHalfOpen:
+		return true, true
+	}
+	return true, false
+}
+
+// record updates the breaker with the result of a write
+func (b *circuitBreaker) record(failed bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	if !failed {
+		if b.state != circuitClosed {
+			b.log.Info("Circuit breaker closed, resuming writes")
+		}
+		b.failures = 0
+		b.setState(circuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		if b.state == circuitClosed {
+			b.log.Warnf("Circuit breaker opened after %d consecutive failures, pausing writes for %s", b.failures, b.timeout)
+			b.Trips.Incr(1)
+		}
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state int64) {
+	b.state = state
+	b.State.Set(state)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"reflect"
 
 	"github.com/influxdata/telegraf"
@@ -59,3 +60,12 @@ func SetStatisticsOnPlugin(plugin interface{}, logger telegraf.Logger, tags map[
 	collector := selfstat.NewCollector(tags)
 	field.Set(reflect.ValueOf(collector))
 }
+
+// migrateState migrates the state of the given plugin from the given version
+func migrateState(plugin telegraf.StatefulPlugin, version int, state []byte) ([]byte, error) {
+	p, ok := plugin.(telegraf.StatefulPluginWithVersion)
+	if !ok {
+		return nil, fmt.Errorf("migrating state from version %d not supported", version)
+	}
+	return p.MigrateState(version, state)
+}
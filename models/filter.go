@@ -129,16 +129,29 @@ func (f *Filter) Compile() error {
 // namepass/namedrop, tagpass/tagdrop and metric filters.
 // The metric is not modified.
 func (f *Filter) Select(metric telegraf.Metric) (bool, error) {
+	ok, _, err := f.selectWithReason(metric)
+	return ok, err
+}
+
+// selectWithReason works like Select but additionally returns the name of the
+// filter option rejecting the metric.
+func (f *Filter) selectWithReason(metric telegraf.Metric) (bool, string, error) {
 	if !f.selectActive {
-		return true, nil
+		return true, "", nil
 	}
 
 	if !f.shouldNamePass(metric.Name()) {
-		return false, nil
+		if f.namePassFilter != nil && !f.namePassFilter.Match(metric.Name()) {
+			return false, "namepass", nil
+		}
+		return false, "namedrop", nil
 	}
 
 	if !f.shouldTagsPass(metric.TagList()) {
-		return false, nil
+		if f.TagPassFilters != nil && !ShouldTagsPass(f.TagPassFilters, nil, metric.TagList()) {
+			return false, "tagpass", nil
+		}
+		return false, "tagdrop", nil
 	}
 
 	if f.metricFilter != nil {
@@ -149,15 +162,15 @@ func (f *Filter) Select(metric telegraf.Metric) (bool, error) {
 			"time":   metric.Time(),
 		})
 		if err != nil {
-			return true, err
+			return true, "", err
 		}
 		if r, ok := result.Value().(bool); ok {
-			return r, nil
+			return r, "metricpass", nil
 		}
-		return true, fmt.Errorf("invalid result type %T", result.Value())
+		return true, "", fmt.Errorf("invalid result type %T", result.Value())
 	}
 
-	return true, nil
+	return true, "", nil
 }
 
 // Modify removes any tags and fields from the metric according to the
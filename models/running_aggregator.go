@@ -1,12 +1,16 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	logging "github.com/influxdata/telegraf/logger"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/persister"
 	"github.com/influxdata/telegraf/selfstat"
 )
 
@@ -16,7 +20,9 @@ type RunningAggregator struct {
 	Config      *AggregatorConfig
 	periodStart time.Time
 	periodEnd   time.Time
+	restored    bool
 	log         telegraf.Logger
+	tracer      *Tracer
 
 	MetricsPushed   selfstat.Stat
 	MetricsFiltered selfstat.Stat
@@ -77,6 +83,7 @@ type AggregatorConfig struct {
 	Source       string
 	Alias        string
 	ID           string
+	Pipeline     string
 	DropOriginal bool
 	Period       time.Duration
 	Delay        time.Duration
@@ -126,6 +133,12 @@ func (r *RunningAggregator) UpdateWindow(start, until time.Time) {
 }
 
 func (r *RunningAggregator) MakeMetric(telegrafMetric telegraf.Metric) telegraf.Metric {
+	trace := r.tracer.start(telegrafMetric, r.LogName(), r.Config.Pipeline)
+	var before telegraf.Metric
+	if trace != nil {
+		before = telegrafMetric.Copy()
+	}
+
 	m := makeMetric(
 		telegrafMetric,
 		r.Config.NameOverride,
@@ -134,6 +147,10 @@ func (r *RunningAggregator) MakeMetric(telegrafMetric telegraf.Metric) telegraf.
 		r.Config.Tags,
 		nil)
 
+	if trace != nil {
+		trace.change(r.LogName(), before, m)
+	}
+
 	r.MetricsPushed.Incr(1)
 
 	return m
@@ -142,12 +159,18 @@ func (r *RunningAggregator) MakeMetric(telegrafMetric telegraf.Metric) telegraf.
 // Add a metric to the aggregator and return true if the original metric
 // should be dropped.
 func (r *RunningAggregator) Add(m telegraf.Metric) bool {
-	ok, err := r.Config.Filter.Select(m)
+	trace := r.tracer.lookup(m)
+
+	ok, reason, err := r.Config.Filter.selectWithReason(m)
 	if err != nil {
 		r.log.Errorf("filtering failed: %v", err)
 	} else if !ok {
+		trace.record(r.LogName(), "filtered", reason, nil)
 		return false
 	}
+	if trace != nil && r.Config.DropOriginal {
+		defer trace.record(r.LogName(), "dropped", "drop_original", nil)
+	}
 
 	// Make a copy of the metric but don't retain tracking.  We do not fail a
 	// delivery due to the aggregation not being sent because we can't create
@@ -157,6 +180,7 @@ func (r *RunningAggregator) Add(m telegraf.Metric) bool {
 
 	r.Config.Filter.Modify(m)
 	if len(m.FieldList()) == 0 {
+		trace.record(r.LogName(), "filtered", "no fields left", nil)
 		r.MetricsFiltered.Incr(1)
 		return r.Config.DropOriginal
 	}
@@ -167,14 +191,22 @@ func (r *RunningAggregator) Add(m telegraf.Metric) bool {
 	if m.Time().Before(r.periodStart.Add(-r.Config.Grace)) || m.Time().After(r.periodEnd.Add(r.Config.Delay)) {
 		r.log.Debugf("Metric is outside aggregation window; discarding. %s: m: %s e: %s g: %s",
 			m.Time(), r.periodStart, r.periodEnd, r.Config.Grace)
+		trace.record(r.LogName(), "filtered", "outside of aggregation window", nil)
 		r.MetricsDropped.Incr(1)
 		return r.Config.DropOriginal
 	}
 
+	trace.record(r.LogName(), "aggregated", "", nil)
 	r.Aggregator.Add(m)
 	return r.Config.DropOriginal
 }
 
+// SetTracer enables recording the actions of the aggregator on sampled
+// metrics and tracing the sampled aggregates.
+func (r *RunningAggregator) SetTracer(t *Tracer) {
+	r.tracer = t
+}
+
 func (r *RunningAggregator) Push(acc telegraf.Accumulator) {
 	r.Lock()
 	defer r.Unlock()
@@ -204,3 +236,104 @@ func (r *RunningAggregator) Push(acc telegraf.Accumulator) {
 func (r *RunningAggregator) Log() telegraf.Logger {
 	return r.log
 }
+
+// aggregatorState is the state persisted for stateful aggregators consisting
+// of the plugin's state and the current aggregation window.
+type aggregatorState struct {
+	PeriodStart time.Time       `json:"period_start"`
+	PeriodEnd   time.Time       `json:"period_end"`
+	State       json.RawMessage `json:"state"`
+}
+
+// IsStateful returns true if the underlying aggregator can persist its state
+func (r *RunningAggregator) IsStateful() bool {
+	_, ok := r.Aggregator.(telegraf.StatefulPlugin)
+	return ok
+}
+
+func (r *RunningAggregator) GetState() interface{} {
+	plugin, ok := r.Aggregator.(telegraf.StatefulPlugin)
+	if !ok {
+		return aggregatorState{}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	state, err := json.Marshal(plugin.GetState())
+	if err != nil {
+		r.log.Errorf("Marshalling state failed: %v", err)
+		return aggregatorState{}
+	}
+
+	return aggregatorState{
+		PeriodStart: r.periodStart,
+		PeriodEnd:   r.periodEnd,
+		State:       state,
+	}
+}
+
+func (r *RunningAggregator) SetState(state interface{}) error {
+	plugin, ok := r.Aggregator.(telegraf.StatefulPlugin)
+	if !ok {
+		return nil
+	}
+
+	s, ok := state.(aggregatorState)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+	if len(s.State) == 0 {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	// Use the plugin's current state as blueprint for unmarshalling the
+	// persisted state in the same way the persister does.
+	nstate := reflect.New(reflect.TypeOf(plugin.GetState()))
+	if err := json.Unmarshal(s.State, nstate.Interface()); err != nil {
+		return fmt.Errorf("unmarshalling plugin state failed: %w", err)
+	}
+	if err := plugin.SetState(nstate.Elem().Interface()); err != nil {
+		return err
+	}
+
+	if !s.PeriodEnd.IsZero() {
+		r.periodStart = s.PeriodStart
+		r.periodEnd = s.PeriodEnd
+		r.restored = true
+	}
+	return nil
+}
+
+func (r *RunningAggregator) StateVersion() int {
+	plugin, _ := r.Aggregator.(telegraf.StatefulPlugin)
+	return persister.StateVersion(plugin)
+}
+
+// MigrateState migrates the plugin's part of the persisted state
+func (r *RunningAggregator) MigrateState(version int, state []byte) ([]byte, error) {
+	plugin, _ := r.Aggregator.(telegraf.StatefulPlugin)
+
+	var s aggregatorState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, err
+	}
+	migrated, err := migrateState(plugin, version, s.State)
+	if err != nil {
+		return nil, err
+	}
+	s.State = migrated
+	return json.Marshal(s)
+}
+
+// RestoredWindow returns the aggregation window restored from the persisted
+// state, if any.
+func (r *RunningAggregator) RestoredWindow() (since, until time.Time, ok bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.periodStart, r.periodEnd, r.restored
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -240,6 +242,63 @@ func TestRunningAggregatorAddDoesNotModifyMetric(t *testing.T) {
 	testutil.RequireMetricEqual(t, expected, m)
 }
 
+func TestRunningAggregatorState(t *testing.T) {
+	cfg := &AggregatorConfig{
+		Name:   "TestRunningAggregator",
+		Period: time.Minute,
+	}
+	ra := NewRunningAggregator(&mockStatefulAggregator{}, cfg)
+	require.True(t, ra.IsStateful())
+	require.NoError(t, ra.Config.Filter.Compile())
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ra.UpdateWindow(start, start.Add(cfg.Period))
+	ra.Add(metric.New("RITest", map[string]string{}, map[string]interface{}{"value": int64(42)}, start.Add(time.Second)))
+
+	// Serialize the state and restore it in a new instance
+	serialized, err := json.Marshal(ra.GetState())
+	require.NoError(t, err)
+	var state aggregatorState
+	require.NoError(t, json.Unmarshal(serialized, &state))
+
+	restored := NewRunningAggregator(&mockStatefulAggregator{}, cfg)
+	_, _, ok := restored.RestoredWindow()
+	require.False(t, ok)
+	require.NoError(t, restored.SetState(state))
+
+	since, until, ok := restored.RestoredWindow()
+	require.True(t, ok)
+	require.Equal(t, start, since.UTC())
+	require.Equal(t, start.Add(cfg.Period), until.UTC())
+
+	acc := testutil.Accumulator{}
+	restored.Push(&acc)
+	require.Len(t, acc.Metrics, 1)
+	require.Equal(t, int64(42), acc.Metrics[0].Fields["sum"])
+}
+
+func TestRunningAggregatorStateless(t *testing.T) {
+	ra := NewRunningAggregator(&mockAggregator{}, &AggregatorConfig{Name: "TestRunningAggregator"})
+	require.False(t, ra.IsStateful())
+}
+
+type mockStatefulAggregator struct {
+	mockAggregator
+}
+
+func (t *mockStatefulAggregator) GetState() interface{} {
+	return t.sum
+}
+
+func (t *mockStatefulAggregator) SetState(state interface{}) error {
+	sum, ok := state.(int64)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+	t.sum = sum
+	return nil
+}
+
 type mockAggregator struct {
 	sum int64
 }
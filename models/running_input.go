@@ -26,6 +26,7 @@ type RunningInput struct {
 
 	startAcc    telegraf.Accumulator
 	started     bool
+	tracer      *Tracer
 	retries     uint64
 	gatherStart time.Time
 	gatherEnd   time.Time
@@ -95,6 +96,7 @@ type InputConfig struct {
 	Source               string
 	Alias                string
 	ID                   string
+	Pipeline             string
 	Interval             time.Duration
 	CollectionJitter     time.Duration
 	CollectionJitterSet  bool
@@ -203,10 +205,18 @@ func (r *RunningInput) ID() string {
 }
 
 func (r *RunningInput) MakeMetric(metric telegraf.Metric) telegraf.Metric {
-	ok, err := r.Config.Filter.Select(metric)
+	trace := r.tracer.start(metric, r.LogName(), r.Config.Pipeline)
+	var before telegraf.Metric
+	if trace != nil {
+		before = metric.Copy()
+	}
+
+	ok, reason, err := r.Config.Filter.selectWithReason(metric)
 	if err != nil {
 		r.log.Errorf("filtering failed: %v", err)
 	} else if !ok {
+		trace.record(r.LogName(), "filtered", reason, nil)
+		r.tracer.End(metric)
 		r.metricFiltered(metric)
 		return nil
 	}
@@ -221,6 +231,8 @@ func (r *RunningInput) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 
 	r.Config.Filter.Modify(metric)
 	if len(metric.FieldList()) == 0 {
+		trace.record(r.LogName(), "dropped", "no fields left", nil)
+		r.tracer.End(metric)
 		r.metricFiltered(metric)
 		return nil
 	}
@@ -244,11 +256,21 @@ func (r *RunningInput) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 	default:
 	}
 
+	if trace != nil {
+		trace.change(r.LogName(), before, metric)
+	}
+
 	r.MetricsGathered.Incr(1)
 	GlobalMetricsGathered.Incr(1)
 	return metric
 }
 
+// SetTracer enables recording the journey of sampled metrics created by the
+// input.
+func (r *RunningInput) SetTracer(t *Tracer) {
+	r.tracer = t
+}
+
 func (r *RunningInput) Gather(acc telegraf.Accumulator) error {
 	// Try to connect if we are not yet started up
 	if plugin, ok := r.Input.(telegraf.ServiceInput); ok && !r.started {
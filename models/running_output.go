@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,12 +16,22 @@ import (
 
 var GlobalWriteErrors = selfstat.Register("agent", "write_errors", make(map[string]string))
 
+// ErrBackoff is returned if writing is skipped as the output backs off after
+// failed writes, either due to the retry policy or an open circuit breaker.
+var ErrBackoff = errors.New("backing off after failed writes")
+
 const (
 	// Default size of metrics batch size.
 	DefaultMetricBatchSize = 1000
 
 	// Default number of metrics kept. It should be a multiple of batch size.
 	DefaultMetricBufferLimit = 10000
+
+	// Default time to pause writes after the circuit breaker opened.
+	DefaultCircuitBreakerTimeout = 30 * time.Second
+
+	// Default maximum time to wait before retrying a failed write.
+	DefaultRetryMaxBackoff = time.Hour
 )
 
 // OutputConfig containing name and filter
@@ -29,6 +40,7 @@ type OutputConfig struct {
 	Source               string
 	Alias                string
 	ID                   string
+	Pipeline             string
 	StartupErrorBehavior string
 	Filter               Filter
 
@@ -41,9 +53,31 @@ type OutputConfig struct {
 	NamePrefix   string
 	NameSuffix   string
 
-	BufferStrategy  string
-	BufferDirectory string
-	BufferDiskSync  bool
+	BufferStrategy               string
+	BufferDirectory              string
+	BufferDiskSync               bool
+	BufferDiskMaxSize            int64
+	BufferDiskOverflowPolicy     string
+	BufferDiskCorruptionRecovery string
+	BufferDiskCompression        string
+	BufferDiskEncryptionKey      func() ([]byte, error)
+
+	Priority          int
+	MaxBytesPerSecond int64
+
+	// Retry policy for failed writes
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+	RetryJitter         time.Duration
+	RetryMaxAttempts    int
+
+	// Circuit breaker pausing writes after consecutive failures
+	CircuitBreakerThreshold int
+	CircuitBreakerTimeout   time.Duration
+
+	// Output to route rejected metrics to, referenced by alias or by plugin
+	// name
+	DeadLetterOutput string
 
 	LogLevel string
 }
@@ -54,6 +88,11 @@ type RunningOutput struct {
 	droppedMetrics  atomic.Int64
 	writeInFlight   atomic.Bool
 	lastWriteFailed atomic.Bool
+	paused          atomic.Bool
+	// Set for the final write on shutdown ignoring any backoff
+	final atomic.Bool
+	// Set once the output is closed or discarded
+	released atomic.Bool
 
 	Output            telegraf.Output
 	Config            *OutputConfig
@@ -70,9 +109,31 @@ type RunningOutput struct {
 	buffer Buffer
 	log    telegraf.Logger
 
+	// Limiters for the bandwidth of this output and the shared bandwidth of
+	// all outputs, both are optional
+	limiter *BandwidthLimiter
+	budget  *BandwidthLimiter
+
+	// Output receiving the rejected metrics and flag if this output is used
+	// as dead-letter output for other outputs
+	deadLetter     *RunningOutput
+	deadLetterOnly bool
+
+	// Number of failed attempts to write the current batch and the earliest
+	// time for the next attempt according to the retry policy
+	writeAttempts int
+	nextAttempt   time.Time
+
+	breaker *circuitBreaker
+	tracer  *Tracer
+
 	started bool
 	retries uint64
 
+	// Error of the last failed write for reporting the status of the output
+	lastError   error
+	lastErrorMu sync.Mutex
+
 	aggMutex sync.Mutex
 }
 
@@ -109,7 +170,14 @@ func NewRunningOutput(output telegraf.Output, config *OutputConfig, batchSize, b
 		batchSize = DefaultMetricBatchSize
 	}
 
-	b, err := NewBuffer(config.Name, config.ID, config.Alias, bufferLimit, config.BufferStrategy, config.BufferDirectory, config.BufferDiskSync)
+	diskOpts := DiskBufferOptions{
+		MaxSize:            config.BufferDiskMaxSize,
+		OverflowPolicy:     config.BufferDiskOverflowPolicy,
+		CorruptionRecovery: config.BufferDiskCorruptionRecovery,
+		Compression:        config.BufferDiskCompression,
+		EncryptionKey:      config.BufferDiskEncryptionKey,
+	}
+	b, err := NewBuffer(config.Name, config.ID, config.Alias, bufferLimit, config.BufferStrategy, config.BufferDirectory, config.BufferDiskSync, diskOpts)
 	if err != nil {
 		return nil, fmt.Errorf("creating buffer failed: %w", err)
 	}
@@ -143,6 +211,16 @@ func NewRunningOutput(output telegraf.Output, config *OutputConfig, batchSize, b
 		),
 		log: logger,
 	}
+	if config.MaxBytesPerSecond > 0 {
+		ro.limiter = NewBandwidthLimiter(config.MaxBytesPerSecond)
+	}
+	if config.CircuitBreakerThreshold > 0 {
+		timeout := config.CircuitBreakerTimeout
+		if timeout <= 0 {
+			timeout = DefaultCircuitBreakerTimeout
+		}
+		ro.breaker = newCircuitBreaker(config.CircuitBreakerThreshold, timeout, logger, tags)
+	}
 
 	return ro, nil
 }
@@ -209,8 +287,12 @@ func (r *RunningOutput) Connect() error {
 	return err
 }
 
-// Close closes the output
+// Close closes the output. Closing an output already closed or discarded does
+// nothing.
 func (r *RunningOutput) Close() {
+	if r.released.Swap(true) {
+		return
+	}
 	if err := r.Output.Close(); err != nil {
 		r.log.Errorf("Error closing output: %v", err)
 	}
@@ -220,6 +302,27 @@ func (r *RunningOutput) Close() {
 	}
 }
 
+// Discard releases the resources of an output that was never connected, e.g.
+// when the configuration it was loaded from is not used. Discarding an output
+// already closed or discarded does nothing.
+func (r *RunningOutput) Discard() {
+	if r.released.Swap(true) {
+		return
+	}
+	if err := r.buffer.Close(); err != nil {
+		r.log.Errorf("Error closing output buffer: %v", err)
+	}
+}
+
+// Unblock stops adding metrics from blocking if the buffer is full, e.g. on
+// shutdown when the output might not be able to free up space anymore. New
+// metrics are dropped instead.
+func (r *RunningOutput) Unblock() {
+	if b, ok := r.buffer.(interface{ Unblock() }); ok {
+		b.Unblock()
+	}
+}
+
 // AddMetric adds a metric to the output.
 // The given metric will be copied if the output selects the metric.
 func (r *RunningOutput) AddMetric(metric telegraf.Metric) {
@@ -279,12 +382,59 @@ func (r *RunningOutput) add(metric telegraf.Metric) {
 	r.triggerBatchCheck()
 }
 
+// SetTracer enables recording the actions of the output on sampled metrics
+// using TraceMetric.
+func (r *RunningOutput) SetTracer(t *Tracer) {
+	r.tracer = t
+}
+
+// TraceMetric records what the output would do with the given metric without
+// adding the metric to the buffer. Metrics of other pipelines are ignored.
+// The given metric is not modified.
+func (r *RunningOutput) TraceMetric(metric telegraf.Metric) {
+	trace := r.tracer.lookup(metric)
+	if trace == nil || trace.Pipeline != r.Config.Pipeline {
+		return
+	}
+
+	ok, reason, err := r.Config.Filter.selectWithReason(metric)
+	if err != nil {
+		r.log.Errorf("filtering failed: %v", err)
+	} else if !ok {
+		trace.record(r.LogName(), "filtered", reason, nil)
+		return
+	}
+
+	m := metric.Copy()
+	r.Config.Filter.Modify(m)
+	if len(m.FieldList()) == 0 {
+		trace.record(r.LogName(), "dropped", "no fields left", nil)
+		return
+	}
+
+	if _, ok := r.Output.(telegraf.AggregatingOutput); ok {
+		trace.record(r.LogName(), "aggregated", "", diffMetrics(metric, m))
+		return
+	}
+
+	if len(r.Config.NameOverride) > 0 {
+		m.SetName(r.Config.NameOverride)
+	}
+	if len(r.Config.NamePrefix) > 0 {
+		m.AddPrefix(r.Config.NamePrefix)
+	}
+	if len(r.Config.NameSuffix) > 0 {
+		m.AddSuffix(r.Config.NameSuffix)
+	}
+	trace.record(r.LogName(), "written", "", diffMetrics(metric, m))
+}
+
 func (r *RunningOutput) triggerBatchCheck() {
 	// Make sure we trigger another batch-ready event in case we do have more
 	// metrics than the batch-size in the buffer. We guard this trigger to not
 	// be issued if a write is already ongoing to avoid event storms when adding
 	// new metrics during write.
-	if r.buffer.Len() >= r.MetricBatchSize && !r.lastWriteFailed.Load() {
+	if r.buffer.Len() >= r.MetricBatchSize && !r.lastWriteFailed.Load() && !r.paused.Load() {
 		// Please note: We cannot merge this if into the one above because then
 		// the compare-and-swap condition would always be evaluated and the
 		// swap happens unconditionally from the buffer fullness.
@@ -345,6 +495,25 @@ func (r *RunningOutput) Write() error {
 	return nil
 }
 
+// WriteFinal writes all metrics to the output like Write but ignores the
+// backoff of previously failed writes as this is the last chance to write the
+// metrics before shutting down.
+// Paused outputs stay paused, so the metrics not persisted on disk are lost.
+func (r *RunningOutput) WriteFinal() error {
+	r.final.Store(true)
+	if r.paused.Load() {
+		if n := r.buffer.Len(); n > 0 {
+			if r.Config.BufferStrategy == "disk_write_through" {
+				r.log.Warnf("Output paused on shutdown, keeping %d metrics in the disk buffer", n)
+			} else {
+				r.log.Warnf("Output paused on shutdown, metrics buffered in memory are lost (buffer fullness: %d metrics)", n)
+			}
+		}
+		return nil
+	}
+	return r.Write()
+}
+
 // WriteBatch writes a single batch of metrics to the output.
 func (r *RunningOutput) WriteBatch() error {
 	// Try to connect if we are not yet started up
@@ -370,20 +539,60 @@ func (r *RunningOutput) WriteBatch() error {
 }
 
 func (r *RunningOutput) doTransaction() error {
-	tx := r.buffer.BeginTransaction(r.MetricBatchSize)
+	// Keep the metrics in the buffer while the output is paused
+	if r.paused.Load() {
+		return nil
+	}
+
+	// Wait for the backoff of a previously failed write to expire
+	final := r.final.Load()
+	if wait := time.Until(r.nextAttempt); wait > 0 && !final {
+		return fmt.Errorf("%w, retrying write in %s", ErrBackoff, wait.Round(time.Millisecond))
+	}
+
+	// Skip writing while the circuit breaker is open and only write a single
+	// metric to probe the output in half-open state
+	batchSize := r.MetricBatchSize
+	var probe bool
+	if r.breaker != nil && !final {
+		var ok bool
+		ok, probe = r.breaker.allow()
+		if !ok {
+			return fmt.Errorf("%w, circuit breaker is open", ErrBackoff)
+		}
+		if probe {
+			batchSize = 1
+		}
+	}
+
+	tx := r.buffer.BeginTransaction(batchSize)
 	if len(tx.Batch) == 0 {
 		return nil
 	}
 	err := r.writeMetrics(tx.Batch)
 	r.updateTransaction(tx, err)
+	if r.breaker != nil {
+		// Any error counts as failure including permanent errors and partial
+		// writes as the output is not healthy if it keeps rejecting metrics
+		r.breaker.record(err != nil)
+	}
+	r.forwardRejected(tx, err)
 	r.buffer.EndTransaction(tx)
 
 	if err != nil {
 		r.WriteErrors.Incr(1)
 		GlobalWriteErrors.Incr(1)
+		r.lastErrorMu.Lock()
+		r.lastError = err
+		r.lastErrorMu.Unlock()
 		return err
 	}
 
+	// Continue with a full batch after a successful probe
+	if probe {
+		return r.doTransaction()
+	}
+
 	return nil
 }
 
@@ -393,6 +602,8 @@ func (r *RunningOutput) writeMetrics(metrics []telegraf.Metric) error {
 		r.droppedMetrics.Add(-dropped)
 	}
 
+	r.throttle(metrics)
+
 	start := time.Now()
 	err := r.Output.Write(metrics)
 	elapsed := time.Since(start)
@@ -408,16 +619,31 @@ func (r *RunningOutput) updateTransaction(tx *Transaction, err error) {
 	// No error indicates all metrics were written successfully
 	if err == nil {
 		r.lastWriteFailed.Store(false)
+		r.resetRetry()
 		tx.AcceptAll()
 		return
 	}
 
+	// A permanent error indicates none of the metrics can ever be written so
+	// remove them from the buffer instead of retrying
+	var permanentErr *internal.PermanentError
+	if errors.As(err, &permanentErr) {
+		r.lastWriteFailed.Store(false)
+		r.resetRetry()
+		tx.RejectAll()
+		return
+	}
+
 	// A non-partial-write-error indicated none of the metrics were written
 	// successfully and we should keep them for the next write cycle
 	var writeErr *internal.PartialWriteError
 	if !errors.As(err, &writeErr) {
 		r.lastWriteFailed.Store(true)
-		tx.KeepAll()
+		if r.retry(err) {
+			tx.KeepAll()
+		} else {
+			tx.RejectAll()
+		}
 		return
 	}
 
@@ -429,9 +655,125 @@ func (r *RunningOutput) updateTransaction(tx *Transaction, err error) {
 	tx.Reject = writeErr.MetricsReject
 }
 
+// retry schedules the next write attempt according to the retry policy after
+// a failed write. It returns false if the maximum number of attempts is
+// exceeded and the batch should be dropped.
+func (r *RunningOutput) retry(err error) bool {
+	r.writeAttempts++
+	if r.Config.RetryMaxAttempts > 0 && r.writeAttempts >= r.Config.RetryMaxAttempts {
+		r.log.Errorf("Dropping batch after %d failed attempts: %v", r.writeAttempts, err)
+		r.resetRetry()
+		return false
+	}
+
+	// Double the backoff for each failed attempt up to the maximum
+	var backoff time.Duration
+	if r.Config.RetryInitialBackoff > 0 {
+		maxBackoff := r.Config.RetryMaxBackoff
+		if maxBackoff <= 0 {
+			maxBackoff = DefaultRetryMaxBackoff
+		}
+		backoff = min(r.Config.RetryInitialBackoff, maxBackoff)
+		for i := 1; i < r.writeAttempts && backoff < maxBackoff; i++ {
+			backoff = min(2*backoff, maxBackoff)
+		}
+		if r.Config.RetryJitter > 0 {
+			backoff += time.Duration(rand.Int64N(int64(r.Config.RetryJitter)))
+		}
+	}
+
+	// Respect the retry time requested by the service even without a backoff
+	// configured
+	var retryErr *internal.RetryableError
+	if errors.As(err, &retryErr) && retryErr.RetryAfter > backoff {
+		backoff = retryErr.RetryAfter
+	}
+	if backoff > 0 {
+		r.nextAttempt = time.Now().Add(backoff)
+	}
+
+	return true
+}
+
+func (r *RunningOutput) resetRetry() {
+	r.writeAttempts = 0
+	r.nextAttempt = time.Time{}
+}
+
+// SetDeadLetterOutput sets the output receiving the metrics rejected by this
+// output. The dead-letter output will not receive any other metrics.
+func (r *RunningOutput) SetDeadLetterOutput(output *RunningOutput) {
+	r.deadLetter = output
+	output.deadLetterOnly = true
+}
+
+// IsDeadLetterOutput returns true if the output only receives the metrics
+// rejected by other outputs.
+func (r *RunningOutput) IsDeadLetterOutput() bool {
+	return r.deadLetterOnly
+}
+
+// forwardRejected sends the rejected metrics of the transaction to the
+// dead-letter output, if any, tagging them with the rejection reason.
+func (r *RunningOutput) forwardRejected(tx *Transaction, err error) {
+	if r.deadLetter == nil || len(tx.Reject) == 0 {
+		return
+	}
+
+	// Use the individual errors of partial writes if available and fall back
+	// to the overall error otherwise
+	var writeErr *internal.PartialWriteError
+	partial := errors.As(err, &writeErr)
+
+	for i, idx := range tx.Reject {
+		reason := err
+		if partial {
+			reason = writeErr.Err
+			if i < len(writeErr.MetricsRejectErrors) && writeErr.MetricsRejectErrors[i] != nil {
+				reason = writeErr.MetricsRejectErrors[i]
+			}
+		}
+
+		// Do not forward tracking information as the metric is finished for
+		// the original output
+		m := tx.Batch[idx]
+		if tm, ok := m.(telegraf.TrackingMetric); ok {
+			m = tm.Unwrap()
+		}
+		m = m.Copy()
+		if reason != nil {
+			m.AddTag("dead_letter_error", reason.Error())
+		}
+		m.AddTag("dead_letter_source", r.LogName())
+		r.deadLetter.AddMetricNoCopy(m)
+	}
+}
+
+// SetBandwidthBudget sets the limiter for the bandwidth shared by all outputs.
+func (r *RunningOutput) SetBandwidthBudget(budget *BandwidthLimiter) {
+	r.budget = budget
+}
+
+// throttle waits until the bandwidth for writing the given metrics is
+// available. The bandwidth of the output itself is acquired first to avoid
+// blocking the shared budget while waiting.
+func (r *RunningOutput) throttle(metrics []telegraf.Metric) {
+	if r.limiter == nil && r.budget == nil {
+		return
+	}
+
+	size := estimateSize(metrics)
+	if r.limiter != nil {
+		r.limiter.Acquire(0, size)
+	}
+	if r.budget != nil {
+		r.budget.Acquire(r.Config.Priority, size)
+	}
+}
+
 func (r *RunningOutput) LogBufferStatus() {
 	nBuffer := r.buffer.Len()
-	if r.Config.BufferStrategy == "disk_write_through" {
+	if r.Config.BufferStrategy == "disk_write_through" || r.Config.BufferStrategy == "memory_spill" {
 		r.log.Debugf("Buffer fullness: %d metrics", nBuffer)
 	} else {
 		r.log.Debugf("Buffer fullness: %d / %d metrics", nBuffer, r.MetricBufferLimit)
@@ -442,6 +784,35 @@ func (r *RunningOutput) Log() telegraf.Logger {
 	return r.log
 }
 
+// Pause stops writing to the output. Metrics are kept in the buffer until the
+// output is resumed.
+func (r *RunningOutput) Pause() {
+	if !r.paused.Swap(true) {
+		r.log.Info("Output paused")
+	}
+}
+
+// Resume continues writing to a paused output.
+func (r *RunningOutput) Resume() {
+	if r.paused.Swap(false) {
+		r.log.Info("Output resumed")
+		r.triggerBatchCheck()
+	}
+}
+
+// Paused returns true if the output is paused.
+func (r *RunningOutput) Paused() bool {
+	return r.paused.Load()
+}
+
+// LastError returns the error of the last failed write or nil if all writes
+// succeeded so far.
+func (r *RunningOutput) LastError() error {
+	r.lastErrorMu.Lock()
+	defer r.lastErrorMu.Unlock()
+	return r.lastError
+}
+
 func (r *RunningOutput) BufferLength() int {
 	return r.buffer.Len()
 }
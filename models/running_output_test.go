@@ -633,6 +633,326 @@ func TestRunningOutputNoRetriggerOnError(t *testing.T) {
 	require.Equal(t, totalMetrics, ro.buffer.Len())
 }
 
+func TestRunningOutputDeadLetter(t *testing.T) {
+	plugin := &mockOutput{
+		preWriteHook: func([]telegraf.Metric) error {
+			return &internal.PartialWriteError{
+				Err:                 internal.ErrSerialization,
+				MetricsAccept:       []int{0},
+				MetricsReject:       []int{1, 2},
+				MetricsRejectErrors: []error{errors.New("invalid field"), nil},
+			}
+		},
+	}
+	ro, err := NewRunningOutput(plugin, &OutputConfig{Name: "test", Filter: Filter{}}, 10, 100)
+	require.NoError(t, err)
+
+	deadLetterPlugin := &mockOutput{}
+	deadLetter, err := NewRunningOutput(deadLetterPlugin, &OutputConfig{Name: "file", Filter: Filter{}}, 10, 100)
+	require.NoError(t, err)
+	ro.SetDeadLetterOutput(deadLetter)
+	require.True(t, deadLetter.IsDeadLetterOutput())
+	require.False(t, ro.IsDeadLetterOutput())
+
+	for i := range 3 {
+		ro.AddMetric(testutil.TestMetric(i, "test"))
+	}
+	require.ErrorIs(t, ro.Write(), internal.ErrSerialization)
+	require.Zero(t, ro.BufferLength())
+	require.Equal(t, 2, deadLetter.BufferLength())
+
+	// The rejected metrics must be tagged with the reason
+	require.NoError(t, deadLetter.Write())
+	expected := []telegraf.Metric{
+		testutil.TestMetric(1, "test"),
+		testutil.TestMetric(2, "test"),
+	}
+	expected[0].AddTag("dead_letter_error", "invalid field")
+	expected[1].AddTag("dead_letter_error", internal.ErrSerialization.Error())
+	for _, m := range expected {
+		m.AddTag("dead_letter_source", "outputs.test")
+	}
+	testutil.RequireMetricsEqual(t, expected, deadLetterPlugin.Metrics())
+}
+
+func TestRunningOutputPermanentError(t *testing.T) {
+	plugin := &mockOutput{
+		preWriteHook: func([]telegraf.Metric) error {
+			return &internal.PermanentError{Err: errors.New("malformed")}
+		},
+	}
+	ro, err := NewRunningOutput(plugin, &OutputConfig{Name: "permanent_error", Filter: Filter{}}, 10, 100)
+	require.NoError(t, err)
+
+	for i := range 5 {
+		ro.AddMetric(testutil.TestMetric(i, "test"))
+	}
+	require.ErrorContains(t, ro.Write(), "malformed")
+
+	// The metrics must be dropped instead of being kept for retrying
+	require.Zero(t, ro.BufferLength())
+	require.Equal(t, int64(5), ro.buffer.Stats().MetricsRejected.Get())
+}
+
+func TestRunningOutputRetryBackoff(t *testing.T) {
+	plugin := &mockOutput{batchAcceptSize: -1}
+	conf := &OutputConfig{
+		Filter:              Filter{},
+		RetryInitialBackoff: time.Hour,
+	}
+	ro, err := NewRunningOutput(plugin, conf, 10, 100)
+	require.NoError(t, err)
+
+	ro.AddMetric(testutil.TestMetric(1, "test"))
+	require.Error(t, ro.Write())
+	require.Equal(t, uint32(1), plugin.writes.Load())
+
+	// The output must not be called again until the backoff expired
+	plugin.batchAcceptSize = 0
+	require.ErrorIs(t, ro.Write(), ErrBackoff)
+	require.Equal(t, uint32(1), plugin.writes.Load())
+	require.Equal(t, 1, ro.BufferLength())
+
+	// Retry after the backoff expired
+	ro.nextAttempt = time.Now()
+	require.NoError(t, ro.Write())
+	require.Equal(t, uint32(2), plugin.writes.Load())
+	require.Zero(t, ro.BufferLength())
+}
+
+func TestRunningOutputRetryBackoffIncrease(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:              Filter{},
+		RetryInitialBackoff: time.Second,
+		RetryMaxBackoff:     5 * time.Second,
+	}
+	ro, err := NewRunningOutput(&mockOutput{}, conf, 10, 100)
+	require.NoError(t, err)
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for _, backoff := range expected {
+		require.True(t, ro.retry(errors.New("failed")))
+		require.WithinDuration(t, time.Now().Add(backoff), ro.nextAttempt, 100*time.Millisecond)
+	}
+
+	// A retry time requested by the service takes precedence
+	require.True(t, ro.retry(&internal.RetryableError{Err: errors.New("throttled"), RetryAfter: time.Minute}))
+	require.WithinDuration(t, time.Now().Add(time.Minute), ro.nextAttempt, 100*time.Millisecond)
+}
+
+func TestRunningOutputRetryBackoffDefaultMaximum(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:              Filter{},
+		RetryInitialBackoff: time.Second,
+	}
+	ro, err := NewRunningOutput(&mockOutput{}, conf, 10, 100)
+	require.NoError(t, err)
+
+	// The backoff must neither overflow nor exceed the default maximum
+	for range 100 {
+		require.True(t, ro.retry(errors.New("failed")))
+	}
+	require.WithinDuration(t, time.Now().Add(DefaultRetryMaxBackoff), ro.nextAttempt, 100*time.Millisecond)
+}
+
+func TestRunningOutputWriteFinalIgnoresBackoff(t *testing.T) {
+	plugin := &mockOutput{batchAcceptSize: -1}
+	conf := &OutputConfig{
+		Filter:                  Filter{},
+		RetryInitialBackoff:     time.Hour,
+		CircuitBreakerThreshold: 1,
+	}
+	ro, err := NewRunningOutput(plugin, conf, 10, 100)
+	require.NoError(t, err)
+
+	ro.AddMetric(testutil.TestMetric(1, "test"))
+	require.Error(t, ro.Write())
+	plugin.batchAcceptSize = 0
+	require.ErrorIs(t, ro.Write(), ErrBackoff)
+
+	// The final write on shutdown must try to write the metrics
+	require.NoError(t, ro.WriteFinal())
+	require.Equal(t, uint32(2), plugin.writes.Load())
+	require.Zero(t, ro.BufferLength())
+}
+
+func TestRunningOutputRetryAfterWithoutBackoff(t *testing.T) {
+	ro, err := NewRunningOutput(&mockOutput{}, &OutputConfig{Filter: Filter{}}, 10, 100)
+	require.NoError(t, err)
+
+	// Without a backoff configured the write is retried immediately
+	require.True(t, ro.retry(errors.New("failed")))
+	require.True(t, ro.nextAttempt.IsZero())
+
+	// A retry time requested by the service must be respected nevertheless
+	require.True(t, ro.retry(&internal.RetryableError{Err: errors.New("throttled"), RetryAfter: time.Minute}))
+	require.WithinDuration(t, time.Now().Add(time.Minute), ro.nextAttempt, 100*time.Millisecond)
+	ro.AddMetric(testutil.TestMetric(1, "test"))
+	require.ErrorIs(t, ro.Write(), ErrBackoff)
+}
+
+func TestRunningOutputRetryMaxAttempts(t *testing.T) {
+	plugin := &mockOutput{batchAcceptSize: -1}
+	conf := &OutputConfig{
+		Name:             "retry_max_attempts",
+		Filter:           Filter{},
+		RetryMaxAttempts: 3,
+	}
+	ro, err := NewRunningOutput(plugin, conf, 10, 100)
+	require.NoError(t, err)
+
+	ro.AddMetric(testutil.TestMetric(1, "test"))
+	for range 2 {
+		require.Error(t, ro.Write())
+		require.Equal(t, 1, ro.BufferLength())
+	}
+
+	// The batch is dropped on the last attempt
+	require.Error(t, ro.Write())
+	require.Zero(t, ro.BufferLength())
+	require.Equal(t, int64(1), ro.buffer.Stats().MetricsRejected.Get())
+	require.Zero(t, ro.writeAttempts)
+}
+
+func TestRunningOutputPause(t *testing.T) {
+	plugin := &mockOutput{}
+	conf := &OutputConfig{
+		Name:   "pause",
+		Filter: Filter{},
+	}
+	ro, err := NewRunningOutput(plugin, conf, 10, 100)
+	require.NoError(t, err)
+
+	// Metrics are kept in the buffer while paused
+	ro.Pause()
+	require.True(t, ro.Paused())
+	for i := range 20 {
+		ro.AddMetric(testutil.TestMetric(i, "test"))
+	}
+	require.NoError(t, ro.Write())
+	require.Zero(t, plugin.writes.Load())
+	require.Equal(t, 20, ro.BufferLength())
+	require.Empty(t, ro.BatchReady)
+
+	// Paused outputs are not written on shutdown either
+	require.NoError(t, ro.WriteFinal())
+	require.Zero(t, plugin.writes.Load())
+	require.Equal(t, 20, ro.BufferLength())
+
+	// Resuming triggers writing the full batches
+	ro.Resume()
+	require.False(t, ro.Paused())
+	require.Len(t, ro.BatchReady, 1)
+	require.NoError(t, ro.Write())
+	require.Zero(t, ro.BufferLength())
+	require.Len(t, plugin.Metrics(), 20)
+}
+
+func TestRunningOutputLastError(t *testing.T) {
+	plugin := &mockOutput{batchAcceptSize: -1}
+	conf := &OutputConfig{
+		Name:   "last_error",
+		Filter: Filter{},
+	}
+	ro, err := NewRunningOutput(plugin, conf, 10, 100)
+	require.NoError(t, err)
+	require.NoError(t, ro.LastError())
+
+	ro.AddMetric(testutil.TestMetric(1, "test"))
+	require.Error(t, ro.Write())
+	require.ErrorContains(t, ro.LastError(), "failed write")
+}
+
+func TestRunningOutputCircuitBreaker(t *testing.T) {
+	plugin := &mockOutput{batchAcceptSize: -1}
+	conf := &OutputConfig{
+		Name:                    "circuit_breaker",
+		Filter:                  Filter{},
+		CircuitBreakerThreshold: 2,
+		CircuitBreakerTimeout:   time.Hour,
+	}
+	ro, err := NewRunningOutput(plugin, conf, 10, 100)
+	require.NoError(t, err)
+
+	for i := range 5 {
+		ro.AddMetric(testutil.TestMetric(i, "test"))
+	}
+
+	// The breaker opens after two consecutive failures
+	require.Error(t, ro.Write())
+	require.Equal(t, circuitClosed, ro.breaker.State.Get())
+	require.Error(t, ro.Write())
+	require.Equal(t, circuitOpen, ro.breaker.State.Get())
+	require.Equal(t, int64(1), ro.breaker.Trips.Get())
+	require.Equal(t, uint32(2), plugin.writes.Load())
+
+	// Writes are skipped while the breaker is open
+	require.ErrorIs(t, ro.Write(), ErrBackoff)
+	require.Equal(t, uint32(2), plugin.writes.Load())
+
+	// After the timeout a failing probe opens the breaker again
+	ro.breaker.openedAt = time.Now().Add(-2 * time.Hour)
+	require.Error(t, ro.Write())
+	require.Equal(t, circuitOpen, ro.breaker.State.Get())
+	require.Equal(t, uint32(3), plugin.writes.Load())
+
+	// A successful probe closes the breaker and the remaining metrics are
+	// written
+	plugin.batchAcceptSize = 0
+	ro.breaker.openedAt = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, ro.Write())
+	require.Equal(t, circuitClosed, ro.breaker.State.Get())
+	require.Zero(t, ro.BufferLength())
+	require.Len(t, plugin.Metrics(), 5)
+	require.Equal(t, uint32(5), plugin.writes.Load())
+}
+
+func TestRunningOutputCircuitBreakerRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "permanent error",
+			err:  &internal.PermanentError{Err: errors.New("malformed")},
+		},
+		{
+			name: "partial write",
+			err: &internal.PartialWriteError{
+				Err:           errors.New("invalid field"),
+				MetricsAccept: []int{0},
+				MetricsReject: []int{1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &mockOutput{
+				preWriteHook: func([]telegraf.Metric) error {
+					return tt.err
+				},
+			}
+			conf := &OutputConfig{
+				Name:                    "circuit_breaker_rejected",
+				Filter:                  Filter{},
+				CircuitBreakerThreshold: 2,
+				CircuitBreakerTimeout:   time.Hour,
+			}
+			ro, err := NewRunningOutput(plugin, conf, 10, 100)
+			require.NoError(t, err)
+
+			// Rejecting metrics counts as failure
+			for range 2 {
+				ro.AddMetric(testutil.TestMetric(1, "test"))
+				ro.AddMetric(testutil.TestMetric(2, "test"))
+				require.Error(t, ro.Write())
+			}
+			require.Equal(t, circuitOpen, ro.breaker.State.Get())
+		})
+	}
+}
+
 func TestRunningOutputNoRetriggerOnSuccessfulPartialWriteError(t *testing.T) {
 	// Setup output with a post-write hook to be able to block write until
 	// we added more metrics
@@ -797,17 +1117,19 @@ func TestRunningOutputInternalMetrics(t *testing.T) {
 				"alias":  "test_alias",
 			},
 			map[string]interface{}{
-				"buffer_limit":     10,
-				"buffer_size":      0,
-				"errors":           0,
-				"metrics_added":    0,
-				"metrics_rejected": 0,
-				"metrics_dropped":  0,
-				"metrics_filtered": 0,
-				"metrics_written":  0,
-				"write_errors":     0,
-				"write_time_ns":    0,
-				"startup_errors":   0,
+				"buffer_limit":      10,
+				"buffer_recoveries": 0,
+				"buffer_size":       0,
+				"errors":            0,
+				"metrics_added":     0,
+				"metrics_rejected":  0,
+				"metrics_dropped":   0,
+				"metrics_filtered":  0,
+				"metrics_lost":      0,
+				"metrics_written":   0,
+				"write_errors":      0,
+				"write_time_ns":     0,
+				"startup_errors":    0,
 			},
 			time.Unix(0, 0),
 		),
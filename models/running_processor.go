@@ -5,6 +5,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	logging "github.com/influxdata/telegraf/logger"
+	"github.com/influxdata/telegraf/persister"
 	"github.com/influxdata/telegraf/selfstat"
 )
 
@@ -13,6 +14,8 @@ type RunningProcessor struct {
 	log       telegraf.Logger
 	Processor telegraf.StreamingProcessor
 	Config    *ProcessorConfig
+
+	tracer *Tracer
 }
 
 type RunningProcessors []*RunningProcessor
@@ -27,6 +30,7 @@ type ProcessorConfig struct {
 	Source   string
 	Alias    string
 	ID       string
+	Pipeline string
 	Order    int64
 	Filter   Filter
 	LogLevel string
@@ -97,23 +101,100 @@ func (rp *RunningProcessor) Start(acc telegraf.Accumulator) error {
 }
 
 func (rp *RunningProcessor) Add(m telegraf.Metric, acc telegraf.Accumulator) error {
-	ok, err := rp.Config.Filter.Select(m)
+	trace := rp.tracer.lookup(m)
+
+	ok, reason, err := rp.Config.Filter.selectWithReason(m)
 	if err != nil {
 		rp.log.Errorf("filtering failed: %v", err)
 	} else if !ok {
 		// pass downstream
+		trace.record(rp.LogName(), "filtered", reason, nil)
 		acc.AddMetric(m)
 		return nil
 	}
 
+	var before telegraf.Metric
+	if trace != nil {
+		before = m.Copy()
+	}
+
 	rp.Config.Filter.Modify(m)
 	if len(m.FieldList()) == 0 {
 		// drop metric
+		trace.record(rp.LogName(), "dropped", "no fields left", nil)
+		rp.tracer.End(m)
 		rp.metricFiltered(m)
 		return nil
 	}
 
-	return rp.Processor.Add(m, acc)
+	rp.Lock()
+	defer rp.Unlock()
+	if trace == nil {
+		return rp.Processor.Add(m, acc)
+	}
+
+	tacc := &traceAccumulator{
+		Accumulator: acc,
+		plugin:      rp.LogName(),
+		trace:       trace,
+		metric:      m,
+		before:      before,
+	}
+	err = rp.Processor.Add(m, tacc)
+	tacc.finish()
+	return err
+}
+
+// SetTracer enables recording the actions of the processor on sampled metrics
+func (rp *RunningProcessor) SetTracer(t *Tracer) {
+	rp.tracer = t
+}
+
+func (rp *RunningProcessor) stateful() (telegraf.StatefulPlugin, bool) {
+	if p, ok := rp.Processor.(interface{ Unwrap() telegraf.Processor }); ok {
+		plugin, ok := p.Unwrap().(telegraf.StatefulPlugin)
+		return plugin, ok
+	}
+	plugin, ok := rp.Processor.(telegraf.StatefulPlugin)
+	return plugin, ok
+}
+
+// IsStateful returns true if the underlying processor can persist its state
+func (rp *RunningProcessor) IsStateful() bool {
+	_, ok := rp.stateful()
+	return ok
+}
+
+func (rp *RunningProcessor) GetState() interface{} {
+	plugin, ok := rp.stateful()
+	if !ok {
+		return nil
+	}
+
+	rp.Lock()
+	defer rp.Unlock()
+	return plugin.GetState()
+}
+
+func (rp *RunningProcessor) SetState(state interface{}) error {
+	plugin, ok := rp.stateful()
+	if !ok {
+		return nil
+	}
+
+	rp.Lock()
+	defer rp.Unlock()
+	return plugin.SetState(state)
+}
+
+func (rp *RunningProcessor) StateVersion() int {
+	plugin, _ := rp.stateful()
+	return persister.StateVersion(plugin)
+}
+
+func (rp *RunningProcessor) MigrateState(version int, state []byte) ([]byte, error) {
+	plugin, _ := rp.stateful()
+	return migrateState(plugin, version, state)
 }
 
 func (rp *RunningProcessor) Stop() {
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Tracer records the journey of sampled metrics through the plugins of the
+// pipeline. A nil tracer is valid and does not record anything.
+type Tracer struct {
+	// Trace every n-th metric created by inputs or aggregators
+	every uint64
+
+	sync.Mutex
+	seen   uint64
+	active map[telegraf.Metric]*Trace
+	traces []*Trace
+}
+
+// Trace is the recorded journey of a single metric
+type Trace struct {
+	ID uint64
+	// Plugin creating the metric and its pipeline
+	Origin   string
+	Pipeline string
+	// Metric as created by the plugin
+	Metric string
+	Hops   []Hop
+
+	tracer *Tracer
+}
+
+// Hop is the action of a single plugin on a traced metric. The action is one
+// of "passed" if the plugin did not change the metric, "modified" if the
+// plugin changed the metric, "emitted" if the plugin created a new metric from
+// the traced one, "filtered" if the plugin did not select the metric,
+// "dropped" if the plugin removed the metric from the pipeline,
+// "aggregated" if the metric was added to an aggregator and "written" if the
+// metric would be written by an output.
+type Hop struct {
+	Plugin string
+	Action string
+	Reason string
+	Diff   []string
+}
+
+func NewTracer(every uint64) *Tracer {
+	if every == 0 {
+		every = 1
+	}
+	return &Tracer{
+		every:  every,
+		active: make(map[telegraf.Metric]*Trace),
+	}
+}
+
+// Traces returns all recorded traces in the order of their creation
+func (t *Tracer) Traces() []*Trace {
+	t.Lock()
+	defer t.Unlock()
+	return slices.Clone(t.traces)
+}
+
+// Print writes the recorded traces in a human-readable form
+func (t *Tracer) Print(w io.Writer) error {
+	for _, tr := range t.Traces() {
+		if _, err := io.WriteString(w, tr.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start begins a new trace for the given metric if the metric is sampled
+func (t *Tracer) start(m telegraf.Metric, origin, pipeline string) *Trace {
+	if t == nil {
+		return nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.seen++
+	if (t.seen-1)%t.every != 0 {
+		return nil
+	}
+
+	tr := &Trace{
+		ID:       uint64(len(t.traces) + 1),
+		Origin:   origin,
+		Pipeline: pipeline,
+		Metric:   formatMetric(m),
+		tracer:   t,
+	}
+	t.traces = append(t.traces, tr)
+	t.active[m] = tr
+	return tr
+}
+
+// lookup returns the trace of the given metric or nil if it is not traced
+func (t *Tracer) lookup(m telegraf.Metric) *Trace {
+	if t == nil {
+		return nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	return t.active[m]
+}
+
+// End stops tracing the given metric e.g. when it leaves the pipeline
+func (t *Tracer) End(m telegraf.Metric) {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	delete(t.active, m)
+}
+
+func (tr *Trace) record(plugin, action, reason string, diff []string) {
+	if tr == nil {
+		return
+	}
+
+	tr.tracer.Lock()
+	defer tr.tracer.Unlock()
+	tr.Hops = append(tr.Hops, Hop{Plugin: plugin, Action: action, Reason: reason, Diff: diff})
+}
+
+// change records the modifications done by the plugin to the metric
+func (tr *Trace) change(plugin string, before, after telegraf.Metric) {
+	if tr == nil {
+		return
+	}
+
+	diff := diffMetrics(before, after)
+	if len(diff) == 0 {
+		tr.record(plugin, "passed", "", nil)
+		return
+	}
+	tr.record(plugin, "modified", "", diff)
+}
+
+// follow continues the trace with a metric derived from the traced one
+func (tr *Trace) follow(m telegraf.Metric) {
+	if tr == nil {
+		return
+	}
+
+	tr.tracer.Lock()
+	defer tr.tracer.Unlock()
+	tr.tracer.active[m] = tr
+}
+
+func (tr *Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "trace %d: %s (%s)\n", tr.ID, tr.Metric, tr.Origin)
+	if tr.Pipeline != "" {
+		fmt.Fprintf(&b, "  pipeline: %s\n", tr.Pipeline)
+	}
+	for _, hop := range tr.Hops {
+		fmt.Fprintf(&b, "  %s: %s", hop.Plugin, hop.Action)
+		if hop.Reason != "" {
+			fmt.Fprintf(&b, " (%s)", hop.Reason)
+		}
+		b.WriteString("\n")
+		for _, line := range hop.Diff {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+// traceAccumulator records the metrics emitted by a processor for a traced
+// metric before passing them on to the next plugin
+type traceAccumulator struct {
+	telegraf.Accumulator
+	plugin string
+	trace  *Trace
+	metric telegraf.Metric
+	before telegraf.Metric
+
+	emitted     int
+	passedOwned bool
+}
+
+func (a *traceAccumulator) AddMetric(m telegraf.Metric) {
+	a.emitted++
+	if m == a.metric {
+		a.passedOwned = true
+		a.trace.change(a.plugin, a.before, m)
+	} else {
+		a.trace.follow(m)
+		a.trace.record(a.plugin, "emitted", "", diffMetrics(a.before, m))
+	}
+	a.Accumulator.AddMetric(m)
+}
+
+// finish records the traced metric as dropped if it was not emitted again
+func (a *traceAccumulator) finish() {
+	if a.emitted == 0 {
+		a.trace.record(a.plugin, "dropped", "not emitted by the plugin", nil)
+	}
+	if !a.passedOwned {
+		a.trace.tracer.End(a.metric)
+	}
+}
+
+// formatMetric returns a line-protocol like representation of the metric
+func formatMetric(m telegraf.Metric) string {
+	var b strings.Builder
+	b.WriteString(m.Name())
+	for _, tag := range m.TagList() {
+		fmt.Fprintf(&b, ",%s=%s", tag.Key, tag.Value)
+	}
+	fields := make([]string, 0, len(m.FieldList()))
+	for _, field := range m.FieldList() {
+		fields = append(fields, field.Key+"="+formatValue(field.Value))
+	}
+	sort.Strings(fields)
+	fmt.Fprintf(&b, " %s %d", strings.Join(fields, ","), m.Time().UnixNano())
+	return b.String()
+}
+
+// diffMetrics returns the differences between the two metrics with added
+// elements prefixed by "+", removed ones by "-" and changed ones by "~"
+func diffMetrics(before, after telegraf.Metric) []string {
+	var diff []string
+	if before.Name() != after.Name() {
+		diff = append(diff, fmt.Sprintf("~ name: %s -> %s", before.Name(), after.Name()))
+	}
+
+	beforeTags := make(map[string]interface{}, len(before.TagList()))
+	for _, tag := range before.TagList() {
+		beforeTags[tag.Key] = tag.Value
+	}
+	afterTags := make(map[string]interface{}, len(after.TagList()))
+	for _, tag := range after.TagList() {
+		afterTags[tag.Key] = tag.Value
+	}
+	diff = append(diff, diffValues("tag", beforeTags, afterTags, func(v interface{}) string { return v.(string) })...)
+	diff = append(diff, diffValues("field", before.Fields(), after.Fields(), formatValue)...)
+
+	if !before.Time().Equal(after.Time()) {
+		diff = append(diff, fmt.Sprintf("~ time: %d -> %d", before.Time().UnixNano(), after.Time().UnixNano()))
+	}
+	return diff
+}
+
+func diffValues(kind string, before, after map[string]interface{}, format func(interface{}) string) []string {
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, found := before[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var diff []string
+	for _, k := range keys {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		switch {
+		case !inAfter:
+			diff = append(diff, fmt.Sprintf("- %s %s=%s", kind, k, format(b)))
+		case !inBefore:
+			diff = append(diff, fmt.Sprintf("+ %s %s=%s", kind, k, format(a)))
+		case b != a:
+			diff = append(diff, fmt.Sprintf("~ %s %s: %s -> %s", kind, k, format(b), format(a)))
+		}
+	}
+	return diff
+}
+
+// formatValue returns the field value with strings being quoted to make type
+// changes visible
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%v", v)
+}
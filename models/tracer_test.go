@@ -0,0 +1,188 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestTracer(t *testing.T) {
+	tracer := NewTracer(1)
+
+	input := NewRunningInput(&mockInput{}, &InputConfig{
+		Name:              "trace",
+		MeasurementPrefix: "p_",
+	})
+	input.SetTracer(tracer)
+
+	skipped := NewRunningProcessor(&mockStreamingProcessor{}, &ProcessorConfig{
+		Name:   "skipped",
+		Filter: Filter{NamePass: []string{"other"}},
+	})
+	require.NoError(t, skipped.Config.Filter.Compile())
+	skipped.SetTracer(tracer)
+
+	modifier := NewRunningProcessor(&mockStreamingProcessor{
+		add: func(m telegraf.Metric, acc telegraf.Accumulator) {
+			m.AddTag("env", "test")
+			m.AddField("value", "42")
+			acc.AddMetric(m)
+		},
+	}, &ProcessorConfig{Name: "modifier"})
+	modifier.SetTracer(tracer)
+
+	dropper := NewRunningProcessor(&mockStreamingProcessor{
+		add: func(m telegraf.Metric, acc telegraf.Accumulator) {
+			if _, found := m.GetTag("drop"); found {
+				m.Drop()
+				return
+			}
+			acc.AddMetric(m)
+		},
+	}, &ProcessorConfig{Name: "dropper"})
+	dropper.SetTracer(tracer)
+
+	output, err := NewRunningOutput(&mockOutput{}, &OutputConfig{
+		Name:       "trace",
+		NameSuffix: "_out",
+		Filter: Filter{
+			TagDropFilters: []TagFilter{{Name: "host", Values: []string{"b"}}},
+		},
+	}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, output.Config.Filter.Compile())
+	output.SetTracer(tracer)
+
+	now := time.Unix(0, 0)
+	inputs := []telegraf.Metric{
+		metric.New("cpu", map[string]string{"host": "a"}, map[string]interface{}{"value": 42}, now),
+		metric.New("cpu", map[string]string{"host": "b"}, map[string]interface{}{"value": 23}, now),
+		metric.New("cpu", map[string]string{"host": "c", "drop": "true"}, map[string]interface{}{"value": 0}, now),
+	}
+	var acc testutil.Accumulator
+	for _, m := range inputs {
+		m = input.MakeMetric(m)
+		for _, p := range []*RunningProcessor{skipped, modifier, dropper} {
+			acc.ClearMetrics()
+			require.NoError(t, p.Add(m, &acc))
+			if len(acc.GetTelegrafMetrics()) == 0 {
+				m = nil
+				break
+			}
+			m = acc.GetTelegrafMetrics()[0]
+		}
+		if m != nil {
+			output.TraceMetric(m)
+			tracer.End(m)
+		}
+	}
+	require.Zero(t, output.BufferLength())
+
+	expected := []*Trace{
+		{
+			ID:     1,
+			Origin: "inputs.trace",
+			Metric: "cpu,host=a value=42 0",
+			Hops: []Hop{
+				{Plugin: "inputs.trace", Action: "modified", Diff: []string{"~ name: cpu -> p_cpu"}},
+				{Plugin: "processors.skipped", Action: "filtered", Reason: "namepass"},
+				{
+					Plugin: "processors.modifier",
+					Action: "modified",
+					Diff:   []string{"+ tag env=test", `~ field value: 42 -> "42"`},
+				},
+				{Plugin: "processors.dropper", Action: "passed"},
+				{Plugin: "outputs.trace", Action: "written", Diff: []string{"~ name: p_cpu -> p_cpu_out"}},
+			},
+		},
+		{
+			ID:     2,
+			Origin: "inputs.trace",
+			Metric: "cpu,host=b value=23 0",
+			Hops: []Hop{
+				{Plugin: "inputs.trace", Action: "modified", Diff: []string{"~ name: cpu -> p_cpu"}},
+				{Plugin: "processors.skipped", Action: "filtered", Reason: "namepass"},
+				{
+					Plugin: "processors.modifier",
+					Action: "modified",
+					Diff:   []string{"+ tag env=test", `~ field value: 23 -> "42"`},
+				},
+				{Plugin: "processors.dropper", Action: "passed"},
+				{Plugin: "outputs.trace", Action: "filtered", Reason: "tagdrop"},
+			},
+		},
+		{
+			ID:     3,
+			Origin: "inputs.trace",
+			Metric: "cpu,drop=true,host=c value=0 0",
+			Hops: []Hop{
+				{Plugin: "inputs.trace", Action: "modified", Diff: []string{"~ name: cpu -> p_cpu"}},
+				{Plugin: "processors.skipped", Action: "filtered", Reason: "namepass"},
+				{
+					Plugin: "processors.modifier",
+					Action: "modified",
+					Diff:   []string{"+ tag env=test", `~ field value: 0 -> "42"`},
+				},
+				{Plugin: "processors.dropper", Action: "dropped", Reason: "not emitted by the plugin"},
+			},
+		},
+	}
+	traces := tracer.Traces()
+	for _, tr := range traces {
+		tr.tracer = nil
+	}
+	require.Equal(t, expected, traces)
+	require.Empty(t, tracer.active)
+}
+
+func TestTracerSampling(t *testing.T) {
+	tracer := NewTracer(3)
+	input := NewRunningInput(&mockInput{}, &InputConfig{Name: "trace"})
+	input.SetTracer(tracer)
+
+	for i := range 7 {
+		input.MakeMetric(metric.New("cpu", nil, map[string]interface{}{"value": i}, time.Unix(0, 0)))
+	}
+
+	traces := tracer.Traces()
+	require.Len(t, traces, 3)
+	require.Equal(t, "cpu value=0 0", traces[0].Metric)
+	require.Equal(t, "cpu value=3 0", traces[1].Metric)
+	require.Equal(t, "cpu value=6 0", traces[2].Metric)
+}
+
+func TestTracerDisabled(t *testing.T) {
+	var tracer *Tracer
+	m := metric.New("cpu", nil, map[string]interface{}{"value": 42}, time.Unix(0, 0))
+	require.Nil(t, tracer.start(m, "inputs.cpu", ""))
+	require.Nil(t, tracer.lookup(m))
+	tracer.End(m)
+}
+
+type mockStreamingProcessor struct {
+	add func(telegraf.Metric, telegraf.Accumulator)
+}
+
+func (*mockStreamingProcessor) SampleConfig() string {
+	return ""
+}
+
+func (*mockStreamingProcessor) Start(telegraf.Accumulator) error {
+	return nil
+}
+
+func (p *mockStreamingProcessor) Add(m telegraf.Metric, acc telegraf.Accumulator) error {
+	if p.add == nil {
+		acc.AddMetric(m)
+		return nil
+	}
+	p.add(m, acc)
+	return nil
+}
+
+func (*mockStreamingProcessor) Stop() {}
@@ -4,15 +4,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sync"
 
 	"github.com/influxdata/telegraf"
 )
 
+// Version of the state file format. Version zero denotes the original format
+// mapping plugin IDs to the serialized states without version information.
+const fileVersion = 1
+
+type stateFile struct {
+	Version int                    `json:"version"`
+	States  map[string]pluginState `json:"states"`
+}
+
+type pluginState struct {
+	Version int             `json:"version"`
+	State   json.RawMessage `json:"state"`
+}
+
 type Persister struct {
 	Filename string
 
 	register map[string]telegraf.StatefulPlugin
+	mu       sync.Mutex
 }
 
 func (p *Persister) Init() error {
@@ -22,6 +39,9 @@ func (p *Persister) Init() error {
 }
 
 func (p *Persister) Register(id string, plugin telegraf.StatefulPlugin) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	if _, found := p.register[id]; found {
 		return fmt.Errorf("plugin with ID %q already registered", id)
 	}
@@ -30,6 +50,24 @@ func (p *Persister) Register(id string, plugin telegraf.StatefulPlugin) error {
 	return nil
 }
 
+// IsRegistered returns true if a plugin with the given ID is registered
+func (p *Persister) IsRegistered(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, found := p.register[id]
+	return found
+}
+
+// Unregister removes the plugin with the given ID, e.g. when the plugin is
+// removed while running.
+func (p *Persister) Unregister(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.register, id)
+}
+
 func (p *Persister) Load() error {
 	// Read the states from disk
 	in, err := os.ReadFile(p.Filename)
@@ -37,20 +75,35 @@ func (p *Persister) Load() error {
 		return fmt.Errorf("reading states file failed: %w", err)
 	}
 
-	// Unmarshal the id to serialized states map
-	var states map[string][]byte
-	if err := json.Unmarshal(in, &states); err != nil {
+	states, err := unmarshalStates(in)
+	if err != nil {
 		return fmt.Errorf("unmarshalling states failed: %w", err)
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	// Get the initialized state as blueprint for unmarshalling
-	for id, serialized := range states {
+	for id, entry := range states {
 		// Check if we have a plugin with that ID
 		plugin, found := p.register[id]
 		if !found {
 			continue
 		}
 
+		// Migrate states of older versions
+		serialized := []byte(entry.State)
+		if version := StateVersion(plugin); entry.Version != version {
+			vp, ok := plugin.(telegraf.StatefulPluginWithVersion)
+			if !ok || entry.Version > version {
+				return fmt.Errorf("unsupported state version %d for %q", entry.Version, id)
+			}
+			serialized, err = vp.MigrateState(entry.Version, serialized)
+			if err != nil {
+				return fmt.Errorf("migrating state for %q from version %d failed: %w", id, entry.Version, err)
+			}
+		}
+
 		// Create a new empty state of the "state"-type. As we need a pointer
 		// of the state, we cannot dereference it here due to the unknown
 		// nature of the state-type.
@@ -70,7 +123,14 @@ func (p *Persister) Load() error {
 }
 
 func (p *Persister) Store() error {
-	states := make(map[string][]byte)
+	// Serialize concurrent checkpoints and the final store on shutdown
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	states := stateFile{
+		Version: fileVersion,
+		States:  make(map[string]pluginState, len(p.register)),
+	}
 
 	// Collect the states and serialize the individual data chunks
 	// to later serialize all items in the id / serialized-states map
@@ -79,7 +139,7 @@ func (p *Persister) Store() error {
 		if err != nil {
 			return fmt.Errorf("marshalling state for id %q failed: %w", id, err)
 		}
-		states[id] = state
+		states.States[id] = pluginState{Version: StateVersion(plugin), State: state}
 	}
 
 	// Serialize the states
@@ -88,16 +148,66 @@ func (p *Persister) Store() error {
 		return fmt.Errorf("marshalling states failed: %w", err)
 	}
 
-	// Write the states to disk
-	f, err := os.Create(p.Filename)
+	// Write the states to a temporary file and replace the state file
+	// afterwards to not end up with a truncated file on crashes.
+	f, err := os.CreateTemp(filepath.Dir(p.Filename), filepath.Base(p.Filename)+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("creating states file %q failed: %w", p.Filename, err)
+		return fmt.Errorf("creating temporary states file for %q failed: %w", p.Filename, err)
 	}
-	defer f.Close()
+	defer os.Remove(f.Name())
 
 	if _, err := f.Write(serialized); err != nil {
+		f.Close()
 		return fmt.Errorf("writing states failed: %w", err)
 	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing states failed: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing states file failed: %w", err)
+	}
+	if err := os.Rename(f.Name(), p.Filename); err != nil {
+		return fmt.Errorf("replacing states file %q failed: %w", p.Filename, err)
+	}
 
 	return nil
 }
+
+// unmarshalStates decodes the state file of the current or the original,
+// unversioned format.
+func unmarshalStates(in []byte) (map[string]pluginState, error) {
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(in, &probe); err == nil && probe.Version > 0 {
+		if probe.Version > fileVersion {
+			return nil, fmt.Errorf("unsupported file version %d", probe.Version)
+		}
+		var states stateFile
+		if err := json.Unmarshal(in, &states); err != nil {
+			return nil, err
+		}
+		return states.States, nil
+	}
+
+	// The original format maps the IDs to the serialized states
+	var legacy map[string][]byte
+	if err := json.Unmarshal(in, &legacy); err != nil {
+		return nil, err
+	}
+	states := make(map[string]pluginState, len(legacy))
+	for id, state := range legacy {
+		states[id] = pluginState{State: state}
+	}
+	return states, nil
+}
+
+// StateVersion returns the version of the state of the given plugin, plugins
+// not implementing telegraf.StatefulPluginWithVersion have version zero
+func StateVersion(plugin telegraf.StatefulPlugin) int {
+	if p, ok := plugin.(telegraf.StatefulPluginWithVersion); ok {
+		return p.StateVersion()
+	}
+	return 0
+}
@@ -0,0 +1,149 @@
+package persister
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	store := &Persister{Filename: filename}
+	require.NoError(t, store.Init())
+	require.NoError(t, store.Register("a", &mockPlugin{state: mockState{Offset: 42}}))
+	require.NoError(t, store.Store())
+
+	// Storing again must replace the file without leaving temporary files
+	require.NoError(t, store.Store())
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	plugin := &mockPlugin{}
+	load := &Persister{Filename: filename}
+	require.NoError(t, load.Init())
+	require.NoError(t, load.Register("a", plugin))
+	require.NoError(t, load.Load())
+	require.Equal(t, mockState{Offset: 42}, plugin.state)
+}
+
+func TestLoadUnversionedFormat(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := json.Marshal(mockState{Offset: 23})
+	require.NoError(t, err)
+	content, err := json.Marshal(map[string][]byte{"a": state})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, content, 0600))
+
+	plugin := &mockPlugin{}
+	dut := &Persister{Filename: filename}
+	require.NoError(t, dut.Init())
+	require.NoError(t, dut.Register("a", plugin))
+	require.NoError(t, dut.Load())
+	require.Equal(t, mockState{Offset: 23}, plugin.state)
+}
+
+func TestLoadMigrateState(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	// Store a state of the previous version
+	store := &Persister{Filename: filename}
+	require.NoError(t, store.Init())
+	require.NoError(t, store.Register("a", &mockPlugin{state: mockState{Offset: 42}}))
+	require.NoError(t, store.Store())
+
+	plugin := &mockVersionedPlugin{version: 1}
+	load := &Persister{Filename: filename}
+	require.NoError(t, load.Init())
+	require.NoError(t, load.Register("a", plugin))
+	require.NoError(t, load.Load())
+	require.Equal(t, mockState{Offset: 42, Migrated: true}, plugin.state)
+}
+
+func TestLoadNewerStateVersion(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	store := &Persister{Filename: filename}
+	require.NoError(t, store.Init())
+	require.NoError(t, store.Register("a", &mockVersionedPlugin{version: 2}))
+	require.NoError(t, store.Store())
+
+	load := &Persister{Filename: filename}
+	require.NoError(t, load.Init())
+	require.NoError(t, load.Register("a", &mockVersionedPlugin{version: 1}))
+	require.ErrorContains(t, load.Load(), "unsupported state version 2")
+}
+
+func TestLoadConcurrentRegister(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	store := &Persister{Filename: filename}
+	require.NoError(t, store.Init())
+	require.NoError(t, store.Register("a", &mockPlugin{state: mockState{Offset: 42}}))
+	require.NoError(t, store.Store())
+
+	// Plugins might be registered while loading, e.g. when reloading the
+	// configuration, which must not race with the loading
+	load := &Persister{Filename: filename}
+	require.NoError(t, load.Init())
+	require.NoError(t, load.Register("a", &mockPlugin{}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			_ = load.Register(fmt.Sprintf("b%d", i), &mockPlugin{})
+		}
+	}()
+	require.NoError(t, load.Load())
+	wg.Wait()
+}
+
+type mockState struct {
+	Offset   int64 `json:"offset"`
+	Migrated bool  `json:"migrated,omitempty"`
+}
+
+type mockPlugin struct {
+	state mockState
+}
+
+func (p *mockPlugin) GetState() interface{} {
+	return p.state
+}
+
+func (p *mockPlugin) SetState(state interface{}) error {
+	s, ok := state.(mockState)
+	if !ok {
+		return errors.New("invalid state type")
+	}
+	p.state = s
+	return nil
+}
+
+type mockVersionedPlugin struct {
+	mockPlugin
+	version int
+}
+
+func (p *mockVersionedPlugin) StateVersion() int {
+	return p.version
+}
+
+func (*mockVersionedPlugin) MigrateState(_ int, state []byte) ([]byte, error) {
+	var s mockState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, err
+	}
+	s.Migrated = true
+	return json.Marshal(s)
+}
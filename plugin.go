@@ -49,7 +49,9 @@ type StatefulPlugin interface {
 	// serialized to JSON. The best choice is a structure defined in
 	// your plugin.
 	// Note: This function has to be callable directly after the
-	// plugin's Init() function if there is any!
+	// plugin's Init() function if there is any! If checkpointing is
+	// enabled the function is called periodically while the plugin is
+	// running.
 	GetState() interface{}
 
 	// SetState is called by the Persister once after loading and
@@ -57,6 +59,21 @@ type StatefulPlugin interface {
 	SetState(state interface{}) error
 }
 
+// StatefulPluginWithVersion is an optional interface for stateful plugins
+// changing the format of their state. The version is stored along with the
+// state and older states are migrated before calling SetState.
+type StatefulPluginWithVersion interface {
+	StatefulPlugin
+
+	// StateVersion returns the version of the state returned by GetState.
+	// Plugins not implementing this interface have the version zero.
+	StateVersion() int
+
+	// MigrateState converts the serialized state of the given older version
+	// to the serialized state of the current version.
+	MigrateState(version int, state []byte) ([]byte, error)
+}
+
 // ProbePlugin is an interface that all input/output plugins need to
 // implement in order to support the `probe` value of `startup_error_behavior`
 type ProbePlugin interface {
@@ -3,6 +3,7 @@ package basicstats
 
 import (
 	_ "embed"
+	"fmt"
 	"math"
 	"time"
 
@@ -231,6 +232,88 @@ func (b *BasicStats) Reset() {
 	b.cache = make(map[uint64]aggregate)
 }
 
+// state is the serializable representation of the cache
+type state map[uint64]aggregateState
+
+type aggregateState struct {
+	Name   string                `json:"name"`
+	Tags   map[string]string     `json:"tags,omitempty"`
+	Fields map[string]statsState `json:"fields"`
+}
+
+type statsState struct {
+	Count    float64       `json:"count"`
+	Min      float64       `json:"min"`
+	Max      float64       `json:"max"`
+	Sum      float64       `json:"sum"`
+	Mean     float64       `json:"mean"`
+	Diff     float64       `json:"diff"`
+	Rate     float64       `json:"rate"`
+	Interval time.Duration `json:"interval"`
+	Last     float64       `json:"last"`
+	First    float64       `json:"first"`
+	M2       float64       `json:"m2"`
+	Previous float64       `json:"previous"`
+	Time     time.Time     `json:"time"`
+}
+
+func (b *BasicStats) GetState() interface{} {
+	s := make(state, len(b.cache))
+	for id, a := range b.cache {
+		fields := make(map[string]statsState, len(a.fields))
+		for k, v := range a.fields {
+			fields[k] = statsState{
+				Count:    v.count,
+				Min:      v.min,
+				Max:      v.max,
+				Sum:      v.sum,
+				Mean:     v.mean,
+				Diff:     v.diff,
+				Rate:     v.rate,
+				Interval: v.interval,
+				Last:     v.last,
+				First:    v.first,
+				M2:       v.M2,
+				Previous: v.PREVIOUS,
+				Time:     v.TIME,
+			}
+		}
+		s[id] = aggregateState{Name: a.name, Tags: a.tags, Fields: fields}
+	}
+	return s
+}
+
+func (b *BasicStats) SetState(st interface{}) error {
+	s, ok := st.(state)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", st)
+	}
+
+	b.cache = make(map[uint64]aggregate, len(s))
+	for id, a := range s {
+		fields := make(map[string]basicstats, len(a.Fields))
+		for k, v := range a.Fields {
+			fields[k] = basicstats{
+				count:    v.Count,
+				min:      v.Min,
+				max:      v.Max,
+				sum:      v.Sum,
+				mean:     v.Mean,
+				diff:     v.Diff,
+				rate:     v.Rate,
+				interval: v.Interval,
+				last:     v.Last,
+				first:    v.First,
+				M2:       v.M2,
+				PREVIOUS: v.Previous,
+				TIME:     v.Time,
+			}
+		}
+		b.cache[id] = aggregate{name: a.Name, tags: a.Tags, fields: fields}
+	}
+	return nil
+}
+
 // member function for logging.
 func (b *BasicStats) parseStats() *configuredStats {
 	parsed := &configuredStats{}
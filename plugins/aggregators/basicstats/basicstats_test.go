@@ -1,6 +1,7 @@
 package basicstats
 
 import (
+	"encoding/json"
 	"math"
 	"testing"
 	"time"
@@ -824,3 +825,32 @@ func TestBasicStatsWithOnlyFirst(t *testing.T) {
 	}
 	acc.AssertContainsTaggedFields(t, "m1", expectedFields, expectedTags)
 }
+
+func TestBasicStatsStatePersistence(t *testing.T) {
+	plugin := newBasicStats()
+	plugin.Stats = []string{"count", "min", "max", "mean", "sum", "diff", "interval", "first", "last"}
+	plugin.Log = testutil.Logger{}
+	require.NoError(t, plugin.Init())
+	plugin.Add(m1)
+
+	// Serialize and restore the state in a new instance
+	serialized, err := json.Marshal(plugin.GetState())
+	require.NoError(t, err)
+	var s state
+	require.NoError(t, json.Unmarshal(serialized, &s))
+
+	restored := newBasicStats()
+	restored.Stats = plugin.Stats
+	restored.Log = testutil.Logger{}
+	require.NoError(t, restored.Init())
+	require.NoError(t, restored.SetState(s))
+
+	// Both instances should produce the same output
+	var expected, actual testutil.Accumulator
+	plugin.Add(m2)
+	plugin.Push(&expected)
+	restored.Add(m2)
+	restored.Push(&actual)
+
+	testutil.RequireMetricsEqual(t, expected.GetTelegrafMetrics(), actual.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
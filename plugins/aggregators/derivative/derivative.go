@@ -3,6 +3,7 @@ package derivative
 
 import (
 	_ "embed"
+	"fmt"
 	"strings"
 	"time"
 
@@ -125,6 +126,60 @@ func (d *Derivative) Reset() {
 	}
 }
 
+// state is the serializable representation of the cache
+type state map[uint64]aggregateState
+
+type aggregateState struct {
+	Name     string            `json:"name"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	First    eventState        `json:"first"`
+	Last     eventState        `json:"last"`
+	RollOver uint              `json:"roll_over"`
+}
+
+type eventState struct {
+	Fields map[string]float64 `json:"fields"`
+	Time   time.Time          `json:"time"`
+}
+
+func (d *Derivative) GetState() interface{} {
+	s := make(state, len(d.cache))
+	for id, a := range d.cache {
+		s[id] = aggregateState{
+			Name:     a.name,
+			Tags:     a.tags,
+			First:    eventState{Fields: a.first.fields, Time: a.first.time},
+			Last:     eventState{Fields: a.last.fields, Time: a.last.time},
+			RollOver: a.rollOver,
+		}
+	}
+	return s
+}
+
+func (d *Derivative) SetState(st interface{}) error {
+	s, ok := st.(state)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", st)
+	}
+
+	d.cache = make(map[uint64]*aggregate, len(s))
+	for id, a := range s {
+		first := &event{fields: a.First.Fields, time: a.First.Time}
+		last := first
+		if !a.Last.Time.Equal(a.First.Time) {
+			last = &event{fields: a.Last.Fields, time: a.Last.Time}
+		}
+		d.cache[id] = &aggregate{
+			name:     a.Name,
+			tags:     a.Tags,
+			first:    first,
+			last:     last,
+			rollOver: a.RollOver,
+		}
+	}
+	return nil
+}
+
 func newAggregate(in telegraf.Metric) *aggregate {
 	event := newEvent(in)
 	return &aggregate{
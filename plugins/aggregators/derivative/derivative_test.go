@@ -1,6 +1,7 @@
 package derivative
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -416,3 +417,41 @@ func TestCalculatesCorrectDerivativeOnTwoConsecutivePeriods(t *testing.T) {
 		"value_rate": 2.0,
 	})
 }
+
+func TestStatePersistence(t *testing.T) {
+	derivative := newDerivative()
+	derivative.Variable = "parameter"
+	derivative.Log = testutil.Logger{}
+	require.NoError(t, derivative.Init())
+	derivative.Add(start)
+
+	// Serialize and restore the state in a new instance
+	serialized, err := json.Marshal(derivative.GetState())
+	require.NoError(t, err)
+	var s state
+	require.NoError(t, json.Unmarshal(serialized, &s))
+
+	restored := newDerivative()
+	restored.Variable = "parameter"
+	restored.Log = testutil.Logger{}
+	require.NoError(t, restored.Init())
+	require.NoError(t, restored.SetState(s))
+
+	// A single restored event must not produce a derivative
+	acc := testutil.Accumulator{}
+	restored.Push(&acc)
+	require.Empty(t, acc.Metrics)
+
+	restored.Add(finish)
+	restored.Push(&acc)
+
+	expectedFields := map[string]interface{}{
+		"increasing_rate": 100.0,
+		"decreasing_rate": -10.0,
+		"unchanged_rate":  0.0,
+	}
+	expectedTags := map[string]string{
+		"state": "full",
+	}
+	acc.AssertContainsTaggedFields(t, "TestMetric", expectedFields, expectedTags)
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/plugins/aggregators"
+	parsers_influx "github.com/influxdata/telegraf/plugins/parsers/influx"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
 )
 
 //go:embed sample.conf
@@ -18,6 +20,7 @@ type Final struct {
 	OutputStrategy         string          `toml:"output_strategy"`
 	SeriesTimeout          config.Duration `toml:"series_timeout"`
 	KeepOriginalFieldNames bool            `toml:"keep_original_field_names"`
+	Log                    telegraf.Logger `toml:"-"`
 
 	// The last metric for all series which are active
 	metricCache map[uint64]telegraf.Metric
@@ -77,6 +80,45 @@ func (m *Final) Push(acc telegraf.Accumulator) {
 func (*Final) Reset() {
 }
 
+func (m *Final) GetState() interface{} {
+	metrics := make([]telegraf.Metric, 0, len(m.metricCache))
+	for _, metric := range m.metricCache {
+		metrics = append(metrics, metric)
+	}
+
+	serializer := &influx.Serializer{UintSupport: true}
+	if err := serializer.Init(); err != nil {
+		m.Log.Errorf("initializing serializer failed: %v", err)
+		return []byte{}
+	}
+	state, err := serializer.SerializeBatch(metrics)
+	if err != nil {
+		m.Log.Errorf("serializing state failed: %v", err)
+		return []byte{}
+	}
+	return state
+}
+
+func (m *Final) SetState(state interface{}) error {
+	data, ok := state.([]byte)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	parser := &parsers_influx.Parser{}
+	if err := parser.Init(); err != nil {
+		return err
+	}
+	metrics, err := parser.Parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing state failed: %w", err)
+	}
+	for _, metric := range metrics {
+		m.Add(metric)
+	}
+	return nil
+}
+
 func newFinal() *Final {
 	return &Final{
 		SeriesTimeout: config.Duration(5 * time.Minute),
@@ -306,3 +306,44 @@ func TestKeepOriginalFieldNames(t *testing.T) {
 
 	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.SortMetrics())
 }
+
+func TestStatePersistence(t *testing.T) {
+	final := newFinal()
+	final.OutputStrategy = "periodic"
+	require.NoError(t, final.Init())
+
+	m := metric.New("m1",
+		map[string]string{"foo": "bar"},
+		map[string]interface{}{
+			"a": int64(1),
+			"b": uint64(2),
+			"c": 3.5,
+			"d": "four",
+			"e": true,
+		},
+		time.Unix(1530939936, 0))
+	final.Add(m)
+
+	// Restore the state in a new instance
+	restored := newFinal()
+	restored.OutputStrategy = "periodic"
+	require.NoError(t, restored.Init())
+	require.NoError(t, restored.SetState(final.GetState()))
+
+	acc := testutil.Accumulator{}
+	restored.Push(&acc)
+
+	expected := []telegraf.Metric{
+		metric.New("m1",
+			map[string]string{"foo": "bar"},
+			map[string]interface{}{
+				"a_final": int64(1),
+				"b_final": uint64(2),
+				"c_final": 3.5,
+				"d_final": "four",
+				"e_final": true,
+			},
+			time.Unix(1530939936, 0)),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+}
@@ -3,6 +3,7 @@ package histogram
 
 import (
 	_ "embed"
+	"fmt"
 	"sort"
 	"strconv"
 	"time"
@@ -156,6 +157,62 @@ func (h *Histogram) Reset() {
 	}
 }
 
+// state is the serializable representation of the cache
+type state map[uint64]histogramState
+
+type histogramState struct {
+	Name       string             `json:"name"`
+	Tags       map[string]string  `json:"tags,omitempty"`
+	Counts     map[string][]int64 `json:"counts"`
+	ExpireTime time.Time          `json:"expire_time"`
+	Updated    bool               `json:"updated"`
+}
+
+func (h *Histogram) GetState() interface{} {
+	s := make(state, len(h.cache))
+	for id, agr := range h.cache {
+		collection := make(map[string][]int64, len(agr.histogramCollection))
+		for field, c := range agr.histogramCollection {
+			collection[field] = c
+		}
+		s[id] = histogramState{
+			Name:       agr.name,
+			Tags:       agr.tags,
+			Counts:     collection,
+			ExpireTime: agr.expireTime,
+			Updated:    agr.updated,
+		}
+	}
+	return s
+}
+
+func (h *Histogram) SetState(st interface{}) error {
+	s, ok := st.(state)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", st)
+	}
+
+	h.resetCache()
+	for id, agr := range s {
+		collection := make(map[string]counts, len(agr.Counts))
+		for field, c := range agr.Counts {
+			// Skip fields with changed buckets as the counts cannot be mapped
+			if len(c) != len(h.getBuckets(agr.Name, field))+1 {
+				continue
+			}
+			collection[field] = c
+		}
+		h.cache[id] = metricHistogramCollection{
+			histogramCollection: collection,
+			name:                agr.Name,
+			tags:                agr.Tags,
+			expireTime:          agr.ExpireTime,
+			updated:             agr.Updated,
+		}
+	}
+	return nil
+}
+
 // groupFieldsByBuckets groups fields by metric buckets which are represented as tags
 func (h *Histogram) groupFieldsByBuckets(
 	metricsWithGroupedFields *[]groupedByCountFields, name, field string, tags map[string]string, counts []int64,
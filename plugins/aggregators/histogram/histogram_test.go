@@ -1,6 +1,7 @@
 package histogram
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -574,3 +575,34 @@ func assertContainsTaggedField(t *testing.T, acc *testutil.Accumulator, metricNa
 
 	require.Failf(t, "Unknown measurement", "Unknown measurement %q with tags: %v, fields: %v", metricName, tags, fields)
 }
+
+// TestHistogramStatePersistence tests restoring the cumulative counts
+func TestHistogramStatePersistence(t *testing.T) {
+	cfg := []bucketConfig{
+		{
+			Metric:  "first_metric_name",
+			Fields:  []string{"a"},
+			Buckets: []float64{0.0, 10.0, 20.0, 30.0, 40.0},
+		},
+	}
+	histogram := newTestHistogram(cfg, false, true, false).(*Histogram)
+	histogram.Add(firstMetric1)
+
+	// Serialize and restore the state in a new instance
+	serialized, err := json.Marshal(histogram.GetState())
+	require.NoError(t, err)
+	var s state
+	require.NoError(t, json.Unmarshal(serialized, &s))
+
+	restored := newTestHistogram(cfg, false, true, false).(*Histogram)
+	require.NoError(t, restored.SetState(s))
+
+	acc := &testutil.Accumulator{}
+	restored.Add(firstMetric2)
+	restored.Push(acc)
+
+	require.Len(t, acc.Metrics, 6, "Incorrect number of metrics")
+	assertContainsTaggedField(t, acc, "first_metric_name", fields{"a_bucket": int64(0)}, tags{bucketRightTag: "10"})
+	assertContainsTaggedField(t, acc, "first_metric_name", fields{"a_bucket": int64(2)}, tags{bucketRightTag: "20"})
+	assertContainsTaggedField(t, acc, "first_metric_name", fields{"a_bucket": int64(2)}, tags{bucketRightTag: bucketPosInf})
+}
@@ -1,6 +1,8 @@
 package quantile
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"sort"
 
@@ -12,6 +14,32 @@ type algorithm interface {
 	Quantile(q float64) float64
 }
 
+// marshalAlgorithm serializes the data collected by the given algorithm
+func marshalAlgorithm(algo algorithm) ([]byte, error) {
+	switch a := algo.(type) {
+	case *tdigest.TDigest:
+		return a.AsBytes()
+	case *exactAlgorithmR7:
+		return json.Marshal(a.xs)
+	case *exactAlgorithmR8:
+		return json.Marshal(a.xs)
+	}
+	return nil, fmt.Errorf("unsupported algorithm %T", algo)
+}
+
+// unmarshalAlgorithm restores the data collected by the given algorithm
+func unmarshalAlgorithm(algo algorithm, data []byte) error {
+	switch a := algo.(type) {
+	case *tdigest.TDigest:
+		return a.FromBytes(data)
+	case *exactAlgorithmR7:
+		return json.Unmarshal(data, &a.xs)
+	case *exactAlgorithmR8:
+		return json.Unmarshal(data, &a.xs)
+	}
+	return fmt.Errorf("unsupported algorithm %T", algo)
+}
+
 func newTDigest(compression float64) (algorithm, error) {
 	return tdigest.New(tdigest.Compression(compression))
 }
@@ -128,6 +128,56 @@ func (q *Quantile) Reset() {
 	q.cache = make(map[uint64]aggregate)
 }
 
+// state is the serializable representation of the cache
+type state map[uint64]aggregateState
+
+type aggregateState struct {
+	Name   string            `json:"name"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Fields map[string][]byte `json:"fields"`
+}
+
+func (q *Quantile) GetState() interface{} {
+	s := make(state, len(q.cache))
+	for id, a := range q.cache {
+		fields := make(map[string][]byte, len(a.fields))
+		for k, algo := range a.fields {
+			data, err := marshalAlgorithm(algo)
+			if err != nil {
+				q.Log.Errorf("serializing field %s failed: %v", k, err)
+				continue
+			}
+			fields[k] = data
+		}
+		s[id] = aggregateState{Name: a.name, Tags: a.tags, Fields: fields}
+	}
+	return s
+}
+
+func (q *Quantile) SetState(st interface{}) error {
+	s, ok := st.(state)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", st)
+	}
+
+	q.cache = make(map[uint64]aggregate, len(s))
+	for id, a := range s {
+		fields := make(map[string]algorithm, len(a.Fields))
+		for k, data := range a.Fields {
+			algo, err := q.newAlgorithm(q.Compression)
+			if err != nil {
+				return fmt.Errorf("creating algorithm for field %s failed: %w", k, err)
+			}
+			if err := unmarshalAlgorithm(algo, data); err != nil {
+				return fmt.Errorf("restoring field %s failed: %w", k, err)
+			}
+			fields[k] = algo
+		}
+		q.cache[id] = aggregate{name: a.Name, tags: a.Tags, fields: fields}
+	}
+	return nil
+}
+
 func convert(in interface{}) (float64, bool) {
 	switch v := in.(type) {
 	case float64:
@@ -1,6 +1,7 @@
 package quantile
 
 import (
+	"encoding/json"
 	"math/rand"
 	"testing"
 	"time"
@@ -670,3 +671,45 @@ func BenchmarkDefaultExactR8100Q(b *testing.B) {
 		q.Push(&acc)
 	}
 }
+
+func TestStatePersistence(t *testing.T) {
+	for _, algorithm := range []string{"t-digest", "exact R7", "exact R8"} {
+		t.Run(algorithm, func(t *testing.T) {
+			q := Quantile{
+				Compression:   100,
+				AlgorithmType: algorithm,
+				Log:           testutil.Logger{},
+			}
+			require.NoError(t, q.Init())
+
+			restored := Quantile{
+				Compression:   100,
+				AlgorithmType: algorithm,
+				Log:           testutil.Logger{},
+			}
+			require.NoError(t, restored.Init())
+
+			for i := 0; i < 50; i++ {
+				q.Add(metric.New("test", map[string]string{"foo": "bar"}, map[string]interface{}{"a": float64(i)}, time.Now()))
+			}
+
+			// Serialize and restore the state in a new instance
+			serialized, err := json.Marshal(q.GetState())
+			require.NoError(t, err)
+			var s state
+			require.NoError(t, json.Unmarshal(serialized, &s))
+			require.NoError(t, restored.SetState(s))
+
+			for i := 50; i < 100; i++ {
+				m := metric.New("test", map[string]string{"foo": "bar"}, map[string]interface{}{"a": float64(i)}, time.Now())
+				q.Add(m)
+				restored.Add(m)
+			}
+
+			var expected, actual testutil.Accumulator
+			q.Push(&expected)
+			restored.Push(&actual)
+			testutil.RequireMetricsEqual(t, expected.GetTelegrafMetrics(), actual.GetTelegrafMetrics(), testutil.IgnoreTime())
+		})
+	}
+}
@@ -0,0 +1,269 @@
+//go:generate ../../../tools/readme_config_includer/generator
+package rollup
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+type Rollup struct {
+	GroupBy     []string  `toml:"group_by"`
+	Stats       []string  `toml:"stats"`
+	Percentiles []float64 `toml:"percentiles"`
+	Counters    []string  `toml:"counters"`
+
+	counterFilter filter.Filter
+	suffixes      []string
+
+	groups map[string]*group
+	series map[uint64]*series
+}
+
+// group is the set of series aggregated into one output metric
+type group struct {
+	name string
+	tags map[string]string
+}
+
+// series keeps the latest values of a single series within the period
+type series struct {
+	group   string
+	updated bool
+
+	// Latest value of gauge fields or rate of counter fields in this period
+	values map[string]float64
+
+	// Last sample of counter fields, kept across periods to compute rates
+	counters map[string]sample
+}
+
+type sample struct {
+	value float64
+	ts    time.Time
+}
+
+func (*Rollup) SampleConfig() string {
+	return sampleConfig
+}
+
+func (r *Rollup) Init() error {
+	if len(r.Stats) == 0 {
+		r.Stats = []string{"sum", "mean", "min", "max", "count"}
+	}
+	for _, s := range r.Stats {
+		switch s {
+		case "sum", "mean", "min", "max", "count", "percentile":
+		default:
+			return fmt.Errorf("invalid statistic %q", s)
+		}
+	}
+
+	if slices.Contains(r.Stats, "percentile") {
+		if len(r.Percentiles) == 0 {
+			r.Percentiles = []float64{50.0, 95.0, 99.0}
+		}
+		r.suffixes = make([]string, 0, len(r.Percentiles))
+		for _, p := range r.Percentiles {
+			if p < 0.0 || p > 100.0 {
+				return fmt.Errorf("percentile %v out of range", p)
+			}
+			r.suffixes = append(r.suffixes, "_p"+strconv.FormatFloat(p, 'f', -1, 64))
+		}
+	}
+
+	f, err := filter.Compile(r.Counters)
+	if err != nil {
+		return fmt.Errorf("creating counter filter failed: %w", err)
+	}
+	r.counterFilter = f
+
+	r.GroupBy = slices.Clone(r.GroupBy)
+	sort.Strings(r.GroupBy)
+
+	r.groups = make(map[string]*group)
+	r.series = make(map[uint64]*series)
+
+	return nil
+}
+
+func (r *Rollup) Add(in telegraf.Metric) {
+	id := in.HashID()
+	s, found := r.series[id]
+	if !found {
+		s = &series{
+			group:    r.groupOf(in),
+			values:   make(map[string]float64),
+			counters: make(map[string]sample),
+		}
+		r.series[id] = s
+	}
+	s.updated = true
+
+	counter := in.Type() == telegraf.Counter
+	for _, field := range in.FieldList() {
+		v, ok := convert(field.Value)
+		if !ok {
+			continue
+		}
+		if !counter && (r.counterFilter == nil || !r.counterFilter.Match(field.Key)) {
+			s.values[field.Key] = v
+			continue
+		}
+
+		// Convert counters to a per-second rate, skipping counter resets
+		current := sample{value: v, ts: in.Time()}
+		if last, found := s.counters[field.Key]; found && current.ts.After(last.ts) && current.value >= last.value {
+			s.values[field.Key] = (current.value - last.value) / current.ts.Sub(last.ts).Seconds()
+		}
+		s.counters[field.Key] = current
+	}
+}
+
+// groupOf returns the key of the group the metric belongs to and registers
+// the group if not known yet
+func (r *Rollup) groupOf(in telegraf.Metric) string {
+	tags := make(map[string]string, len(r.GroupBy))
+	var key strings.Builder
+	key.WriteString(in.Name())
+	for _, name := range r.GroupBy {
+		if v, found := in.GetTag(name); found {
+			tags[name] = v
+			key.WriteString("\x00" + name + "=" + v)
+		}
+	}
+
+	k := key.String()
+	if _, found := r.groups[k]; !found {
+		r.groups[k] = &group{name: in.Name(), tags: tags}
+	}
+	return k
+}
+
+func (r *Rollup) Push(acc telegraf.Accumulator) {
+	// Collect the values of all series per group and field
+	values := make(map[string]map[string][]float64, len(r.groups))
+	for _, s := range r.series {
+		if !s.updated {
+			continue
+		}
+		if values[s.group] == nil {
+			values[s.group] = make(map[string][]float64)
+		}
+		for k, v := range s.values {
+			values[s.group][k] = append(values[s.group][k], v)
+		}
+	}
+
+	for key, fieldValues := range values {
+		fields := make(map[string]interface{}, len(fieldValues)*len(r.Stats))
+		for k, v := range fieldValues {
+			r.addStats(fields, k, v)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		g := r.groups[key]
+		acc.AddFields(g.name, fields, g.tags)
+	}
+}
+
+// addStats computes the configured statistics of the values and adds them to
+// the fields with the statistic as suffix of the field name
+func (r *Rollup) addStats(fields map[string]interface{}, name string, values []float64) {
+	var sum float64
+	minimum, maximum := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		sum += v
+		minimum = math.Min(minimum, v)
+		maximum = math.Max(maximum, v)
+	}
+
+	for _, stat := range r.Stats {
+		switch stat {
+		case "sum":
+			fields[name+"_sum"] = sum
+		case "mean":
+			fields[name+"_mean"] = sum / float64(len(values))
+		case "min":
+			fields[name+"_min"] = minimum
+		case "max":
+			fields[name+"_max"] = maximum
+		case "count":
+			fields[name+"_count"] = int64(len(values))
+		case "percentile":
+			sorted := slices.Clone(values)
+			sort.Float64s(sorted)
+			for i, p := range r.Percentiles {
+				fields[name+r.suffixes[i]] = percentile(sorted, p)
+			}
+		}
+	}
+}
+
+func (r *Rollup) Reset() {
+	// Forget about series not seen in this period but keep the last counter
+	// samples of active series to compute rates in the next period
+	for id, s := range r.series {
+		if !s.updated {
+			delete(r.series, id)
+			continue
+		}
+		s.updated = false
+		s.values = make(map[string]float64)
+	}
+
+	// Remove groups without any series
+	active := make(map[string]bool, len(r.groups))
+	for _, s := range r.series {
+		active[s.group] = true
+	}
+	for k := range r.groups {
+		if !active[k] {
+			delete(r.groups, k)
+		}
+	}
+}
+
+// percentile computes the given percentile of the sorted values using linear
+// interpolation between the closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100.0 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("rollup", func() telegraf.Aggregator {
+		return &Rollup{}
+	})
+}
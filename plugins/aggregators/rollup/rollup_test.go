@@ -0,0 +1,223 @@
+package rollup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestInitInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *Rollup
+		expected string
+	}{
+		{
+			name:     "unknown statistic",
+			plugin:   &Rollup{Stats: []string{"median"}},
+			expected: `invalid statistic "median"`,
+		},
+		{
+			name:     "percentile out of range",
+			plugin:   &Rollup{Stats: []string{"percentile"}, Percentiles: []float64{101}},
+			expected: "percentile 101 out of range",
+		},
+		{
+			name:     "invalid counter pattern",
+			plugin:   &Rollup{Counters: []string{"a[b"}},
+			expected: "creating counter filter failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorContains(t, tt.plugin.Init(), tt.expected)
+		})
+	}
+}
+
+func TestGauges(t *testing.T) {
+	plugin := &Rollup{
+		GroupBy: []string{"cluster"},
+		Stats:   []string{"sum", "mean", "min", "max", "count", "percentile"},
+	}
+	require.NoError(t, plugin.Init())
+
+	now := time.Now()
+	input := []telegraf.Metric{
+		metric.New("cpu", map[string]string{"cluster": "eu", "host": "a"}, map[string]interface{}{"usage": 50.0}, now),
+		// Only the latest value of a series in the period counts
+		metric.New("cpu", map[string]string{"cluster": "eu", "host": "a"}, map[string]interface{}{"usage": 10.0}, now),
+		metric.New("cpu", map[string]string{"cluster": "eu", "host": "b"}, map[string]interface{}{"usage": int64(20)}, now),
+		metric.New("cpu", map[string]string{"cluster": "eu", "host": "c"}, map[string]interface{}{"usage": uint64(60)}, now),
+		metric.New("cpu", map[string]string{"cluster": "us", "host": "d"}, map[string]interface{}{"usage": 5.0}, now),
+		metric.New("cpu", map[string]string{"cluster": "us", "host": "e"}, map[string]interface{}{"usage": "high"}, now),
+		metric.New("mem", map[string]string{"host": "d"}, map[string]interface{}{"used": 1.0}, now),
+		metric.New("mem", map[string]string{"host": "e"}, map[string]interface{}{"used": 3.0}, now),
+	}
+	for _, m := range input {
+		plugin.Add(m)
+	}
+
+	expected := []telegraf.Metric{
+		metric.New(
+			"cpu",
+			map[string]string{"cluster": "eu"},
+			map[string]interface{}{
+				"usage_sum":   90.0,
+				"usage_mean":  30.0,
+				"usage_min":   10.0,
+				"usage_max":   60.0,
+				"usage_count": int64(3),
+				"usage_p50":   20.0,
+				"usage_p95":   56.0,
+				"usage_p99":   59.2,
+			},
+			time.Unix(0, 0),
+		),
+		metric.New(
+			"cpu",
+			map[string]string{"cluster": "us"},
+			map[string]interface{}{
+				"usage_sum":   5.0,
+				"usage_mean":  5.0,
+				"usage_min":   5.0,
+				"usage_max":   5.0,
+				"usage_count": int64(1),
+				"usage_p50":   5.0,
+				"usage_p95":   5.0,
+				"usage_p99":   5.0,
+			},
+			time.Unix(0, 0),
+		),
+		metric.New(
+			"mem",
+			map[string]string{},
+			map[string]interface{}{
+				"used_sum":   4.0,
+				"used_mean":  2.0,
+				"used_min":   1.0,
+				"used_max":   3.0,
+				"used_count": int64(2),
+				"used_p50":   2.0,
+				"used_p95":   2.9,
+				"used_p99":   2.98,
+			},
+			time.Unix(0, 0),
+		),
+	}
+
+	var acc testutil.Accumulator
+	plugin.Push(&acc)
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime(), testutil.SortMetrics(), cmpopts.EquateApprox(0, 1e-9))
+}
+
+func TestCounters(t *testing.T) {
+	plugin := &Rollup{
+		GroupBy:  []string{"cluster"},
+		Stats:    []string{"sum", "max"},
+		Counters: []string{"requests"},
+	}
+	require.NoError(t, plugin.Init())
+
+	start := time.Unix(1700000000, 0)
+	tags1 := map[string]string{"cluster": "eu", "host": "web01"}
+	tags2 := map[string]string{"cluster": "eu", "host": "web02"}
+
+	// A single sample does not allow to compute a rate
+	var acc testutil.Accumulator
+	plugin.Add(metric.New("nginx", tags1, map[string]interface{}{"requests": int64(1000), "active": int64(3)}, start))
+	plugin.Add(metric.New("nginx", tags2, map[string]interface{}{"requests": int64(2000), "active": int64(4)}, start))
+	plugin.Push(&acc)
+	plugin.Reset()
+	expected := []telegraf.Metric{
+		metric.New(
+			"nginx",
+			map[string]string{"cluster": "eu"},
+			map[string]interface{}{"active_sum": 7.0, "active_max": 4.0},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+
+	// Rates are computed from the samples of the previous period
+	acc.ClearMetrics()
+	plugin.Add(metric.New("nginx", tags1, map[string]interface{}{"requests": int64(1300), "active": int64(1)}, start.Add(10*time.Second)))
+	plugin.Add(metric.New("nginx", tags2, map[string]interface{}{"requests": int64(2500), "active": int64(2)}, start.Add(10*time.Second)))
+	plugin.Push(&acc)
+	plugin.Reset()
+	expected = []telegraf.Metric{
+		metric.New(
+			"nginx",
+			map[string]string{"cluster": "eu"},
+			map[string]interface{}{"active_sum": 3.0, "active_max": 2.0, "requests_sum": 80.0, "requests_max": 50.0},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+
+	// Counter resets are skipped
+	acc.ClearMetrics()
+	plugin.Add(metric.New("nginx", tags1, map[string]interface{}{"requests": int64(10), "active": int64(1)}, start.Add(20*time.Second)))
+	plugin.Add(metric.New("nginx", tags2, map[string]interface{}{"requests": int64(2600), "active": int64(2)}, start.Add(20*time.Second)))
+	plugin.Push(&acc)
+	plugin.Reset()
+	expected = []telegraf.Metric{
+		metric.New(
+			"nginx",
+			map[string]string{"cluster": "eu"},
+			map[string]interface{}{"active_sum": 3.0, "active_max": 2.0, "requests_sum": 10.0, "requests_max": 10.0},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
+
+func TestCounterValueType(t *testing.T) {
+	plugin := &Rollup{Stats: []string{"sum"}}
+	require.NoError(t, plugin.Init())
+
+	start := time.Unix(1700000000, 0)
+	plugin.Add(metric.New("http", map[string]string{"host": "a"}, map[string]interface{}{"requests": 100.0}, start, telegraf.Counter))
+	plugin.Add(metric.New("http", map[string]string{"host": "b"}, map[string]interface{}{"requests": 100.0}, start, telegraf.Counter))
+	plugin.Add(metric.New("http", map[string]string{"host": "a"}, map[string]interface{}{"requests": 200.0}, start.Add(10*time.Second), telegraf.Counter))
+	plugin.Add(metric.New("http", map[string]string{"host": "b"}, map[string]interface{}{"requests": 150.0}, start.Add(5*time.Second), telegraf.Counter))
+
+	expected := []telegraf.Metric{
+		metric.New("http", map[string]string{}, map[string]interface{}{"requests_sum": 20.0}, time.Unix(0, 0)),
+	}
+
+	var acc testutil.Accumulator
+	plugin.Push(&acc)
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
+
+func TestExpireSeries(t *testing.T) {
+	plugin := &Rollup{Stats: []string{"count"}}
+	require.NoError(t, plugin.Init())
+
+	now := time.Now()
+	plugin.Add(metric.New("cpu", map[string]string{"host": "a"}, map[string]interface{}{"usage": 1.0}, now))
+	plugin.Add(metric.New("cpu", map[string]string{"host": "b"}, map[string]interface{}{"usage": 1.0}, now))
+	plugin.Add(metric.New("mem", map[string]string{"host": "b"}, map[string]interface{}{"used": 1.0}, now))
+	plugin.Push(&testutil.Accumulator{})
+	plugin.Reset()
+
+	// Series not updated within the last period are not aggregated
+	plugin.Add(metric.New("cpu", map[string]string{"host": "a"}, map[string]interface{}{"usage": 1.0}, now))
+	expected := []telegraf.Metric{
+		metric.New("cpu", map[string]string{}, map[string]interface{}{"usage_count": int64(1)}, time.Unix(0, 0)),
+	}
+	var acc testutil.Accumulator
+	plugin.Push(&acc)
+	plugin.Reset()
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+	require.Len(t, plugin.series, 1)
+	require.Len(t, plugin.groups, 1)
+}
@@ -197,7 +197,23 @@ func (t *Tail) getSeekInfo(file string) (*tail.SeekInfo, error) {
 }
 
 func (t *Tail) GetState() interface{} {
-	return t.offsets
+	t.tailersMutex.RLock()
+	defer t.tailersMutex.RUnlock()
+
+	// Include the current offsets of the active tailers as the state might
+	// be checkpointed while running
+	state := make(map[string]int64, len(t.offsets)+len(t.tailers))
+	for k, v := range t.offsets {
+		state[k] = v
+	}
+	if !t.Pipe {
+		for _, tailer := range t.tailers {
+			if offset, err := tailer.Tell(); err == nil {
+				state[tailer.Filename] = offset
+			}
+		}
+	}
+	return state
 }
 
 func (t *Tail) SetState(state interface{}) error {
@@ -0,0 +1,5 @@
+//go:build !custom || processors || processors.series_limit
+
+package all
+
+import _ "github.com/influxdata/telegraf/plugins/processors/series_limit" // register plugin
@@ -0,0 +1,5 @@
+//go:build !custom || processors || processors.threshold
+
+package all
+
+import _ "github.com/influxdata/telegraf/plugins/processors/threshold" // register plugin
@@ -0,0 +1,316 @@
+//go:generate ../../../tools/readme_config_includer/generator
+package anomaly
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+var timeNow = time.Now
+
+type Anomaly struct {
+	Fields           []string        `toml:"fields"`
+	Baseline         string          `toml:"baseline"`
+	Alpha            float64         `toml:"alpha"`
+	WindowSize       int             `toml:"window_size"`
+	MinSamples       int64           `toml:"min_samples"`
+	MinStddev        float64         `toml:"min_stddev"`
+	Threshold        float64         `toml:"threshold"`
+	Events           bool            `toml:"events"`
+	EventMeasurement string          `toml:"event_measurement"`
+	SeriesTimeout    config.Duration `toml:"series_timeout"`
+	Log              telegraf.Logger `toml:"-"`
+
+	fieldFilter filter.Filter
+	series      map[uint64]*series
+	expired     time.Time
+}
+
+// series keeps the baselines of the fields of a single series
+type series struct {
+	anomalous bool
+	baselines map[string]baseline
+	lastSeen  time.Time
+}
+
+func (*Anomaly) SampleConfig() string {
+	return sampleConfig
+}
+
+func (a *Anomaly) Init() error {
+	if len(a.Fields) == 0 {
+		return errors.New("no fields configured")
+	}
+	f, err := filter.Compile(a.Fields)
+	if err != nil {
+		return fmt.Errorf("creating field filter failed: %w", err)
+	}
+	a.fieldFilter = f
+
+	switch a.Baseline {
+	case "":
+		a.Baseline = "ewma"
+	case "ewma", "window", "seasonal":
+	default:
+		return fmt.Errorf("invalid baseline %q", a.Baseline)
+	}
+
+	if a.Alpha == 0 {
+		a.Alpha = 0.1
+	}
+	if a.Alpha < 0 || a.Alpha > 1 {
+		return fmt.Errorf("alpha %v out of range (0, 1]", a.Alpha)
+	}
+	if a.WindowSize == 0 {
+		a.WindowSize = 30
+	}
+	if a.WindowSize < 2 {
+		return errors.New("window size must be at least two")
+	}
+	if a.MinSamples == 0 {
+		a.MinSamples = 10
+	}
+	if a.Baseline == "window" && a.MinSamples > int64(a.WindowSize) {
+		return fmt.Errorf("min_samples %d exceeds window_size %d", a.MinSamples, a.WindowSize)
+	}
+	if a.MinStddev == 0 {
+		a.MinStddev = 1e-6
+	}
+	if a.MinStddev < 0 {
+		return errors.New("minimum standard deviation must be positive")
+	}
+	if a.Threshold == 0 {
+		a.Threshold = 3.0
+	}
+	if a.Threshold < 0 {
+		return errors.New("threshold must be positive")
+	}
+	if a.EventMeasurement == "" {
+		a.EventMeasurement = "anomaly"
+	}
+	if a.SeriesTimeout == 0 {
+		a.SeriesTimeout = config.Duration(24 * time.Hour)
+	}
+	if a.SeriesTimeout < 0 {
+		return errors.New("series timeout must be positive")
+	}
+
+	a.series = make(map[uint64]*series)
+	a.expired = timeNow()
+
+	return nil
+}
+
+func (a *Anomaly) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	now := timeNow()
+	a.expire(now)
+
+	out := make([]telegraf.Metric, 0, len(in))
+	for _, m := range in {
+		out = append(out, m)
+
+		id := m.HashID()
+		s, found := a.series[id]
+		if !found {
+			s = &series{baselines: make(map[string]baseline)}
+			a.series[id] = s
+		}
+		s.lastSeen = now
+
+		// Score each field against its baseline before adding the value
+		var scored bool
+		var score float64
+		var scoredField string
+		for _, field := range m.FieldList() {
+			// Skip the annotations of a previous run, e.g. for processors
+			// running again after aggregators
+			if field.Key == "anomaly_score" || !a.fieldFilter.Match(field.Key) {
+				continue
+			}
+			v, ok := convert(field.Value)
+			if !ok {
+				continue
+			}
+
+			b, found := s.baselines[field.Key]
+			if !found {
+				b = a.newBaseline()
+				s.baselines[field.Key] = b
+			}
+			if mean, stddev, ok := b.stats(m.Time(), a.MinSamples); ok {
+				z := math.Abs(v-mean) / math.Max(stddev, a.MinStddev)
+				if !scored || z > score {
+					score, scoredField = z, field.Key
+				}
+				scored = true
+			}
+			b.update(v, m.Time())
+		}
+		if !scored {
+			continue
+		}
+
+		anomalous := score > a.Threshold
+		m.AddField("anomaly_score", score)
+		m.AddField("is_anomaly", anomalous)
+
+		if a.Events && anomalous != s.anomalous {
+			tags := m.Tags()
+			tags["measurement"] = m.Name()
+			tags["field"] = scoredField
+			fields := map[string]interface{}{
+				"anomaly_score": score,
+				"is_anomaly":    anomalous,
+			}
+			out = append(out, metric.New(a.EventMeasurement, tags, fields, m.Time()))
+		}
+		s.anomalous = anomalous
+	}
+	return out
+}
+
+// expire removes the series not seen within the series timeout to limit the
+// memory usage and the size of the state. To limit the overhead, the check is
+// done at most once per tenth of the timeout.
+func (a *Anomaly) expire(now time.Time) {
+	timeout := time.Duration(a.SeriesTimeout)
+	if now.Sub(a.expired) < timeout/10 {
+		return
+	}
+	a.expired = now
+
+	for id, s := range a.series {
+		if now.Sub(s.lastSeen) > timeout {
+			delete(a.series, id)
+		}
+	}
+}
+
+func (a *Anomaly) newBaseline() baseline {
+	switch a.Baseline {
+	case "window":
+		return &movingWindow{Size: a.WindowSize}
+	case "seasonal":
+		return newSeasonal(a.Alpha)
+	}
+	return &ewma{Alpha: a.Alpha}
+}
+
+// configure applies the settings to a baseline restored from the state as
+// those are not part of the state and might have changed
+func (a *Anomaly) configure(b baseline) {
+	switch b := b.(type) {
+	case *ewma:
+		b.Alpha = a.Alpha
+	case *movingWindow:
+		b.Size = a.WindowSize
+		if len(b.Values) > b.Size {
+			b.Values = b.Values[len(b.Values)-b.Size:]
+		}
+	case *seasonal:
+		if len(b.Hours) != 24 {
+			*b = *newSeasonal(a.Alpha)
+		}
+		for i, h := range b.Hours {
+			if h == nil {
+				b.Hours[i] = &ewma{Alpha: a.Alpha}
+				continue
+			}
+			h.Alpha = a.Alpha
+		}
+	}
+}
+
+type state map[uint64]seriesState
+
+type seriesState struct {
+	Baseline  string                     `json:"baseline"`
+	Anomalous bool                       `json:"anomalous,omitempty"`
+	LastSeen  time.Time                  `json:"last_seen"`
+	Fields    map[string]json.RawMessage `json:"fields"`
+}
+
+func (a *Anomaly) GetState() interface{} {
+	st := make(state, len(a.series))
+	for id, s := range a.series {
+		fields := make(map[string]json.RawMessage, len(s.baselines))
+		for k, b := range s.baselines {
+			buf, err := json.Marshal(b)
+			if err != nil {
+				a.Log.Errorf("Serializing baseline of field %q failed: %v", k, err)
+				continue
+			}
+			fields[k] = buf
+		}
+		st[id] = seriesState{Baseline: a.Baseline, Anomalous: s.anomalous, LastSeen: s.lastSeen, Fields: fields}
+	}
+	return st
+}
+
+func (a *Anomaly) SetState(st interface{}) error {
+	s, ok := st.(state)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", st)
+	}
+
+	now := timeNow()
+	a.series = make(map[uint64]*series, len(s))
+	for id, ss := range s {
+		// Start from scratch if the baseline type changed
+		if ss.Baseline != a.Baseline {
+			continue
+		}
+		// Series of states without the last-seen time expire after the
+		// timeout starting now
+		lastSeen := ss.LastSeen
+		if lastSeen.IsZero() {
+			lastSeen = now
+		}
+		if now.Sub(lastSeen) > time.Duration(a.SeriesTimeout) {
+			continue
+		}
+		restored := &series{anomalous: ss.Anomalous, baselines: make(map[string]baseline, len(ss.Fields)), lastSeen: lastSeen}
+		for k, buf := range ss.Fields {
+			b := a.newBaseline()
+			if err := json.Unmarshal(buf, b); err != nil {
+				return fmt.Errorf("decoding baseline of field %q failed: %w", k, err)
+			}
+			a.configure(b)
+			restored.baselines[k] = b
+		}
+		a.series[id] = restored
+	}
+	return nil
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	processors.Add("anomaly", func() telegraf.Processor {
+		return &Anomaly{}
+	})
+}
@@ -0,0 +1,276 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func latency(v float64, ts time.Time) telegraf.Metric {
+	return metric.New("http", map[string]string{"host": "web01"}, map[string]interface{}{"latency": v, "status": "ok"}, ts)
+}
+
+// train feeds values alternating around 10 with a standard deviation of one
+func train(plugin *Anomaly, n int, ts time.Time) {
+	for i := range n {
+		v := 9.0
+		if i%2 == 0 {
+			v = 11.0
+		}
+		plugin.Apply(latency(v, ts))
+	}
+}
+
+func TestInitInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *Anomaly
+		expected string
+	}{
+		{
+			name:     "no fields",
+			plugin:   &Anomaly{},
+			expected: "no fields configured",
+		},
+		{
+			name:     "invalid baseline",
+			plugin:   &Anomaly{Fields: []string{"*"}, Baseline: "median"},
+			expected: `invalid baseline "median"`,
+		},
+		{
+			name:     "alpha out of range",
+			plugin:   &Anomaly{Fields: []string{"*"}, Alpha: 1.5},
+			expected: "alpha 1.5 out of range",
+		},
+		{
+			name:     "min samples exceed window",
+			plugin:   &Anomaly{Fields: []string{"*"}, Baseline: "window", WindowSize: 5},
+			expected: "min_samples 10 exceeds window_size 5",
+		},
+		{
+			name:     "window too small",
+			plugin:   &Anomaly{Fields: []string{"*"}, Baseline: "window", WindowSize: 1},
+			expected: "window size must be at least two",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorContains(t, tt.plugin.Init(), tt.expected)
+		})
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	plugin := &Anomaly{Fields: []string{"latency"}, MinSamples: 3}
+	require.NoError(t, plugin.Init())
+
+	ts := time.Unix(1700000000, 0)
+	for range 3 {
+		actual := plugin.Apply(latency(10, ts))
+		testutil.RequireMetricsEqual(t, []telegraf.Metric{latency(10, ts)}, actual)
+	}
+
+	actual := plugin.Apply(latency(10, ts))
+	require.Len(t, actual, 1)
+	score, found := actual[0].GetField("anomaly_score")
+	require.True(t, found)
+	require.InDelta(t, 0.0, score, 1e-9)
+	require.Equal(t, false, actual[0].Fields()["is_anomaly"])
+}
+
+func TestBaselines(t *testing.T) {
+	for _, baseline := range []string{"ewma", "window", "seasonal"} {
+		t.Run(baseline, func(t *testing.T) {
+			plugin := &Anomaly{
+				Fields:     []string{"latency"},
+				Baseline:   baseline,
+				Alpha:      0.05,
+				WindowSize: 20,
+				MinSamples: 20,
+				Log:        testutil.Logger{},
+			}
+			require.NoError(t, plugin.Init())
+
+			ts := time.Unix(1700000000, 0)
+			train(plugin, 40, ts)
+
+			// Normal values
+			actual := plugin.Apply(latency(10.5, ts))
+			require.Len(t, actual, 1)
+			require.Equal(t, false, actual[0].Fields()["is_anomaly"])
+			require.Less(t, actual[0].Fields()["anomaly_score"], 1.0)
+
+			// Spikes
+			actual = plugin.Apply(latency(50, ts))
+			require.Len(t, actual, 1)
+			require.Equal(t, true, actual[0].Fields()["is_anomaly"])
+			require.Greater(t, actual[0].Fields()["anomaly_score"], 3.0)
+		})
+	}
+}
+
+func TestSeasonal(t *testing.T) {
+	plugin := &Anomaly{
+		Fields:     []string{"latency"},
+		Baseline:   "seasonal",
+		MinSamples: 5,
+	}
+	require.NoError(t, plugin.Init())
+
+	// Low latency at night and high latency during the day
+	night := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)
+	for i := range 20 {
+		v := 9.0
+		if i%2 == 0 {
+			v = 11.0
+		}
+		plugin.Apply(latency(v, night))
+		plugin.Apply(latency(10*v, day))
+	}
+
+	actual := plugin.Apply(latency(100, day))
+	require.Equal(t, false, actual[0].Fields()["is_anomaly"])
+
+	actual = plugin.Apply(latency(100, night))
+	require.Equal(t, true, actual[0].Fields()["is_anomaly"])
+}
+
+func TestEvents(t *testing.T) {
+	plugin := &Anomaly{
+		Fields:     []string{"latency"},
+		MinSamples: 20,
+		Events:     true,
+	}
+	require.NoError(t, plugin.Init())
+
+	ts := time.Unix(1700000000, 0)
+	train(plugin, 40, ts)
+
+	// No event without a state change
+	require.Len(t, plugin.Apply(latency(10, ts)), 1)
+
+	actual := plugin.Apply(latency(50, ts))
+	require.Len(t, actual, 2)
+	event := actual[1]
+	require.Equal(t, "anomaly", event.Name())
+	require.Equal(t, map[string]string{"host": "web01", "measurement": "http", "field": "latency"}, event.Tags())
+	require.Equal(t, true, event.Fields()["is_anomaly"])
+	require.Equal(t, actual[0].Fields()["anomaly_score"], event.Fields()["anomaly_score"])
+	require.Equal(t, ts, event.Time())
+
+	// Still anomalous
+	require.Len(t, plugin.Apply(latency(200, ts)), 1)
+
+	// Back to normal
+	actual = plugin.Apply(latency(10, ts))
+	require.Len(t, actual, 2)
+	require.Equal(t, false, actual[1].Fields()["is_anomaly"])
+}
+
+func TestSkipAnnotations(t *testing.T) {
+	plugin := &Anomaly{Fields: []string{"*"}, MinSamples: 1}
+	require.NoError(t, plugin.Init())
+
+	ts := time.Unix(1700000000, 0)
+	train(plugin, 10, ts)
+
+	// Running the processor again must not score the annotation itself
+	actual := plugin.Apply(plugin.Apply(latency(10, ts))...)
+	require.Len(t, actual, 1)
+	require.NotContains(t, plugin.series[actual[0].HashID()].baselines, "anomaly_score")
+	require.NotContains(t, plugin.series[actual[0].HashID()].baselines, "status")
+}
+
+func TestState(t *testing.T) {
+	for _, baseline := range []string{"ewma", "window", "seasonal"} {
+		t.Run(baseline, func(t *testing.T) {
+			plugin := &Anomaly{Fields: []string{"latency"}, Baseline: baseline, MinSamples: 20}
+			require.NoError(t, plugin.Init())
+
+			ts := time.Unix(1700000000, 0)
+			train(plugin, 40, ts)
+			require.Equal(t, true, plugin.Apply(latency(50, ts))[0].Fields()["is_anomaly"])
+
+			// Serialize the state in the same way as the persister
+			buf, err := json.Marshal(plugin.GetState())
+			require.NoError(t, err)
+			var st state
+			require.NoError(t, json.Unmarshal(buf, &st))
+
+			restored := &Anomaly{Fields: []string{"latency"}, Baseline: baseline, MinSamples: 20}
+			require.NoError(t, restored.Init())
+			require.NoError(t, restored.SetState(st))
+
+			for _, v := range []float64{10, 60, 9} {
+				expected := plugin.Apply(latency(v, ts))
+				actual := restored.Apply(latency(v, ts))
+				testutil.RequireMetricsEqual(t, expected, actual)
+			}
+		})
+	}
+}
+
+func TestStateBaselineChanged(t *testing.T) {
+	plugin := &Anomaly{Fields: []string{"latency"}, MinSamples: 1}
+	require.NoError(t, plugin.Init())
+	train(plugin, 10, time.Unix(1700000000, 0))
+
+	restored := &Anomaly{Fields: []string{"latency"}, Baseline: "window"}
+	require.NoError(t, restored.Init())
+	st, ok := plugin.GetState().(state)
+	require.True(t, ok)
+	require.NoError(t, restored.SetState(st))
+	require.Empty(t, restored.series)
+}
+
+func TestSeriesTimeout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	plugin := &Anomaly{
+		Fields:        []string{"latency"},
+		SeriesTimeout: config.Duration(time.Hour),
+	}
+	require.NoError(t, plugin.Init())
+
+	other := metric.New("http", map[string]string{"host": "web02"}, map[string]interface{}{"latency": 10.0}, now)
+	plugin.Apply(latency(10, now), other)
+	require.Len(t, plugin.series, 2)
+
+	// Series seen within the timeout are kept
+	now = now.Add(45 * time.Minute)
+	plugin.Apply(latency(10, now))
+	require.Len(t, plugin.series, 2)
+
+	now = now.Add(30 * time.Minute)
+	plugin.Apply(latency(10, now))
+	require.Len(t, plugin.series, 1)
+	require.Contains(t, plugin.series, latency(10, now).HashID())
+
+	// Expired series are not restored from the state
+	buf, err := json.Marshal(plugin.GetState())
+	require.NoError(t, err)
+	var st state
+	require.NoError(t, json.Unmarshal(buf, &st))
+
+	now = now.Add(2 * time.Hour)
+	restored := &Anomaly{
+		Fields:        []string{"latency"},
+		SeriesTimeout: config.Duration(time.Hour),
+	}
+	require.NoError(t, restored.Init())
+	require.NoError(t, restored.SetState(st))
+	require.Empty(t, restored.series)
+}
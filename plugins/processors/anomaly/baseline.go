@@ -0,0 +1,95 @@
+package anomaly
+
+import (
+	"math"
+	"time"
+)
+
+// baseline models the expected values of a single field of a series
+type baseline interface {
+	// stats returns the expected mean and standard deviation of the value at
+	// the given time and false if not enough samples were seen yet
+	stats(t time.Time, minSamples int64) (mean, stddev float64, ok bool)
+
+	// update adds the value at the given time to the baseline
+	update(v float64, t time.Time)
+}
+
+// ewma is an exponentially weighted moving mean and variance, see Finch
+// "Incremental calculation of weighted mean and variance" (2009)
+type ewma struct {
+	Alpha    float64 `json:"-"`
+	Count    int64   `json:"count"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+}
+
+func (e *ewma) stats(_ time.Time, minSamples int64) (mean, stddev float64, ok bool) {
+	return e.Mean, math.Sqrt(e.Variance), e.Count >= minSamples
+}
+
+func (e *ewma) update(v float64, _ time.Time) {
+	e.Count++
+	if e.Count == 1 {
+		e.Mean = v
+		return
+	}
+	diff := v - e.Mean
+	incr := e.Alpha * diff
+	e.Mean += incr
+	e.Variance = (1 - e.Alpha) * (e.Variance + diff*incr)
+}
+
+// movingWindow computes the mean and standard deviation of the last values
+type movingWindow struct {
+	Size   int       `json:"-"`
+	Values []float64 `json:"values"`
+}
+
+func (w *movingWindow) stats(_ time.Time, minSamples int64) (mean, stddev float64, ok bool) {
+	n := float64(len(w.Values))
+	if n == 0 || int64(len(w.Values)) < minSamples {
+		return 0, 0, false
+	}
+
+	var sum float64
+	for _, v := range w.Values {
+		sum += v
+	}
+	mean = sum / n
+
+	var squares float64
+	for _, v := range w.Values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / n), true
+}
+
+func (w *movingWindow) update(v float64, _ time.Time) {
+	if len(w.Values) >= w.Size {
+		w.Values = append(w.Values[:0], w.Values[len(w.Values)-w.Size+1:]...)
+	}
+	w.Values = append(w.Values, v)
+}
+
+// seasonal keeps a separate EWMA baseline for each hour of the day (UTC) to
+// cope with daily patterns
+type seasonal struct {
+	Hours []*ewma `json:"hours"`
+}
+
+func newSeasonal(alpha float64) *seasonal {
+	s := &seasonal{Hours: make([]*ewma, 24)}
+	for i := range s.Hours {
+		s.Hours[i] = &ewma{Alpha: alpha}
+	}
+	return s
+}
+
+func (s *seasonal) stats(t time.Time, minSamples int64) (mean, stddev float64, ok bool) {
+	return s.Hours[t.UTC().Hour()].stats(t, minSamples)
+}
+
+func (s *seasonal) update(v float64, t time.Time) {
+	s.Hours[t.UTC().Hour()].update(v, t)
+}
@@ -0,0 +1,283 @@
+//go:generate ../../../tools/readme_config_includer/generator
+package geoip
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/oschwald/maxminddb-golang/v2"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+var timeNow = time.Now
+
+// Available attributes and whether they are added as field instead of a tag
+var attributeIsField = map[string]bool{
+	"continent_code":  false,
+	"country_code":    false,
+	"country_name":    false,
+	"region_code":     false,
+	"region":          false,
+	"city":            false,
+	"postal_code":     false,
+	"latitude":        true,
+	"longitude":       true,
+	"accuracy_radius": true,
+	"asn":             false,
+	"as_org":          false,
+}
+
+type GeoIP struct {
+	Databases      []string        `toml:"databases"`
+	Attributes     []string        `toml:"attributes"`
+	Language       string          `toml:"language"`
+	ReloadInterval config.Duration `toml:"reload_interval"`
+	CacheSize      int             `toml:"cache_size"`
+	Lookups        []lookup        `toml:"lookup"`
+	Log            telegraf.Logger `toml:"-"`
+
+	databases []*database
+	cache     *lru.Cache[string, location]
+	checked   time.Time
+}
+
+type lookup struct {
+	Tag    string `toml:"tag"`
+	Field  string `toml:"field"`
+	Prefix string `toml:"prefix"`
+}
+
+// location contains the attributes found for an address
+type location map[string]interface{}
+
+// database is an opened MMDB file along with the file information to detect
+// changes on disk
+type database struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+func (*GeoIP) SampleConfig() string {
+	return sampleConfig
+}
+
+func (g *GeoIP) Init() error {
+	if len(g.Databases) == 0 {
+		return errors.New("no databases configured")
+	}
+	for _, attr := range g.Attributes {
+		if _, found := attributeIsField[attr]; !found {
+			return fmt.Errorf("invalid attribute %q", attr)
+		}
+	}
+	if g.Language == "" {
+		g.Language = "en"
+	}
+	if g.ReloadInterval < 0 {
+		return errors.New("reload interval must not be negative")
+	}
+	if g.CacheSize <= 0 {
+		return errors.New("cache size must be positive")
+	}
+
+	if len(g.Lookups) == 0 {
+		return errors.New("no lookups configured")
+	}
+	prefixes := make(map[string]bool, len(g.Lookups))
+	for i, l := range g.Lookups {
+		if (l.Tag == "") == (l.Field == "") {
+			return fmt.Errorf("lookup %d: exactly one of 'tag' or 'field' must be set", i+1)
+		}
+		if prefixes[l.Prefix] {
+			return fmt.Errorf("lookup %d: duplicate prefix %q", i+1, l.Prefix)
+		}
+		prefixes[l.Prefix] = true
+	}
+
+	cache, err := lru.New[string, location](g.CacheSize)
+	if err != nil {
+		return fmt.Errorf("creating cache failed: %w", err)
+	}
+	g.cache = cache
+
+	return nil
+}
+
+func (g *GeoIP) Start(telegraf.Accumulator) error {
+	g.databases = make([]*database, 0, len(g.Databases))
+	for _, path := range g.Databases {
+		db, err := openDatabase(path)
+		if err != nil {
+			g.Stop()
+			return err
+		}
+		g.databases = append(g.databases, db)
+	}
+	g.checked = timeNow()
+
+	return nil
+}
+
+func (g *GeoIP) Add(m telegraf.Metric, acc telegraf.Accumulator) error {
+	if g.ReloadInterval > 0 {
+		if now := timeNow(); now.Sub(g.checked) >= time.Duration(g.ReloadInterval) {
+			g.checked = now
+			g.reload()
+		}
+	}
+
+	for _, l := range g.Lookups {
+		var address string
+		if l.Tag != "" {
+			address, _ = m.GetTag(l.Tag)
+		} else if v, found := m.GetField(l.Field); found {
+			address, _ = v.(string)
+		}
+		if address == "" {
+			continue
+		}
+
+		loc, err := g.locate(address)
+		if err != nil {
+			g.Log.Debugf("Looking up address %q failed: %v", address, err)
+			continue
+		}
+		for _, attr := range g.Attributes {
+			v, found := loc[attr]
+			if !found {
+				continue
+			}
+			if attributeIsField[attr] {
+				m.AddField(l.Prefix+attr, v)
+			} else {
+				m.AddTag(l.Prefix+attr, v.(string))
+			}
+		}
+	}
+	acc.AddMetric(m)
+
+	return nil
+}
+
+func (g *GeoIP) Stop() {
+	for _, db := range g.databases {
+		if err := db.reader.Close(); err != nil {
+			g.Log.Errorf("Closing database %q failed: %v", db.path, err)
+		}
+	}
+	g.databases = nil
+}
+
+// locate returns the attributes for the address using the cache if possible.
+// For attributes contained in multiple databases the first database wins.
+func (g *GeoIP) locate(address string) (location, error) {
+	if loc, found := g.cache.Get(address); found {
+		return loc, nil
+	}
+
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	addr = addr.Unmap()
+
+	loc := make(location)
+	for _, db := range g.databases {
+		if addr.Is6() && db.reader.Metadata.IPVersion == 4 {
+			continue
+		}
+		result := db.reader.Lookup(addr)
+		if err := result.Err(); err != nil {
+			return nil, fmt.Errorf("searching database %q failed: %w", db.path, err)
+		}
+		if !result.Found() {
+			continue
+		}
+		var r record
+		if err := result.Decode(&r); err != nil {
+			return nil, fmt.Errorf("decoding record of database %q failed: %w", db.path, err)
+		}
+		for k, v := range r.attributes(g.Language) {
+			if _, found := loc[k]; !found {
+				loc[k] = v
+			}
+		}
+	}
+	g.cache.Add(address, loc)
+
+	return loc, nil
+}
+
+// reload reopens databases changed on disk, a database failing to open is
+// kept in its previous version and retried on the next check
+func (g *GeoIP) reload() {
+	var changed bool
+	for _, db := range g.databases {
+		stat, err := os.Stat(db.path)
+		if err != nil {
+			g.Log.Errorf("Checking database %q failed: %v", db.path, err)
+			continue
+		}
+		if stat.ModTime().Equal(db.modTime) && stat.Size() == db.size {
+			continue
+		}
+
+		reader, err := maxminddb.Open(db.path)
+		if err != nil {
+			g.Log.Errorf("Reloading database %q failed, keeping previous version: %v", db.path, err)
+			continue
+		}
+		if err := db.reader.Close(); err != nil {
+			g.Log.Errorf("Closing previous version of database %q failed: %v", db.path, err)
+		}
+		db.reader = reader
+		db.modTime = stat.ModTime()
+		db.size = stat.Size()
+		changed = true
+		g.Log.Infof("Reloaded database %q built at %v", db.path, reader.Metadata.BuildTime())
+	}
+
+	if changed {
+		g.cache.Purge()
+	}
+}
+
+func openDatabase(path string) (*database, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("checking database failed: %w", err)
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening database %q failed: %w", path, err)
+	}
+	return &database{
+		path:    path,
+		reader:  reader,
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+	}, nil
+}
+
+func init() {
+	processors.AddStreaming("geoip", func() telegraf.StreamingProcessor {
+		return &GeoIP{
+			Attributes:     []string{"country_code", "city", "latitude", "longitude", "asn", "as_org"},
+			ReloadInterval: config.Duration(time.Minute),
+			CacheSize:      1000,
+		}
+	})
+}
@@ -0,0 +1,240 @@
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func flow(src, dst string) telegraf.Metric {
+	return metric.New(
+		"netflow",
+		map[string]string{"src": src, "dst": dst},
+		map[string]interface{}{"in_bytes": 1024},
+		time.Unix(0, 0),
+	)
+}
+
+func process(t *testing.T, plugin *GeoIP, metrics ...telegraf.Metric) []telegraf.Metric {
+	t.Helper()
+
+	var acc testutil.Accumulator
+	for _, m := range metrics {
+		require.NoError(t, plugin.Add(m, &acc))
+	}
+	return acc.GetTelegrafMetrics()
+}
+
+func TestInitInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *GeoIP
+		expected string
+	}{
+		{
+			name:     "no databases",
+			plugin:   &GeoIP{CacheSize: 10},
+			expected: "no databases configured",
+		},
+		{
+			name: "invalid attribute",
+			plugin: &GeoIP{
+				Databases:  []string{"testdata/city.mmdb"},
+				Attributes: []string{"planet"},
+				CacheSize:  10,
+			},
+			expected: `invalid attribute "planet"`,
+		},
+		{
+			name:     "no lookups",
+			plugin:   &GeoIP{Databases: []string{"testdata/city.mmdb"}, CacheSize: 10},
+			expected: "no lookups configured",
+		},
+		{
+			name: "tag and field",
+			plugin: &GeoIP{
+				Databases: []string{"testdata/city.mmdb"},
+				CacheSize: 10,
+				Lookups:   []lookup{{Tag: "src", Field: "src"}},
+			},
+			expected: "lookup 1: exactly one of 'tag' or 'field' must be set",
+		},
+		{
+			name: "duplicate prefix",
+			plugin: &GeoIP{
+				Databases: []string{"testdata/city.mmdb"},
+				CacheSize: 10,
+				Lookups:   []lookup{{Tag: "src"}, {Tag: "dst"}},
+			},
+			expected: `lookup 2: duplicate prefix ""`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorContains(t, tt.plugin.Init(), tt.expected)
+		})
+	}
+}
+
+func TestStartMissingDatabase(t *testing.T) {
+	plugin := &GeoIP{
+		Databases: []string{"testdata/city.mmdb", "testdata/missing.mmdb"},
+		CacheSize: 10,
+		Lookups:   []lookup{{Tag: "src"}},
+		Log:       testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	require.ErrorContains(t, plugin.Start(nil), "checking database failed")
+	require.Empty(t, plugin.databases)
+}
+
+func TestLookup(t *testing.T) {
+	plugin := &GeoIP{
+		Databases: []string{"testdata/city.mmdb", "testdata/asn.mmdb"},
+		Attributes: []string{
+			"continent_code", "country_code", "country_name", "region_code", "region", "city",
+			"postal_code", "latitude", "longitude", "accuracy_radius", "asn", "as_org",
+		},
+		Language:  "de",
+		CacheSize: 10,
+		Lookups: []lookup{
+			{Tag: "src", Prefix: "src_"},
+			{Tag: "dst", Prefix: "dst_"},
+		},
+		Log: testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	require.NoError(t, plugin.Start(nil))
+	defer plugin.Stop()
+
+	input := []telegraf.Metric{
+		flow("81.2.69.160", "2003:de::1"),
+		flow("::ffff:1.128.0.1", "10.0.0.1"),
+		flow("invalid", "192.0.2.1"),
+	}
+	expected := []telegraf.Metric{
+		metric.New(
+			"netflow",
+			map[string]string{
+				"src":                "81.2.69.160",
+				"src_continent_code": "EU",
+				"src_country_code":   "GB",
+				"src_country_name":   "Vereinigtes Königreich",
+				"src_region_code":    "ENG",
+				"src_region":         "England",
+				"src_city":           "London",
+				"src_postal_code":    "SW1A",
+				"src_asn":            "20712",
+				"src_as_org":         "Andrews & Arnold Ltd",
+				"dst":                "2003:de::1",
+				"dst_continent_code": "EU",
+				"dst_country_code":   "DE",
+				"dst_country_name":   "Deutschland",
+			},
+			map[string]interface{}{
+				"in_bytes":            1024,
+				"src_latitude":        51.5142,
+				"src_longitude":       -0.0931,
+				"src_accuracy_radius": int64(10),
+				"dst_latitude":        51.2993,
+				"dst_longitude":       9.491,
+			},
+			time.Unix(0, 0),
+		),
+		metric.New(
+			"netflow",
+			map[string]string{
+				"src":        "::ffff:1.128.0.1",
+				"src_asn":    "1221",
+				"src_as_org": "Telstra Pty Ltd",
+				"dst":        "10.0.0.1",
+			},
+			map[string]interface{}{"in_bytes": 1024},
+			time.Unix(0, 0),
+		),
+		flow("invalid", "192.0.2.1"),
+	}
+	testutil.RequireMetricsEqual(t, expected, process(t, plugin, input...))
+}
+
+func TestLookupField(t *testing.T) {
+	plugin := &GeoIP{
+		Databases:  []string{"testdata/city.mmdb"},
+		Attributes: []string{"country_code", "latitude", "longitude"},
+		CacheSize:  10,
+		Lookups:    []lookup{{Field: "client_ip"}},
+		Log:        testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	require.NoError(t, plugin.Start(nil))
+	defer plugin.Stop()
+
+	input := metric.New("nginx", map[string]string{}, map[string]interface{}{"client_ip": "81.2.69.1"}, time.Unix(0, 0))
+	expected := metric.New(
+		"nginx",
+		map[string]string{"country_code": "GB"},
+		map[string]interface{}{"client_ip": "81.2.69.1", "latitude": 51.5142, "longitude": -0.0931},
+		time.Unix(0, 0),
+	)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{expected}, process(t, plugin, input))
+}
+
+func TestReload(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	// Use a copy of the database to be able to replace it
+	buf, err := os.ReadFile("testdata/city.mmdb")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	require.NoError(t, os.WriteFile(path, buf, 0o600))
+
+	plugin := &GeoIP{
+		Databases:      []string{path},
+		Attributes:     []string{"city"},
+		ReloadInterval: config.Duration(time.Minute),
+		CacheSize:      10,
+		Lookups:        []lookup{{Tag: "src"}},
+		Log:            testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	require.NoError(t, plugin.Start(nil))
+	defer plugin.Stop()
+
+	city := func() string {
+		actual := process(t, plugin, flow("81.2.69.160", "10.0.0.1"))
+		require.Len(t, actual, 1)
+		c, _ := actual[0].GetTag("city")
+		return c
+	}
+	require.Equal(t, "London", city())
+
+	// Replace the database atomically in the same way as the update tools
+	buf, err = os.ReadFile("testdata/city_updated.mmdb")
+	require.NoError(t, err)
+	tmpfile := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmpfile, buf, 0o600))
+	require.NoError(t, os.Rename(tmpfile, path))
+
+	// The cached result is used until the database is checked
+	require.Equal(t, "London", city())
+	now = now.Add(time.Minute)
+	require.Equal(t, "Manchester", city())
+
+	// A corrupt database keeps the previous version
+	require.NoError(t, os.WriteFile(path, []byte("corrupt"), 0o600))
+	now = now.Add(time.Minute)
+	require.Equal(t, "Manchester", city())
+}
@@ -0,0 +1,72 @@
+package geoip
+
+import "strconv"
+
+// record contains the data of the GeoIP2/GeoLite2 City, Country and ASN
+// databases, data not contained in a database is left empty
+type record struct {
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Location struct {
+		Latitude       *float64 `maxminddb:"latitude"`
+		Longitude      *float64 `maxminddb:"longitude"`
+		AccuracyRadius uint16   `maxminddb:"accuracy_radius"`
+	} `maxminddb:"location"`
+	ASN   uint32 `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// attributes returns the non-empty attributes of the record using the names
+// in the given language or English if not available
+func (r *record) attributes(language string) location {
+	loc := make(location)
+	add := func(attr, value string) {
+		if value != "" {
+			loc[attr] = value
+		}
+	}
+	name := func(names map[string]string) string {
+		if n, found := names[language]; found {
+			return n
+		}
+		return names["en"]
+	}
+
+	add("continent_code", r.Continent.Code)
+	add("country_code", r.Country.ISOCode)
+	add("country_name", name(r.Country.Names))
+	if len(r.Subdivisions) > 0 {
+		add("region_code", r.Subdivisions[0].ISOCode)
+		add("region", name(r.Subdivisions[0].Names))
+	}
+	add("city", name(r.City.Names))
+	add("postal_code", r.Postal.Code)
+	if r.Location.Latitude != nil && r.Location.Longitude != nil {
+		loc["latitude"] = *r.Location.Latitude
+		loc["longitude"] = *r.Location.Longitude
+	}
+	if r.Location.AccuracyRadius > 0 {
+		loc["accuracy_radius"] = int64(r.Location.AccuracyRadius)
+	}
+	if r.ASN > 0 {
+		loc["asn"] = strconv.FormatUint(uint64(r.ASN), 10)
+	}
+	add("as_org", r.ASOrg)
+
+	return loc
+}
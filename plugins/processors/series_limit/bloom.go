@@ -0,0 +1,46 @@
+package series_limit
+
+import "math"
+
+// Number of hash functions of the bloom filter resulting in a false-positive
+// rate of about 1% at the capacity of the filter
+const bloomHashes = 7
+
+// bloomFilter tests if a series was seen before with a small false-positive
+// rate, i.e. unknown series might be reported as seen
+type bloomFilter struct {
+	bits []uint64
+	size uint64
+}
+
+// newBloomFilter returns a filter sized for the given number of elements
+func newBloomFilter(capacity int) *bloomFilter {
+	size := uint64(math.Ceil(float64(capacity) * 9.6))
+	size = max(64, (size+63)&^63)
+	return &bloomFilter{bits: make([]uint64, size/64), size: size}
+}
+
+// locations returns the bit positions of the mixed hash using double hashing
+func (b *bloomFilter) locations(hash uint64) [bloomHashes]uint64 {
+	h1, h2 := hash&0xffffffff, hash>>32|1
+	var locs [bloomHashes]uint64
+	for i := range locs {
+		locs[i] = (h1 + uint64(i)*h2) % b.size
+	}
+	return locs
+}
+
+func (b *bloomFilter) add(hash uint64) {
+	for _, loc := range b.locations(hash) {
+		b.bits[loc/64] |= 1 << (loc % 64)
+	}
+}
+
+func (b *bloomFilter) contains(hash uint64) bool {
+	for _, loc := range b.locations(hash) {
+		if b.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package series_limit
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Number of index bits of the HyperLogLog sketch resulting in a standard
+// error of about 1.6% using 4 kB of registers
+const hllPrecision = 12
+
+const hllRegisters = 1 << hllPrecision
+
+// hyperLogLog estimates the number of distinct elements in constant memory,
+// see Flajolet et al. "HyperLogLog: the analysis of a near-optimal
+// cardinality estimation algorithm" (2007)
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+
+	// Sum of 2^-register and number of zero registers maintained on update
+	// to compute the estimate without iterating the registers
+	sum   float64
+	zeros int
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{sum: hllRegisters, zeros: hllRegisters}
+}
+
+// mix distributes the bits of the hash as the metric hash is not uniformly
+// distributed
+func mix(hash uint64) uint64 {
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
+
+// position returns the register index and value for the given mixed hash
+func position(hash uint64) (uint64, uint8) {
+	idx := hash >> (64 - hllPrecision)
+	rho := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	return idx, rho
+}
+
+func (h *hyperLogLog) set(idx uint64, rho uint8) {
+	current := h.registers[idx]
+	if rho <= current {
+		return
+	}
+	if current == 0 {
+		h.zeros--
+	}
+	h.sum += math.Ldexp(1, -int(rho)) - math.Ldexp(1, -int(current))
+	h.registers[idx] = rho
+}
+
+// merge sets all registers to the maximum of both sketches
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for idx, rho := range other.registers {
+		h.set(uint64(idx), rho)
+	}
+}
+
+func (h *hyperLogLog) estimate() float64 {
+	const m = float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / h.sum
+
+	// Use linear counting for small cardinalities
+	if e <= 2.5*m && h.zeros > 0 {
+		return m * math.Log(m/float64(h.zeros))
+	}
+	return e
+}
@@ -0,0 +1,260 @@
+//go:generate ../../../tools/readme_config_includer/generator
+package series_limit
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/plugins/processors"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// Number of slots the window is divided into, series expire with the
+// granularity of one slot
+const windowSlots = 4
+
+var timeNow = time.Now
+
+type SeriesLimit struct {
+	Limit     int             `toml:"limit"`
+	Window    config.Duration `toml:"window"`
+	Estimator string          `toml:"estimator"`
+	Action    string          `toml:"action"`
+	Tags      []string        `toml:"tags"`
+	FoldValue string          `toml:"fold_value"`
+	Log       telegraf.Logger `toml:"-"`
+
+	Statistics *selfstat.Collector `toml:"-"`
+
+	measurements map[string]*measurement
+	rotated      time.Time
+}
+
+// measurement keeps track of the series of a single measurement
+type measurement struct {
+	series seriesSet
+	// Number of metrics of new series exceeding the limit, including the
+	// stripped and folded metrics
+	suppressed selfstat.Stat
+	warned     bool
+}
+
+// seriesSet counts the distinct series seen within the window
+type seriesSet interface {
+	// add records the series and returns false if the series is new and
+	// would exceed the limit
+	add(id uint64, limit int) bool
+
+	// rotate starts a new slot of the window and forgets about series only
+	// seen before the given cutoff time
+	rotate(cutoff time.Time)
+
+	// empty returns true if no series is recorded
+	empty() bool
+}
+
+func (*SeriesLimit) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *SeriesLimit) Init() error {
+	if s.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if s.Window <= 0 {
+		s.Window = config.Duration(time.Hour)
+	}
+
+	switch s.Estimator {
+	case "":
+		s.Estimator = "exact"
+	case "exact", "hyperloglog":
+	default:
+		return fmt.Errorf("invalid estimator %q", s.Estimator)
+	}
+
+	switch s.Action {
+	case "":
+		s.Action = "drop"
+	case "drop":
+	case "strip", "fold":
+		if len(s.Tags) == 0 {
+			return fmt.Errorf("action %q requires tags", s.Action)
+		}
+	default:
+		return fmt.Errorf("invalid action %q", s.Action)
+	}
+	if s.FoldValue == "" {
+		s.FoldValue = "other"
+	}
+
+	s.measurements = make(map[string]*measurement)
+	s.rotated = timeNow()
+
+	return nil
+}
+
+func (s *SeriesLimit) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	s.rotate()
+
+	out := in[:0]
+	for _, m := range in {
+		tracked, found := s.measurements[m.Name()]
+		if !found {
+			tracked = &measurement{series: s.newSeriesSet()}
+			s.measurements[m.Name()] = tracked
+		}
+		if tracked.series.add(m.HashID(), s.Limit) {
+			out = append(out, m)
+			continue
+		}
+
+		if !tracked.warned {
+			s.Log.Warnf("Limit of %d series reached for measurement %q, applying action %q to new series", s.Limit, m.Name(), s.Action)
+			tracked.warned = true
+		}
+		if tracked.suppressed == nil {
+			tracked.suppressed = s.Statistics.Register("series_limit", "series_suppressed", map[string]string{"measurement": m.Name()})
+		}
+		tracked.suppressed.Incr(1)
+
+		switch s.Action {
+		case "drop":
+			m.Drop()
+			continue
+		case "strip":
+			for _, tag := range s.Tags {
+				m.RemoveTag(tag)
+			}
+		case "fold":
+			for _, tag := range s.Tags {
+				if m.HasTag(tag) {
+					m.AddTag(tag, s.FoldValue)
+				}
+			}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// rotate moves the window forward by the number of elapsed slots
+func (s *SeriesLimit) rotate() {
+	now := timeNow()
+	elapsed := int(now.Sub(s.rotated) / (time.Duration(s.Window) / windowSlots))
+	if elapsed == 0 {
+		return
+	}
+	s.rotated = now
+
+	cutoff := now.Add(-time.Duration(s.Window))
+	for name, tracked := range s.measurements {
+		for range min(elapsed, windowSlots) {
+			tracked.series.rotate(cutoff)
+		}
+		tracked.warned = false
+		if tracked.series.empty() {
+			delete(s.measurements, name)
+		}
+	}
+}
+
+func (s *SeriesLimit) newSeriesSet() seriesSet {
+	if s.Estimator == "hyperloglog" {
+		return newEstimatedSet(s.Limit)
+	}
+	return &exactSet{seen: make(map[uint64]time.Time)}
+}
+
+// exactSet keeps the last time each series was seen
+type exactSet struct {
+	seen map[uint64]time.Time
+}
+
+func (e *exactSet) add(id uint64, limit int) bool {
+	if _, found := e.seen[id]; !found && len(e.seen) >= limit {
+		return false
+	}
+	e.seen[id] = timeNow()
+	return true
+}
+
+func (e *exactSet) rotate(cutoff time.Time) {
+	for id, ts := range e.seen {
+		if ts.Before(cutoff) {
+			delete(e.seen, id)
+		}
+	}
+}
+
+func (e *exactSet) empty() bool {
+	return len(e.seen) == 0
+}
+
+// estimatedSet estimates the number of series using a HyperLogLog sketch
+// and detects known series using a bloom filter, both per slot of the window.
+// Due to false-positives of the filter about 1% of the new series might pass
+// when the limit is reached.
+type estimatedSet struct {
+	capacity int
+	sketches [windowSlots]*hyperLogLog
+	filters  [windowSlots]*bloomFilter
+	current  int
+
+	// Union of the sketches of all slots
+	window *hyperLogLog
+}
+
+func newEstimatedSet(capacity int) *estimatedSet {
+	e := &estimatedSet{capacity: capacity, window: newHyperLogLog()}
+	for i := range windowSlots {
+		e.sketches[i] = newHyperLogLog()
+		e.filters[i] = newBloomFilter(capacity)
+	}
+	return e
+}
+
+func (e *estimatedSet) add(id uint64, limit int) bool {
+	hash := mix(id)
+	known := slices.ContainsFunc(e.filters[:], func(f *bloomFilter) bool { return f.contains(hash) })
+	if !known && e.window.estimate() >= float64(limit) {
+		return false
+	}
+
+	// Record the series in the current slot even if known to keep it in the
+	// window
+	idx, rho := position(hash)
+	e.sketches[e.current].set(idx, rho)
+	e.window.set(idx, rho)
+	e.filters[e.current].add(hash)
+	return true
+}
+
+func (e *estimatedSet) rotate(time.Time) {
+	e.current = (e.current + 1) % windowSlots
+	e.sketches[e.current] = newHyperLogLog()
+	e.filters[e.current] = newBloomFilter(e.capacity)
+
+	e.window = newHyperLogLog()
+	for _, sketch := range e.sketches {
+		e.window.merge(sketch)
+	}
+}
+
+func (e *estimatedSet) empty() bool {
+	return e.window.zeros == hllRegisters
+}
+
+func init() {
+	processors.Add("series_limit", func() telegraf.Processor {
+		return &SeriesLimit{}
+	})
+}
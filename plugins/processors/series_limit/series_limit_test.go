@@ -0,0 +1,226 @@
+package series_limit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func request(id string) telegraf.Metric {
+	return metric.New(
+		"http",
+		map[string]string{"host": "web01", "request_id": id},
+		map[string]interface{}{"duration": 12},
+		time.Unix(0, 0),
+	)
+}
+
+func TestInitInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *SeriesLimit
+		expected string
+	}{
+		{
+			name:     "missing limit",
+			plugin:   &SeriesLimit{},
+			expected: "limit must be positive",
+		},
+		{
+			name:     "invalid estimator",
+			plugin:   &SeriesLimit{Limit: 10, Estimator: "guess"},
+			expected: `invalid estimator "guess"`,
+		},
+		{
+			name:     "invalid action",
+			plugin:   &SeriesLimit{Limit: 10, Action: "ignore"},
+			expected: `invalid action "ignore"`,
+		},
+		{
+			name:     "fold without tags",
+			plugin:   &SeriesLimit{Limit: 10, Action: "fold"},
+			expected: `action "fold" requires tags`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorContains(t, tt.plugin.Init(), tt.expected)
+		})
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   string
+		expected []telegraf.Metric
+	}{
+		{
+			name:   "drop",
+			action: "drop",
+			expected: []telegraf.Metric{
+				request("a"),
+				request("b"),
+				request("a"),
+			},
+		},
+		{
+			name:   "strip",
+			action: "strip",
+			expected: []telegraf.Metric{
+				request("a"),
+				request("b"),
+				metric.New("http", map[string]string{"host": "web01"}, map[string]interface{}{"duration": 12}, time.Unix(0, 0)),
+				request("a"),
+			},
+		},
+		{
+			name:   "fold",
+			action: "fold",
+			expected: []telegraf.Metric{
+				request("a"),
+				request("b"),
+				request("other"),
+				request("a"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &SeriesLimit{
+				Limit:      2,
+				Action:     tt.action,
+				Tags:       []string{"request_id"},
+				Log:        testutil.Logger{},
+				Statistics: selfstat.NewCollector(map[string]string{"_id": tt.name}),
+			}
+			require.NoError(t, plugin.Init())
+			defer plugin.Statistics.UnregisterAll()
+
+			actual := plugin.Apply(request("a"), request("b"), request("c"), request("a"))
+			testutil.RequireMetricsEqual(t, tt.expected, actual)
+
+			// Metrics of new series count as suppressed for all actions
+			suppressed := plugin.Statistics.Get("series_limit", "series_suppressed", map[string]string{"measurement": "http"})
+			require.NotNil(t, suppressed)
+			require.Equal(t, int64(1), suppressed.Get())
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	for _, estimator := range []string{"exact", "hyperloglog"} {
+		t.Run(estimator, func(t *testing.T) {
+			plugin := &SeriesLimit{
+				Limit:      1,
+				Window:     config.Duration(time.Hour),
+				Estimator:  estimator,
+				Log:        testutil.Logger{},
+				Statistics: selfstat.NewCollector(nil),
+			}
+			require.NoError(t, plugin.Init())
+			defer plugin.Statistics.UnregisterAll()
+
+			require.Len(t, plugin.Apply(request("a")), 1)
+			require.Empty(t, plugin.Apply(request("b")))
+
+			// Series seen within the window are kept
+			now = now.Add(45 * time.Minute)
+			require.Len(t, plugin.Apply(request("a")), 1)
+			require.Empty(t, plugin.Apply(request("b")))
+
+			// Series expire after not being seen for the window
+			now = now.Add(75 * time.Minute)
+			require.Len(t, plugin.Apply(request("b")), 1)
+			require.Empty(t, plugin.Apply(request("a")))
+
+			// Measurements without series are removed
+			now = now.Add(2 * time.Hour)
+			plugin.Apply()
+			require.Empty(t, plugin.measurements)
+		})
+	}
+}
+
+func TestStatisticsPerInstance(t *testing.T) {
+	first := &SeriesLimit{
+		Limit:      1,
+		Log:        testutil.Logger{},
+		Statistics: selfstat.NewCollector(map[string]string{"_id": "first"}),
+	}
+	require.NoError(t, first.Init())
+	defer first.Statistics.UnregisterAll()
+
+	second := &SeriesLimit{
+		Limit:      1,
+		Log:        testutil.Logger{},
+		Statistics: selfstat.NewCollector(map[string]string{"_id": "second"}),
+	}
+	require.NoError(t, second.Init())
+	defer second.Statistics.UnregisterAll()
+
+	first.Apply(request("a"), request("b"), request("c"))
+	second.Apply(request("a"), request("b"))
+
+	tags := map[string]string{"measurement": "http"}
+	require.Equal(t, int64(2), first.Statistics.Get("series_limit", "series_suppressed", tags).Get())
+	require.Equal(t, int64(1), second.Statistics.Get("series_limit", "series_suppressed", tags).Get())
+}
+
+func TestMeasurementsLimitedIndependently(t *testing.T) {
+	plugin := &SeriesLimit{Limit: 1, Log: testutil.Logger{}, Statistics: selfstat.NewCollector(nil)}
+	require.NoError(t, plugin.Init())
+	defer plugin.Statistics.UnregisterAll()
+
+	other := metric.New("sql", map[string]string{"query_id": "1"}, map[string]interface{}{"duration": 3}, time.Unix(0, 0))
+	actual := plugin.Apply(request("a"), other, request("b"))
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{request("a"), other}, actual)
+}
+
+func TestHyperLogLogLimit(t *testing.T) {
+	plugin := &SeriesLimit{
+		Limit:      1000,
+		Estimator:  "hyperloglog",
+		Log:        testutil.Logger{},
+		Statistics: selfstat.NewCollector(nil),
+	}
+	require.NoError(t, plugin.Init())
+	defer plugin.Statistics.UnregisterAll()
+
+	var passed int
+	for i := range 10000 {
+		passed += len(plugin.Apply(request(strconv.Itoa(i))))
+	}
+	require.InDelta(t, 1000, passed, 150)
+
+	// Known series pass
+	require.Len(t, plugin.Apply(request("0")), 1)
+}
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			h := newHyperLogLog()
+			for i := range n {
+				h.set(position(mix(request(strconv.Itoa(i)).HashID())))
+			}
+			require.InEpsilon(t, float64(n), h.estimate(), 0.05)
+		})
+	}
+}
@@ -0,0 +1,288 @@
+//go:generate ../../../tools/readme_config_includer/generator
+package threshold
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+var timeNow = time.Now
+
+type Threshold struct {
+	Warn           string          `toml:"warn"`
+	WarnClear      string          `toml:"warn_clear"`
+	Crit           string          `toml:"crit"`
+	CritClear      string          `toml:"crit_clear"`
+	For            config.Duration `toml:"for"`
+	RecoverFor     config.Duration `toml:"recover_for"`
+	Measurement    string          `toml:"measurement"`
+	RecoveryEvents bool            `toml:"recovery_events"`
+	SeriesTimeout  config.Duration `toml:"series_timeout"`
+	Log            telegraf.Logger `toml:"-"`
+
+	// Conditions are evaluated in the same way as the 'metricpass' filter
+	warn      *models.Filter
+	warnClear *models.Filter
+	crit      *models.Filter
+	critClear *models.Filter
+
+	// Series not in the 'ok' state or with a pending state change
+	series  state
+	expired time.Time
+}
+
+type level int
+
+const (
+	ok level = iota
+	warn
+	crit
+)
+
+func (l level) String() string {
+	switch l {
+	case ok:
+		return "ok"
+	case warn:
+		return "warn"
+	case crit:
+		return "crit"
+	}
+	return fmt.Sprintf("unknown (%d)", int(l))
+}
+
+// series keeps track of the state of a single series
+type series struct {
+	State        level     `json:"state"`
+	Pending      level     `json:"pending"`
+	PendingSince time.Time `json:"pending_since"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+type state map[uint64]*series
+
+func (*Threshold) SampleConfig() string {
+	return sampleConfig
+}
+
+func (t *Threshold) Init() error {
+	if t.Warn == "" && t.Crit == "" {
+		return errors.New("no 'warn' or 'crit' condition configured")
+	}
+	if t.Warn == "" && t.WarnClear != "" {
+		return errors.New("'warn_clear' requires a 'warn' condition")
+	}
+	if t.Crit == "" && t.CritClear != "" {
+		return errors.New("'crit_clear' requires a 'crit' condition")
+	}
+	if t.For < 0 || t.RecoverFor < 0 {
+		return errors.New("durations must not be negative")
+	}
+	if t.Measurement == "" {
+		t.Measurement = "alert"
+	}
+	if t.SeriesTimeout == 0 {
+		t.SeriesTimeout = config.Duration(24 * time.Hour)
+	}
+	if t.SeriesTimeout < 0 {
+		return errors.New("series timeout must be positive")
+	}
+
+	for _, c := range []struct {
+		option     string
+		expression string
+		condition  **models.Filter
+	}{
+		{"warn", t.Warn, &t.warn},
+		{"warn_clear", t.WarnClear, &t.warnClear},
+		{"crit", t.Crit, &t.crit},
+		{"crit_clear", t.CritClear, &t.critClear},
+	} {
+		if c.expression == "" {
+			continue
+		}
+		f := &models.Filter{MetricPass: c.expression}
+		if err := f.Compile(); err != nil {
+			return fmt.Errorf("compiling %q condition failed: %w", c.option, err)
+		}
+		*c.condition = f
+	}
+
+	t.series = make(state)
+	t.expired = timeNow()
+
+	return nil
+}
+
+func (t *Threshold) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	now := timeNow()
+	t.expire(now)
+
+	out := make([]telegraf.Metric, 0, len(in))
+	for _, m := range in {
+		out = append(out, m)
+
+		id := m.HashID()
+		s, found := t.series[id]
+		if !found {
+			s = &series{State: ok, Pending: ok}
+		}
+		s.LastSeen = now
+
+		target, err := t.evaluate(m, s.State)
+		if err != nil {
+			// Metrics without the fields used by the conditions are expected
+			// when not restricting the plugin to the relevant metrics
+			if strings.Contains(err.Error(), "no such key") {
+				t.Log.Debugf("Skipping metric %q: %v", m.Name(), err)
+			} else {
+				t.Log.Errorf("Evaluating conditions for metric %q failed: %v", m.Name(), err)
+			}
+			continue
+		}
+
+		// Cancel any pending change if the series stays in its state
+		if target == s.State {
+			if s.State == ok {
+				delete(t.series, id)
+			} else {
+				s.Pending = s.State
+			}
+			continue
+		}
+		t.series[id] = s
+
+		// Keep the start of a pending change as long as the series moves in
+		// the same direction, e.g. escalating from 'ok' via 'warn' to 'crit'
+		if s.Pending == s.State || (s.Pending > s.State) != (target > s.State) {
+			s.PendingSince = m.Time()
+		}
+		s.Pending = target
+
+		delay := time.Duration(t.For)
+		if target < s.State {
+			delay = time.Duration(t.RecoverFor)
+		}
+		if m.Time().Sub(s.PendingSince) < delay {
+			continue
+		}
+
+		previous := s.State
+		s.State = target
+		if target == ok {
+			delete(t.series, id)
+			if !t.RecoveryEvents {
+				continue
+			}
+		}
+
+		tags := m.Tags()
+		tags["measurement"] = m.Name()
+		fields := map[string]interface{}{
+			"state":          target.String(),
+			"previous_state": previous.String(),
+			"level":          int64(target),
+		}
+		out = append(out, metric.New(t.Measurement, tags, fields, m.Time()))
+	}
+	return out
+}
+
+// evaluate determines the state of the series for the given metric taking
+// the clear conditions of the current state into account
+func (t *Threshold) evaluate(m telegraf.Metric, current level) (level, error) {
+	for _, c := range []struct {
+		level level
+		set   *models.Filter
+		clear *models.Filter
+	}{
+		{crit, t.crit, t.critClear},
+		{warn, t.warn, t.warnClear},
+	} {
+		if c.set == nil {
+			continue
+		}
+		match, err := c.set.Select(m)
+		if err != nil {
+			return current, fmt.Errorf("%s condition: %w", c.level, err)
+		}
+		if match {
+			return c.level, nil
+		}
+
+		// Stay in the state until the clear condition is met
+		if current >= c.level && c.clear != nil {
+			cleared, err := c.clear.Select(m)
+			if err != nil {
+				return current, fmt.Errorf("%s clear condition: %w", c.level, err)
+			}
+			if !cleared {
+				return c.level, nil
+			}
+		}
+	}
+	return ok, nil
+}
+
+// expire removes the series not seen within the series timeout to limit the
+// memory usage and the size of the state. To limit the overhead, the check is
+// done at most once per tenth of the timeout.
+func (t *Threshold) expire(now time.Time) {
+	timeout := time.Duration(t.SeriesTimeout)
+	if now.Sub(t.expired) < timeout/10 {
+		return
+	}
+	t.expired = now
+
+	for id, s := range t.series {
+		if now.Sub(s.LastSeen) > timeout {
+			delete(t.series, id)
+		}
+	}
+}
+
+func (t *Threshold) GetState() interface{} {
+	return t.series
+}
+
+func (t *Threshold) SetState(st interface{}) error {
+	restored, valid := st.(state)
+	if !valid {
+		return fmt.Errorf("invalid state type %T", st)
+	}
+	if restored == nil {
+		restored = make(state)
+	}
+
+	// Series of states without the last-seen time expire after the timeout
+	// starting now
+	now := timeNow()
+	for id, s := range restored {
+		if s.LastSeen.IsZero() {
+			s.LastSeen = now
+		}
+		if now.Sub(s.LastSeen) > time.Duration(t.SeriesTimeout) {
+			delete(restored, id)
+		}
+	}
+	t.series = restored
+	return nil
+}
+
+func init() {
+	processors.Add("threshold", func() telegraf.Processor {
+		return &Threshold{}
+	})
+}
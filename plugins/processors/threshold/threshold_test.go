@@ -0,0 +1,298 @@
+package threshold
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func cpu(idle float64, sec int64) telegraf.Metric {
+	return metric.New("cpu", map[string]string{"host": "web01"}, map[string]interface{}{"usage_idle": idle}, time.Unix(sec, 0))
+}
+
+func alert(current, previous level, sec int64) telegraf.Metric {
+	return metric.New(
+		"alert",
+		map[string]string{"host": "web01", "measurement": "cpu"},
+		map[string]interface{}{
+			"state":          current.String(),
+			"previous_state": previous.String(),
+			"level":          int64(current),
+		},
+		time.Unix(sec, 0),
+	)
+}
+
+// events runs the metrics through the plugin and returns the emitted events
+func events(plugin *Threshold, metrics ...telegraf.Metric) []telegraf.Metric {
+	var result []telegraf.Metric
+	for _, m := range plugin.Apply(metrics...) {
+		if m.Name() == plugin.Measurement {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func TestInitInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *Threshold
+		expected string
+	}{
+		{
+			name:     "no conditions",
+			plugin:   &Threshold{},
+			expected: "no 'warn' or 'crit' condition configured",
+		},
+		{
+			name:     "clear without condition",
+			plugin:   &Threshold{Warn: "fields.value > 1", CritClear: "fields.value < 1"},
+			expected: "'crit_clear' requires a 'crit' condition",
+		},
+		{
+			name:     "invalid expression",
+			plugin:   &Threshold{Warn: "fields.value >"},
+			expected: `compiling "warn" condition failed`,
+		},
+		{
+			name:     "non-boolean expression",
+			plugin:   &Threshold{Crit: "fields.value"},
+			expected: "expression needs to return a boolean",
+		},
+		{
+			name:     "negative duration",
+			plugin:   &Threshold{Crit: "fields.value > 1", For: config.Duration(-time.Second)},
+			expected: "durations must not be negative",
+		},
+		{
+			name:     "negative series timeout",
+			plugin:   &Threshold{Crit: "fields.value > 1", SeriesTimeout: config.Duration(-time.Second)},
+			expected: "series timeout must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorContains(t, tt.plugin.Init(), tt.expected)
+		})
+	}
+}
+
+func TestStateChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *Threshold
+		input    []telegraf.Metric
+		expected []telegraf.Metric
+	}{
+		{
+			name: "immediate",
+			plugin: &Threshold{
+				Warn: "fields.usage_idle < 20.0",
+				Crit: "fields.usage_idle < 5.0",
+			},
+			input: []telegraf.Metric{cpu(42, 0), cpu(12, 10), cpu(3, 20), cpu(12, 30), cpu(30, 40)},
+			expected: []telegraf.Metric{
+				alert(warn, ok, 10),
+				alert(crit, warn, 20),
+				alert(warn, crit, 30),
+			},
+		},
+		{
+			name: "recovery events",
+			plugin: &Threshold{
+				Crit:           "fields.usage_idle < 5.0",
+				RecoveryEvents: true,
+			},
+			input: []telegraf.Metric{cpu(42, 0), cpu(3, 10), cpu(30, 20)},
+			expected: []telegraf.Metric{
+				alert(crit, ok, 10),
+				alert(ok, crit, 20),
+			},
+		},
+		{
+			name: "hysteresis",
+			plugin: &Threshold{
+				Warn:           "fields.usage_idle < 20.0",
+				WarnClear:      "fields.usage_idle > 25.0",
+				Crit:           "fields.usage_idle < 5.0",
+				CritClear:      "fields.usage_idle > 10.0",
+				RecoveryEvents: true,
+			},
+			input: []telegraf.Metric{cpu(3, 0), cpu(8, 10), cpu(4, 20), cpu(12, 30), cpu(22, 40), cpu(18, 50), cpu(30, 60)},
+			expected: []telegraf.Metric{
+				alert(crit, ok, 0),
+				alert(warn, crit, 30),
+				alert(ok, warn, 60),
+			},
+		},
+		{
+			name: "for",
+			plugin: &Threshold{
+				Warn: "fields.usage_idle < 20.0",
+				Crit: "fields.usage_idle < 5.0",
+				For:  config.Duration(time.Minute),
+			},
+			input: []telegraf.Metric{
+				// Short spike
+				cpu(3, 0), cpu(30, 30),
+				// Escalation via warn
+				cpu(12, 100), cpu(3, 130), cpu(3, 160),
+				// De-escalation is immediate
+				cpu(12, 170),
+			},
+			expected: []telegraf.Metric{
+				alert(crit, ok, 160),
+				alert(warn, crit, 170),
+			},
+		},
+		{
+			name: "recover for",
+			plugin: &Threshold{
+				Crit:           "fields.usage_idle < 5.0",
+				RecoverFor:     config.Duration(time.Minute),
+				RecoveryEvents: true,
+			},
+			input: []telegraf.Metric{cpu(3, 0), cpu(30, 10), cpu(3, 20), cpu(30, 30), cpu(30, 60), cpu(30, 90)},
+			expected: []telegraf.Metric{
+				alert(crit, ok, 0),
+				alert(ok, crit, 90),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.plugin.Log = testutil.Logger{}
+			require.NoError(t, tt.plugin.Init())
+
+			var actual []telegraf.Metric
+			for _, m := range tt.input {
+				actual = append(actual, events(tt.plugin, m)...)
+			}
+			testutil.RequireMetricsEqual(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestSeriesIndependent(t *testing.T) {
+	plugin := &Threshold{Crit: "fields.usage_idle < 5.0", Log: testutil.Logger{}}
+	require.NoError(t, plugin.Init())
+
+	other := metric.New("cpu", map[string]string{"host": "web02"}, map[string]interface{}{"usage_idle": 3.0}, time.Unix(0, 0))
+	input := []telegraf.Metric{cpu(3, 0), other, cpu(30, 0)}
+	expected := []telegraf.Metric{
+		input[0],
+		alert(crit, ok, 0),
+		input[1],
+		metric.New(
+			"alert",
+			map[string]string{"host": "web02", "measurement": "cpu"},
+			map[string]interface{}{"state": "crit", "previous_state": "ok", "level": int64(2)},
+			time.Unix(0, 0),
+		),
+		input[2],
+	}
+	testutil.RequireMetricsEqual(t, expected, plugin.Apply(input...))
+	require.Len(t, plugin.series, 1)
+}
+
+func TestEvaluationError(t *testing.T) {
+	logger := &testutil.CaptureLogger{}
+	plugin := &Threshold{Crit: "fields.usage_idle < 5.0", Log: logger}
+	require.NoError(t, plugin.Init())
+
+	require.Len(t, events(plugin, cpu(3, 0)), 1)
+
+	// Metrics without the field are passed, keep the state and are no error
+	m := metric.New("cpu", map[string]string{"host": "web01"}, map[string]interface{}{"usage_user": 50.0}, time.Unix(10, 0))
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{m}, plugin.Apply(m))
+	require.Equal(t, crit, plugin.series[m.HashID()].State)
+	require.Empty(t, logger.Errors())
+
+	// Other failures are errors
+	m = metric.New("cpu", map[string]string{"host": "web01"}, map[string]interface{}{"usage_idle": "high"}, time.Unix(20, 0))
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{m}, plugin.Apply(m))
+	require.Equal(t, crit, plugin.series[m.HashID()].State)
+	require.Len(t, logger.Errors(), 1)
+}
+
+func TestSeriesTimeout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	plugin := &Threshold{
+		Crit:          "fields.usage_idle < 5.0",
+		SeriesTimeout: config.Duration(time.Hour),
+		Log:           testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	require.Len(t, events(plugin, cpu(3, 0)), 1)
+
+	// Series seen within the timeout are kept
+	now = now.Add(50 * time.Minute)
+	other := metric.New("cpu", map[string]string{"host": "web02"}, map[string]interface{}{"usage_idle": 3.0}, time.Unix(0, 0))
+	require.Len(t, events(plugin, other), 1)
+	require.Len(t, plugin.series, 2)
+
+	// Series in a critical state not seen anymore expire
+	now = now.Add(20 * time.Minute)
+	require.Empty(t, events(plugin, other))
+	require.Len(t, plugin.series, 1)
+	require.Contains(t, plugin.series, other.HashID())
+
+	// Expired series are not restored
+	buf, err := json.Marshal(plugin.GetState())
+	require.NoError(t, err)
+	var st state
+	require.NoError(t, json.Unmarshal(buf, &st))
+	now = now.Add(2 * time.Hour)
+	restored := &Threshold{
+		Crit:          "fields.usage_idle < 5.0",
+		SeriesTimeout: config.Duration(time.Hour),
+		Log:           testutil.Logger{},
+	}
+	require.NoError(t, restored.Init())
+	require.NoError(t, restored.SetState(st))
+	require.Empty(t, restored.series)
+}
+
+func TestState(t *testing.T) {
+	plugin := &Threshold{
+		Warn: "fields.usage_idle < 20.0",
+		Crit: "fields.usage_idle < 5.0",
+		For:  config.Duration(time.Minute),
+		Log:  testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	require.Empty(t, events(plugin, cpu(12, 0), cpu(3, 30)))
+
+	// Serialize the state in the same way as the persister
+	buf, err := json.Marshal(plugin.GetState())
+	require.NoError(t, err)
+	var st state
+	require.NoError(t, json.Unmarshal(buf, &st))
+
+	restored := &Threshold{
+		Warn: "fields.usage_idle < 20.0",
+		Crit: "fields.usage_idle < 5.0",
+		For:  config.Duration(time.Minute),
+		Log:  testutil.Logger{},
+	}
+	require.NoError(t, restored.Init())
+	require.NoError(t, restored.SetState(st))
+
+	// The pending escalation continues after the restart
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{alert(crit, ok, 60)}, events(restored, cpu(3, 60)))
+}